@@ -0,0 +1,475 @@
+// Package client is a typed Go client for the deviceapi HTTP API served by
+// "sysutil deviceapi", over TCP or a unix socket.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/giftpilz0/sysutil/handlers"
+)
+
+const (
+	// unixPrefix marks an address as a unix socket path, as accepted by deviceapi --listen.
+	unixPrefix = "unix:"
+
+	// unixHost is the placeholder host used in URLs for unix socket connections.
+	unixHost = "deviceapi"
+)
+
+// Client calls the deviceapi endpoints.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	dial       func(ctx context.Context) (net.Conn, error)
+	token      string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithToken authenticates every request with a bearer token.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient replaces the HTTP client used for TCP addresses, e.g. to set
+// timeouts. It is ignored for unix socket addresses.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// Error is returned when deviceapi answers with a non-success status code.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("deviceapi: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// New creates a client for a deviceapi address: "http://host:port", "host:port"
+// or "unix:/path/to/socket".
+func New(address string, options ...Option) (*Client, error) {
+	c := &Client{}
+	for _, option := range options {
+		option(c)
+	}
+
+	if path, ok := strings.CutPrefix(address, unixPrefix); ok {
+		dialer := &net.Dialer{}
+		c.dial = func(ctx context.Context) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", path)
+		}
+		c.baseURL = &url.URL{Scheme: "http", Host: unixHost}
+		c.httpClient = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return c.dial(ctx)
+				},
+			},
+		}
+	} else {
+		if !strings.Contains(address, "://") {
+			address = "http://" + address
+		}
+		baseURL, err := url.Parse(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deviceapi address: %w", err)
+		}
+		c.baseURL = baseURL
+		if c.httpClient == nil {
+			c.httpClient = http.DefaultClient
+		}
+
+		dialer := &net.Dialer{}
+		c.dial = func(ctx context.Context) (net.Conn, error) {
+			host := baseURL.Host
+			if baseURL.Port() == "" {
+				host = net.JoinHostPort(baseURL.Hostname(), "80")
+			}
+			return dialer.DialContext(ctx, "tcp", host)
+		}
+	}
+
+	return c, nil
+}
+
+// url builds the URL of an endpoint with optional query parameters.
+func (c *Client) url(path string, query url.Values) string {
+	u := *c.baseURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// newRequest creates an authenticated request.
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body any) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path, query), reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// do sends a request and returns the response, turning error statuses into *Error.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	return resp, nil
+}
+
+// call sends a JSON request and decodes the JSON response into out.
+func (c *Client) call(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", path, err)
+	}
+	return nil
+}
+
+// Network returns the network devices (GET /network); the overall connectivity
+// comes from NetworkStatus.
+func (c *Client) Network(ctx context.Context) ([]handlers.NetworkDevice, error) {
+	var devices []handlers.NetworkDevice
+	err := c.call(ctx, http.MethodGet, "/network", nil, nil, &devices)
+	return devices, err
+}
+
+// NetworkStatus returns the overall network state and connectivity (GET /network/status).
+func (c *Client) NetworkStatus(ctx context.Context) (handlers.NetworkStatus, error) {
+	var status handlers.NetworkStatus
+	err := c.call(ctx, http.MethodGet, "/network/status", nil, nil, &status)
+	return status, err
+}
+
+// ScanWifi returns the visible Wi-Fi access points, strongest first, after
+// asking the wireless devices to scan when rescan is set, which needs the write
+// scope (GET /network/wifi/scan).
+func (c *Client) ScanWifi(ctx context.Context, rescan bool) ([]handlers.AccessPoint, error) {
+	query := url.Values{}
+	if rescan {
+		query.Set("rescan", "true")
+	}
+	var accessPoints []handlers.AccessPoint
+	err := c.call(ctx, http.MethodGet, "/network/wifi/scan", query, nil, &accessPoints)
+	return accessPoints, err
+}
+
+// ConnectWifi adds a connection profile for a Wi-Fi network and activates it
+// (POST /network/wifi/connect).
+func (c *Client) ConnectWifi(ctx context.Context, request handlers.WifiConnectRequest) error {
+	return c.call(ctx, http.MethodPost, "/network/wifi/connect", nil, request, nil)
+}
+
+// DisconnectDevice disconnects a network device given by its interface name
+// (POST /network/devices/disconnect).
+func (c *Client) DisconnectDevice(ctx context.Context, device string) error {
+	return c.call(ctx, http.MethodPost, "/network/devices/disconnect", nil, handlers.DisconnectDeviceRequest{Device: device}, nil)
+}
+
+// Connections returns the saved connection profiles (GET /network/connections).
+func (c *Client) Connections(ctx context.Context) ([]handlers.ConnectionProfile, error) {
+	var profiles []handlers.ConnectionProfile
+	err := c.call(ctx, http.MethodGet, "/network/connections", nil, nil, &profiles)
+	return profiles, err
+}
+
+// ActivateConnection activates a saved connection profile, given by UUID or name,
+// on a device unless it is empty (POST /network/connections/activate).
+func (c *Client) ActivateConnection(ctx context.Context, connection, device string) error {
+	request := handlers.ActivateConnectionRequest{Connection: connection, Device: device}
+	return c.call(ctx, http.MethodPost, "/network/connections/activate", nil, request, nil)
+}
+
+// DeleteConnection deletes a saved connection profile, given by UUID or name
+// (POST /network/connections/delete).
+func (c *Client) DeleteConnection(ctx context.Context, connection string) error {
+	return c.call(ctx, http.MethodPost, "/network/connections/delete", nil, handlers.DeleteConnectionRequest{Connection: connection}, nil)
+}
+
+// VPN returns the VPN and WireGuard connections and their state (GET /network/vpn).
+func (c *Client) VPN(ctx context.Context) ([]handlers.VPNConnection, error) {
+	var connections []handlers.VPNConnection
+	err := c.call(ctx, http.MethodGet, "/network/vpn", nil, nil, &connections)
+	return connections, err
+}
+
+// VPNUp activates a VPN or WireGuard connection, given by UUID or name
+// (POST /network/vpn/up).
+func (c *Client) VPNUp(ctx context.Context, connection string) error {
+	return c.call(ctx, http.MethodPost, "/network/vpn/up", nil, handlers.VPNRequest{Connection: connection}, nil)
+}
+
+// VPNDown deactivates a VPN or WireGuard connection, given by UUID or name
+// (POST /network/vpn/down).
+func (c *Client) VPNDown(ctx context.Context, connection string) error {
+	return c.call(ctx, http.MethodPost, "/network/vpn/down", nil, handlers.VPNRequest{Connection: connection}, nil)
+}
+
+// Radio returns the radio switches, the rfkill devices and whether airplane mode
+// is on (GET /network/radio).
+func (c *Client) Radio(ctx context.Context) (handlers.RadioState, error) {
+	var state handlers.RadioState
+	err := c.call(ctx, http.MethodGet, "/network/radio", nil, nil, &state)
+	return state, err
+}
+
+// EnableRadio enables or disables the radios set in request (POST /network/radio/enable).
+func (c *Client) EnableRadio(ctx context.Context, request handlers.RadioRequest) error {
+	return c.call(ctx, http.MethodPost, "/network/radio/enable", nil, request, nil)
+}
+
+// SetAirplaneMode turns airplane mode on or off (POST /network/radio/airplane-mode).
+func (c *Client) SetAirplaneMode(ctx context.Context, enabled bool) error {
+	return c.call(ctx, http.MethodPost, "/network/radio/airplane-mode", nil, handlers.AirplaneModeRequest{Enabled: enabled}, nil)
+}
+
+// Bluetooth returns the Bluetooth adapters and devices (GET /bluetooth).
+func (c *Client) Bluetooth(ctx context.Context) (handlers.Bluetooth, error) {
+	var state handlers.Bluetooth
+	err := c.call(ctx, http.MethodGet, "/bluetooth", nil, nil, &state)
+	return state, err
+}
+
+// SetBluetoothPowered powers an adapter on or off, given by name or address, or
+// the first adapter if empty (POST /bluetooth/power).
+func (c *Client) SetBluetoothPowered(ctx context.Context, adapter string, powered bool) error {
+	return c.call(ctx, http.MethodPost, "/bluetooth/power", nil, handlers.BluetoothPowerRequest{Adapter: adapter, Powered: powered}, nil)
+}
+
+// BluetoothDiscovery starts or stops discovering devices (POST /bluetooth/discovery).
+func (c *Client) BluetoothDiscovery(ctx context.Context, request handlers.BluetoothDiscoveryRequest) error {
+	return c.call(ctx, http.MethodPost, "/bluetooth/discovery", nil, request, nil)
+}
+
+// ConnectBluetoothDevice connects a device, given by address or name
+// (POST /bluetooth/devices/connect).
+func (c *Client) ConnectBluetoothDevice(ctx context.Context, device string) error {
+	return c.call(ctx, http.MethodPost, "/bluetooth/devices/connect", nil, handlers.BluetoothDeviceRequest{Device: device}, nil)
+}
+
+// DisconnectBluetoothDevice disconnects a device, given by address or name
+// (POST /bluetooth/devices/disconnect).
+func (c *Client) DisconnectBluetoothDevice(ctx context.Context, device string) error {
+	return c.call(ctx, http.MethodPost, "/bluetooth/devices/disconnect", nil, handlers.BluetoothDeviceRequest{Device: device}, nil)
+}
+
+// PairBluetoothDevice pairs with and trusts a device, given by address or name
+// (POST /bluetooth/devices/pair).
+func (c *Client) PairBluetoothDevice(ctx context.Context, device string) error {
+	return c.call(ctx, http.MethodPost, "/bluetooth/devices/pair", nil, handlers.BluetoothDeviceRequest{Device: device}, nil)
+}
+
+// RemoveBluetoothDevice unpairs and forgets a device, given by address or name
+// (POST /bluetooth/devices/remove).
+func (c *Client) RemoveBluetoothDevice(ctx context.Context, device string) error {
+	return c.call(ctx, http.MethodPost, "/bluetooth/devices/remove", nil, handlers.BluetoothDeviceRequest{Device: device}, nil)
+}
+
+// Battery returns the battery status (GET /battery).
+func (c *Client) Battery(ctx context.Context) (handlers.Battery, error) {
+	var battery handlers.Battery
+	err := c.call(ctx, http.MethodGet, "/battery", nil, nil, &battery)
+	return battery, err
+}
+
+// BatteryHistory returns the battery samples recorded since a time, averaged over
+// step unless it is zero, and the UPower history of the same period
+// (GET /battery/history). A zero since uses the server default of 24 hours.
+func (c *Client) BatteryHistory(ctx context.Context, since time.Time, step time.Duration) (handlers.BatteryHistoryResponse, error) {
+	query := url.Values{}
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339))
+	}
+	if step > 0 {
+		query.Set("step", step.String())
+	}
+	var history handlers.BatteryHistoryResponse
+	err := c.call(ctx, http.MethodGet, "/battery/history", query, nil, &history)
+	return history, err
+}
+
+// SetChargeThreshold enables or disables the charge thresholds of a battery, given
+// by its native path like "BAT0" (POST /battery/charge-threshold).
+func (c *Client) SetChargeThreshold(ctx context.Context, device string, enabled bool) error {
+	request := handlers.ChargeThresholdRequest{Device: device, Enabled: enabled}
+	return c.call(ctx, http.MethodPost, "/battery/charge-threshold", nil, request, nil)
+}
+
+// PowerProfiles returns the power profiles and the active one (GET /power/profiles).
+func (c *Client) PowerProfiles(ctx context.Context) (handlers.PowerProfiles, error) {
+	var profiles handlers.PowerProfiles
+	err := c.call(ctx, http.MethodGet, "/power/profiles", nil, nil, &profiles)
+	return profiles, err
+}
+
+// SetPowerProfile selects the active power profile, e.g. "power-saver"
+// (POST /power/profiles/active).
+func (c *Client) SetPowerProfile(ctx context.Context, profile string) error {
+	return c.call(ctx, http.MethodPost, "/power/profiles/active", nil, handlers.PowerProfileRequest{Profile: profile}, nil)
+}
+
+// AudioOutputs returns the audio output devices (GET /audio/outputs).
+func (c *Client) AudioOutputs(ctx context.Context) ([]handlers.AudioInfo, error) {
+	var outputs []handlers.AudioInfo
+	err := c.call(ctx, http.MethodGet, "/audio/outputs", nil, nil, &outputs)
+	return outputs, err
+}
+
+// AudioInputs returns the audio input devices (GET /audio/inputs).
+func (c *Client) AudioInputs(ctx context.Context) ([]handlers.AudioInfo, error) {
+	var inputs []handlers.AudioInfo
+	err := c.call(ctx, http.MethodGet, "/audio/inputs", nil, nil, &inputs)
+	return inputs, err
+}
+
+// AudioActions applies volume, mute and default device actions (POST /audio/actions).
+// In atomic mode a failing action rolls back the whole batch. The per-action results
+// are returned even when the server reports an error, together with an *Error.
+func (c *Client) AudioActions(ctx context.Context, actions []handlers.VolumeAction, atomic bool) (handlers.ActionsResponse, error) {
+	return c.actions(ctx, "/audio/actions", actions, atomic)
+}
+
+// AudioStreams returns the application streams of a type, "sink-input" or
+// "source-output", or all of them when streamType is empty (GET /audio/streams).
+func (c *Client) AudioStreams(ctx context.Context, streamType string) ([]handlers.AudioStream, error) {
+	var query url.Values
+	if streamType != "" {
+		query = url.Values{"type": {streamType}}
+	}
+	var streams []handlers.AudioStream
+	err := c.call(ctx, http.MethodGet, "/audio/streams", query, nil, &streams)
+	return streams, err
+}
+
+// AudioStreamActions changes the volume and mute state of application streams or moves
+// them to another device (POST /audio/streams/actions), with the same atomic mode and
+// results as AudioActions.
+func (c *Client) AudioStreamActions(ctx context.Context, actions []handlers.StreamAction, atomic bool) (handlers.ActionsResponse, error) {
+	return c.actions(ctx, "/audio/streams/actions", actions, atomic)
+}
+
+// AudioCards returns the sound cards with their profiles and ports (GET /audio/cards).
+func (c *Client) AudioCards(ctx context.Context) ([]handlers.AudioCard, error) {
+	var cards []handlers.AudioCard
+	err := c.call(ctx, http.MethodGet, "/audio/cards", nil, nil, &cards)
+	return cards, err
+}
+
+// AudioCardActions switches the active profile of sound cards (POST /audio/cards/actions),
+// with the same atomic mode and results as AudioActions.
+func (c *Client) AudioCardActions(ctx context.Context, actions []handlers.CardAction, atomic bool) (handlers.ActionsResponse, error) {
+	return c.actions(ctx, "/audio/cards/actions", actions, atomic)
+}
+
+// actions posts a batch of actions and decodes the per-action results, which are
+// also sent along with error statuses.
+func (c *Client) actions(ctx context.Context, path string, actions any, atomic bool) (handlers.ActionsResponse, error) {
+	var response handlers.ActionsResponse
+
+	query := url.Values{}
+	if atomic {
+		query.Set("atomic", "true")
+	}
+	req, err := c.newRequest(ctx, http.MethodPost, path, query, actions)
+	if err != nil {
+		return response, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return response, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return response, err
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return response, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+		}
+		return response, fmt.Errorf("failed to decode %s response: %w", path, err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		message := response.Status
+		if response.Error != "" {
+			message += ": " + response.Error
+		}
+		return response, &Error{StatusCode: resp.StatusCode, Message: message}
+	}
+
+	return response, nil
+}
+
+// Metrics returns the Prometheus text exposition of the device metrics (GET /metrics).
+func (c *Client) Metrics(ctx context.Context) (string, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/metrics", nil, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	metrics, err := io.ReadAll(resp.Body)
+	return string(metrics), err
+}
+
+// OpenAPI returns the OpenAPI document describing the API (GET /openapi.json).
+func (c *Client) OpenAPI(ctx context.Context) (json.RawMessage, error) {
+	var document json.RawMessage
+	err := c.call(ctx, http.MethodGet, "/openapi.json", nil, nil, &document)
+	return document, err
+}
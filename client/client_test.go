@@ -0,0 +1,220 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/giftpilz0/sysutil/client"
+	"github.com/giftpilz0/sysutil/handlers"
+)
+
+// request is what the test server received.
+type request struct {
+	method, path, query string
+	authorization       string
+	contentType         string
+	body                string
+}
+
+// serveJSON starts a server recording every request and answering with status and
+// body, and returns its URL and the recorded requests.
+func serveJSON(t *testing.T, status int, body string) (string, <-chan request) {
+	t.Helper()
+
+	requests := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		requests <- request{r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get("Authorization"), r.Header.Get("Content-Type"), string(data)}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, requests
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	since := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		call     func(c *client.Client) (any, error)
+		response string
+		want     request
+		result   any
+	}{
+		{
+			name:     "network",
+			call:     func(c *client.Client) (any, error) { return c.Network(context.Background()) },
+			response: `[{"interface":"wlan0","type":"wifi","state":"activated"}]`,
+			want:     request{method: http.MethodGet, path: "/api/network"},
+			result:   []handlers.NetworkDevice{{Interface: "wlan0", Type: "wifi", State: "activated"}},
+		},
+		{
+			name:     "rescan",
+			call:     func(c *client.Client) (any, error) { return c.ScanWifi(context.Background(), true) },
+			response: `[{"ssid":"home","strength":80}]`,
+			want:     request{method: http.MethodGet, path: "/api/network/wifi/scan", query: "rescan=true"},
+			result:   []handlers.AccessPoint{{SSID: "home", Strength: 80}},
+		},
+		{
+			name: "battery history",
+			call: func(c *client.Client) (any, error) {
+				return c.BatteryHistory(context.Background(), since, 10*time.Minute)
+			},
+			response: `{}`,
+			want:     request{method: http.MethodGet, path: "/api/battery/history", query: "since=2026-10-18T08%3A00%3A00Z&step=10m0s"},
+			result:   handlers.BatteryHistoryResponse{},
+		},
+		{
+			name: "vpn up",
+			call: func(c *client.Client) (any, error) {
+				return nil, c.VPNUp(context.Background(), "corp")
+			},
+			response: `{"status":"success"}`,
+			want:     request{method: http.MethodPost, path: "/api/network/vpn/up", contentType: "application/json", body: `{"connection":"corp"}`},
+		},
+		{
+			name: "atomic audio actions",
+			call: func(c *client.Client) (any, error) {
+				return c.AudioActions(context.Background(), []handlers.VolumeAction{{Device: "hdmi", Adjust: handlers.AbsoluteVolume(20)}}, true)
+			},
+			response: `{"status":"success","results":[{"index":0,"device":"hdmi","type":"sink","applied":true}]}`,
+			want:     request{method: http.MethodPost, path: "/api/audio/actions", query: "atomic=true", contentType: "application/json", body: `[{"device":"hdmi","adjust":20,"default":false,"type":""}]`},
+			result:   handlers.ActionsResponse{Status: handlers.ActionsStatusSuccess, Results: []handlers.ActionResult{{Device: "hdmi", Type: "sink", Applied: true}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			address, requests := serveJSON(t, http.StatusOK, test.response)
+			c, err := client.New(address+"/api/", client.WithToken("b71d55a2c4"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := test.call(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			test.want.authorization = "Bearer b71d55a2c4"
+			if got := <-requests; got != test.want {
+				t.Errorf("got request %+v, want %+v", got, test.want)
+			}
+			if test.result != nil && !reflect.DeepEqual(result, test.result) {
+				t.Errorf("got result %+v, want %+v", result, test.result)
+			}
+		})
+	}
+}
+
+func TestClientError(t *testing.T) {
+	t.Parallel()
+
+	address, _ := serveJSON(t, http.StatusForbidden, "Forbidden\n")
+	c, err := client.New(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var apiErr *client.Error
+	if _, err := c.Battery(context.Background()); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden || apiErr.Message != "Forbidden" {
+		t.Errorf("got error %v, want 403 Forbidden", err)
+	}
+
+	// Failed action batches still return the results of every action.
+	address, _ = serveJSON(t, http.StatusBadRequest, `{"status":"failed","error":"unknown device","results":[{"index":0,"device":"tv","applied":false,"error":"unknown device"}]}`)
+	c, err = client.New(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := c.AudioActions(context.Background(), []handlers.VolumeAction{{Device: "tv"}}, false)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "failed: unknown device" {
+		t.Errorf("got error %v, want 400 with the batch error", err)
+	}
+	if len(response.Results) != 1 || response.Results[0].Error != "unknown device" {
+		t.Errorf("got results %+v, want the failed action", response.Results)
+	}
+}
+
+func TestClientUnixSocket(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "deviceapi.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(handlers.Battery{Percentage: 81, State: r.URL.Path})
+	}))
+	server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+
+	c, err := client.New("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	battery, err := c.Battery(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if battery.Percentage != 81 || battery.State != "/battery" {
+		t.Errorf("got battery %+v, want 81%% from /battery", battery)
+	}
+}
+
+func TestClientEvents(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "types=battery%2Cnetwork" || r.Header.Get("Accept") != "text/event-stream" {
+			t.Errorf("got query %q accepting %q", r.URL.RawQuery, r.Header.Get("Accept"))
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, ": connected\n\nid: 1\nevent: battery\ndata: {\"percentage\":81}\n\nid: 2\nevent: network\ndata: [\ndata: ]\n\n")
+	}))
+	t.Cleanup(server.Close)
+
+	c, err := client.New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := c.Events(context.Background(), handlers.EventBattery, handlers.EventNetwork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	for _, want := range []handlers.Event{
+		{ID: 1, Type: handlers.EventBattery, Data: json.RawMessage(`{"percentage":81}`)},
+		{ID: 2, Type: handlers.EventNetwork, Data: json.RawMessage("[\n]")},
+	} {
+		event, err := stream.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.ID != want.ID || event.Type != want.Type || string(event.Data) != string(want.Data) {
+			t.Errorf("got event %d %s %s, want %d %s %s", event.ID, event.Type, event.Data, want.ID, want.Type, want.Data)
+		}
+	}
+	if _, err := stream.Next(); err != io.EOF {
+		t.Errorf("got error %v at the end of the stream, want io.EOF", err)
+	}
+}
@@ -0,0 +1,88 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/giftpilz0/sysutil/handlers"
+)
+
+// EventStream reads device state changes from GET /events.
+type EventStream struct {
+	body    io.ReadCloser
+	scanner *bufio.Scanner
+}
+
+// Events opens the Server-Sent Events stream, optionally limited to some event types.
+// The stream starts with the current state of every type.
+func (c *Client) Events(ctx context.Context, types ...string) (*EventStream, error) {
+	query := url.Values{}
+	if len(types) > 0 {
+		query.Set("types", strings.Join(types, ","))
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, "/events", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventStream{body: resp.Body, scanner: bufio.NewScanner(resp.Body)}, nil
+}
+
+// Next blocks until the next event arrives. It returns io.EOF when the server ends the stream.
+func (s *EventStream) Next() (handlers.Event, error) {
+	var event handlers.Event
+	var data strings.Builder
+
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		if line == "" {
+			if data.Len() == 0 {
+				continue
+			}
+			event.Data = json.RawMessage(data.String())
+			return event, nil
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return event, fmt.Errorf("invalid event id %q: %w", value, err)
+			}
+			event.ID = id
+		case "event":
+			event.Type = value
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		}
+	}
+
+	if err := s.scanner.Err(); err != nil {
+		return event, err
+	}
+	return event, io.EOF
+}
+
+// Close ends the stream.
+func (s *EventStream) Close() error {
+	return s.body.Close()
+}
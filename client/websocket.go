@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/giftpilz0/sysutil/handlers"
+	"github.com/giftpilz0/sysutil/internal/websocket"
+)
+
+// WebSocket is a connection to the /ws control channel.
+type WebSocket struct {
+	conn *websocket.Conn
+}
+
+// WebSocket opens the /ws control channel, optionally limiting the pushed events to some types.
+func (c *Client) WebSocket(ctx context.Context, types ...string) (*WebSocket, error) {
+	netConn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	if len(types) > 0 {
+		query.Set("types", strings.Join(types, ","))
+	}
+	path := strings.TrimSuffix(c.baseURL.Path, "/") + "/ws"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	header := http.Header{}
+	if c.token != "" {
+		header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	conn, err := websocket.NewClient(netConn, c.baseURL.Host, path, header)
+	if err != nil {
+		netConn.Close()
+		if handshakeErr, ok := err.(*websocket.HandshakeError); ok {
+			return nil, &Error{StatusCode: handshakeErr.StatusCode, Message: handshakeErr.Message}
+		}
+		return nil, err
+	}
+
+	return &WebSocket{conn: conn}, nil
+}
+
+// Send sends a request; its reply arrives through Receive with the same ID.
+func (ws *WebSocket) Send(request handlers.WSRequest) error {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return ws.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// Receive blocks until the next reply or event arrives.
+func (ws *WebSocket) Receive() (handlers.WSResponse, error) {
+	for {
+		messageType, message, err := ws.conn.ReadMessage()
+		if err != nil {
+			return handlers.WSResponse{}, err
+		}
+		if messageType != websocket.TextMessage {
+			continue
+		}
+
+		var response handlers.WSResponse
+		if err := json.Unmarshal(message, &response); err != nil {
+			return handlers.WSResponse{}, fmt.Errorf("failed to decode message: %w", err)
+		}
+		return response, nil
+	}
+}
+
+// Close closes the connection.
+func (ws *WebSocket) Close() error {
+	return ws.conn.Close(websocket.CloseNormal, "")
+}
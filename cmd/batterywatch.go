@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/giftpilz0/sysutil/handlers"
+	"github.com/godbus/dbus/v5"
+	"github.com/spf13/cobra"
+)
+
+const (
+	notificationsService = "org.freedesktop.Notifications"
+	notificationsPath    = "/org/freedesktop/Notifications"
+
+	// Notification urgencies of the notification specification.
+	urgencyNormal   byte = 1
+	urgencyCritical byte = 2
+
+	// batterywatchRecheck re-reads the battery in case a signal was missed.
+	batterywatchRecheck = time.Minute
+
+	// batterywatchRetryDelay is how long to wait before subscribing again after a failure.
+	batterywatchRetryDelay = 5 * time.Second
+)
+
+var (
+	lowThresholds     []int
+	criticalThreshold int
+	notifyPower       bool
+	notifyFull        bool
+	batteryHooks      []string
+)
+
+func init() {
+	rootCmd.AddCommand(batterywatchCmd)
+	batterywatchCmd.Flags().IntSliceVar(&lowThresholds, "low", []int{20, 10}, "Percentages at which to warn about a low battery while discharging")
+	batterywatchCmd.Flags().IntVar(&criticalThreshold, "critical", 5, "Percentage at which to send a critical warning")
+	batterywatchCmd.Flags().BoolVar(&notifyPower, "notify-power", true, "Notify when the charger is plugged or unplugged")
+	batterywatchCmd.Flags().BoolVar(&notifyFull, "notify-full", true, "Notify when the battery is fully charged")
+	batterywatchCmd.Flags().StringArrayVar(&batteryHooks, "hook", nil, "PERCENT:COMMAND run with sh -c once the battery drops to PERCENT while discharging, e.g. \"3:systemctl suspend\" (repeatable)")
+}
+
+var batterywatchCmd = &cobra.Command{
+	Use:   "batterywatch",
+	Short: "Send desktop notifications on low battery, charger changes and full charge",
+	Args:  cobra.MaximumNArgs(0),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		hooks, err := parseBatteryHooks(batteryHooks)
+		if err != nil {
+			log.Fatalf("Invalid hook: %v", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		// The critical level is warned about too, as the last threshold.
+		low := append([]int{criticalThreshold}, lowThresholds...)
+		slices.Sort(low)
+		watcher := &batteryWatcher{
+			low:         slices.Compact(low),
+			critical:    criticalThreshold,
+			hooks:       hooks,
+			notifyPower: notifyPower,
+			notifyFull:  notifyFull,
+			notify:      sendNotification,
+			runHook:     runBatteryHook,
+		}
+
+		// Coalesce the PropertiesChanged bursts UPower sends for a single change.
+		changes := make(chan struct{}, 1)
+		power := handlers.NewSystemPowerBackend(nil)
+		go func() {
+			for {
+				err := power.Subscribe(ctx, func() {
+					select {
+					case changes <- struct{}{}:
+					default:
+					}
+				})
+				if ctx.Err() != nil {
+					return
+				}
+				log.Printf("UPower watcher stopped: %v, restarting in %s", err, batterywatchRetryDelay)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(batterywatchRetryDelay):
+				}
+			}
+		}()
+
+		recheck := time.NewTicker(batterywatchRecheck)
+		defer recheck.Stop()
+		for {
+			battery, err := power.Battery()
+			if err != nil {
+				log.Printf("Failed to read battery: %v", err)
+			} else {
+				watcher.check(battery)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-changes:
+			case <-recheck.C:
+			}
+		}
+	},
+}
+
+// batteryHook is a command run once the battery drops to a percentage.
+type batteryHook struct {
+	percent int
+	command string
+}
+
+// parseBatteryHooks parses --hook values of the form PERCENT:COMMAND.
+func parseBatteryHooks(values []string) ([]batteryHook, error) {
+	hooks := make([]batteryHook, 0, len(values))
+	for _, value := range values {
+		percent, command, ok := strings.Cut(value, ":")
+		threshold, err := strconv.Atoi(strings.TrimSpace(percent))
+		if !ok || err != nil || strings.TrimSpace(command) == "" {
+			return nil, fmt.Errorf("%q, expected PERCENT:COMMAND", value)
+		}
+		hooks = append(hooks, batteryHook{percent: threshold, command: command})
+	}
+	return hooks, nil
+}
+
+// batteryWatcher compares successive battery states and notifies about the
+// changes worth telling the user.
+type batteryWatcher struct {
+	low         []int // ascending
+	critical    int
+	hooks       []batteryHook
+	notifyPower bool
+	notifyFull  bool
+	notify      func(summary, body string, urgency byte)
+	runHook     func(hook batteryHook, battery handlers.Battery)
+
+	seen        bool
+	state       string
+	online      bool
+	lowNotified int // lowest threshold notified since the last charge, 0 if none
+	hooksRun    map[int]bool
+}
+
+// check handles a new battery state.
+func (w *batteryWatcher) check(battery handlers.Battery) {
+	if battery.State == "" {
+		// No battery present.
+		return
+	}
+
+	online, hasLinePower := false, false
+	for _, device := range battery.Devices {
+		if device.Type == "line-power" {
+			hasLinePower = true
+			online = online || device.Online
+		}
+	}
+	if !hasLinePower {
+		online = battery.State != "Discharging"
+	}
+	discharging := battery.State == "Discharging"
+
+	if w.seen {
+		if w.notifyPower && online != w.online {
+			if online {
+				w.notify("Charger connected", batteryDetails(battery), urgencyNormal)
+			} else {
+				w.notify("Charger disconnected", batteryDetails(battery), urgencyNormal)
+			}
+		}
+		if w.notifyFull && battery.State == "Fully charged" && w.state != "Fully charged" {
+			w.notify("Battery fully charged", batteryDetails(battery), urgencyNormal)
+		}
+	}
+
+	if !discharging {
+		// Warn again during the next discharge.
+		w.lowNotified = 0
+		w.hooksRun = nil
+	} else {
+		// Only the lowest threshold reached is notified, once.
+		for _, threshold := range w.low {
+			if battery.Percentage > float64(threshold) {
+				continue
+			}
+			if w.lowNotified == 0 || threshold < w.lowNotified {
+				urgency := urgencyNormal
+				if battery.Percentage <= float64(w.critical) {
+					urgency = urgencyCritical
+				}
+				w.notify("Battery low", batteryDetails(battery), urgency)
+				w.lowNotified = threshold
+			}
+			break
+		}
+
+		for _, hook := range w.hooks {
+			if battery.Percentage <= float64(hook.percent) && !w.hooksRun[hook.percent] {
+				if w.hooksRun == nil {
+					w.hooksRun = make(map[int]bool)
+				}
+				w.hooksRun[hook.percent] = true
+				w.runHook(hook, battery)
+			}
+		}
+	}
+
+	w.seen = true
+	w.state = battery.State
+	w.online = online
+}
+
+// batteryDetails describes the charge and remaining time of a battery.
+func batteryDetails(battery handlers.Battery) string {
+	details := fmt.Sprintf("%.0f%%", battery.Percentage)
+	if battery.Display == nil {
+		return details
+	}
+	switch {
+	case battery.Display.TimeToEmpty > 0:
+		details += ", " + formatRemaining(battery.Display.TimeToEmpty) + " remaining"
+	case battery.Display.TimeToFull > 0:
+		details += ", " + formatRemaining(battery.Display.TimeToFull) + " until full"
+	}
+	return details
+}
+
+// formatRemaining formats seconds as "2h 13m".
+func formatRemaining(seconds int64) string {
+	d := time.Duration(seconds) * time.Second
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// runBatteryHook starts a hook command, passing the battery state in the environment.
+// It does not wait for the command, so a long-running hook does not hold up the
+// next battery checks.
+func runBatteryHook(hook batteryHook, battery handlers.Battery) {
+	cmd := exec.Command("sh", "-c", hook.command)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("BATTERY_PERCENTAGE=%.0f", battery.Percentage),
+		"BATTERY_STATE="+battery.State,
+		fmt.Sprintf("BATTERY_THRESHOLD=%d", hook.percent),
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	log.Printf("Battery at %.0f%%, running hook: %s", battery.Percentage, hook.command)
+	if err := cmd.Start(); err != nil {
+		log.Printf("Battery hook %q failed: %v", hook.command, err)
+		return
+	}
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("Battery hook %q failed: %v", hook.command, err)
+		}
+	}()
+}
+
+// lastNotification is the id of the previous notification, replaced by the next
+// one so that notifications do not pile up.
+var lastNotification uint32
+
+// sendNotification shows a desktop notification through org.freedesktop.Notifications.
+func sendNotification(summary, body string, urgency byte) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		log.Printf("Failed to connect to session DBus: %v", err)
+		return
+	}
+
+	icon := "battery"
+	if urgency == urgencyCritical {
+		icon = "battery-caution"
+	}
+	hints := map[string]dbus.Variant{"urgency": dbus.MakeVariant(urgency)}
+	call := conn.Object(notificationsService, notificationsPath).Call(notificationsService+".Notify", 0,
+		"sysutil", lastNotification, icon, summary, body, []string{}, hints, int32(-1))
+	if err := call.Store(&lastNotification); err != nil {
+		log.Printf("Failed to send notification %q: %v", summary, err)
+	}
+}
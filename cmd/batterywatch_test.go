@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/giftpilz0/sysutil/handlers"
+)
+
+// notification is a notification sent by a batteryWatcher.
+type notification struct {
+	summary string
+	urgency byte
+}
+
+// reading returns the battery state UPower reports for a laptop with a charger.
+func reading(state string, percentage float64, online bool) handlers.Battery {
+	return handlers.Battery{
+		State:      state,
+		Percentage: percentage,
+		Devices: []handlers.PowerDevice{
+			{Type: "line-power", Online: online},
+			{Type: "battery", Present: true, Percentage: percentage},
+		},
+	}
+}
+
+func TestBatteryWatcherCheck(t *testing.T) {
+	discharging := func(percentage float64) handlers.Battery { return reading("Discharging", percentage, false) }
+	charging := func(percentage float64) handlers.Battery { return reading("Charging", percentage, true) }
+	low := notification{"Battery low", urgencyNormal}
+	critical := notification{"Battery low", urgencyCritical}
+	connected := notification{"Charger connected", urgencyNormal}
+	disconnected := notification{"Charger disconnected", urgencyNormal}
+	full := notification{"Battery fully charged", urgencyNormal}
+
+	tests := []struct {
+		name          string
+		hooks         []batteryHook
+		quiet         bool // without --notify-power and --notify-full
+		readings      []handlers.Battery
+		notifications []notification
+		hooksRun      []string
+	}{
+		{
+			name:          "each threshold once",
+			readings:      []handlers.Battery{discharging(25), discharging(20), discharging(18), discharging(10), discharging(9), discharging(5), discharging(4)},
+			notifications: []notification{low, low, critical},
+		},
+		{
+			name:          "lowest threshold reached",
+			readings:      []handlers.Battery{discharging(30), discharging(8), discharging(7)},
+			notifications: []notification{low},
+		},
+		{
+			name:          "critical on the first reading",
+			readings:      []handlers.Battery{discharging(3)},
+			notifications: []notification{critical},
+		},
+		{
+			name:          "charger",
+			readings:      []handlers.Battery{charging(50), charging(51), discharging(51), charging(50)},
+			notifications: []notification{disconnected, connected},
+		},
+		{
+			name:          "warn again after charging",
+			readings:      []handlers.Battery{discharging(20), charging(21), discharging(20), discharging(19)},
+			notifications: []notification{low, connected, disconnected, low},
+		},
+		{
+			name:          "fully charged",
+			readings:      []handlers.Battery{charging(99), reading("Fully charged", 100, true), reading("Fully charged", 100, true)},
+			notifications: []notification{full},
+		},
+		{
+			name:          "quiet",
+			quiet:         true,
+			readings:      []handlers.Battery{discharging(50), charging(50), reading("Fully charged", 100, true), discharging(20)},
+			notifications: []notification{low},
+		},
+		{
+			name:     "no battery",
+			readings: []handlers.Battery{{}, {}},
+		},
+		{
+			name:          "hooks",
+			hooks:         []batteryHook{{percent: 10, command: "notify"}, {percent: 3, command: "suspend"}},
+			readings:      []handlers.Battery{discharging(11), discharging(10), discharging(9), discharging(3), charging(4), discharging(3)},
+			notifications: []notification{low, low, critical, connected, disconnected, critical},
+			hooksRun:      []string{"notify 10", "suspend 3", "notify 3", "suspend 3"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var notifications []notification
+			var hooksRun []string
+			w := &batteryWatcher{
+				low:         []int{5, 10, 20},
+				critical:    5,
+				hooks:       test.hooks,
+				notifyPower: !test.quiet,
+				notifyFull:  !test.quiet,
+				notify: func(summary, body string, urgency byte) {
+					notifications = append(notifications, notification{summary, urgency})
+				},
+				runHook: func(hook batteryHook, battery handlers.Battery) {
+					hooksRun = append(hooksRun, fmt.Sprintf("%s %.0f", hook.command, battery.Percentage))
+				},
+			}
+			for _, battery := range test.readings {
+				w.check(battery)
+			}
+
+			if !slices.Equal(notifications, test.notifications) {
+				t.Errorf("got notifications %v, want %v", notifications, test.notifications)
+			}
+			if !slices.Equal(hooksRun, test.hooksRun) {
+				t.Errorf("got hooks %q, want %q", hooksRun, test.hooksRun)
+			}
+		})
+	}
+}
+
+func TestParseBatteryHooks(t *testing.T) {
+	hooks, err := parseBatteryHooks([]string{"3:systemctl suspend", " 10 :notify-send 'low: 10%'"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []batteryHook{{percent: 3, command: "systemctl suspend"}, {percent: 10, command: "notify-send 'low: 10%'"}}
+	if !slices.Equal(hooks, want) {
+		t.Errorf("got hooks %+v, want %+v", hooks, want)
+	}
+
+	for _, value := range []string{"systemctl suspend", "low:systemctl suspend", "3:", "3: "} {
+		if _, err := parseBatteryHooks([]string{value}); err == nil {
+			t.Errorf("got no error parsing %q", value)
+		}
+	}
+}
+
+func TestRunBatteryHook(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "hook")
+	hook := batteryHook{percent: 5, command: `sleep 1; echo "$BATTERY_PERCENTAGE $BATTERY_STATE $BATTERY_THRESHOLD" > ` + out}
+
+	start := time.Now()
+	runBatteryHook(hook, reading("Discharging", 4, false))
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("runBatteryHook returned after %s, want it not to wait for the hook", elapsed)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, err := os.ReadFile(out)
+		if err == nil && len(data) > 0 {
+			if got := strings.TrimSpace(string(data)); got != "4 Discharging 5" {
+				t.Errorf("got environment %q, want \"4 Discharging 5\"", got)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("hook did not run")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
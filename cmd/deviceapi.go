@@ -1,15 +1,52 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/giftpilz0/sysutil/handlers"
 	"github.com/spf13/cobra"
 )
 
+const (
+	// shutdownTimeout bounds how long in-flight requests may take after SIGTERM.
+	shutdownTimeout = 5 * time.Second
+)
+
+var (
+	listenAddress  string
+	tokenFile      string
+	peerUIDs       []uint
+	anonymousScope string
+	wsOrigins      []string
+	maxVolume      int
+	audioBackend   string
+
+	batteryHistoryFile      string
+	batteryHistoryInterval  time.Duration
+	batteryHistoryRetention time.Duration
+)
+
 func init() {
 	rootCmd.AddCommand(deviceapiCmd)
+	deviceapiCmd.Flags().StringVarP(&listenAddress, "listen", "l", "127.0.0.1:8080", "Address to listen on, host:port or unix:/path/to/socket (ignored when socket activated by systemd)")
+	deviceapiCmd.Flags().StringVarP(&tokenFile, "token-file", "t", "", "File with bearer tokens, one \"<token> [read|write]\" per line")
+	deviceapiCmd.Flags().UintSliceVar(&peerUIDs, "peer-uid", []uint{uint(os.Getuid())}, "Users granted write access over a unix socket")
+	deviceapiCmd.Flags().StringSliceVar(&wsOrigins, "ws-origin", nil, "Additional browser origins allowed to open /ws, e.g. http://localhost:3000")
+	deviceapiCmd.Flags().IntVar(&maxVolume, "max-volume", 150, "Highest volume in percent for audio actions with allowAbove100")
+	deviceapiCmd.Flags().StringVar(&audioBackend, "audio-backend", handlers.AudioBackendAuto, "Audio backend: native (PulseAudio protocol), pactl, or auto for native when its socket is reachable")
+	deviceapiCmd.Flags().StringVar(&batteryHistoryFile, "battery-history", "", "File to record battery samples in for /battery/history (disabled if empty)")
+	deviceapiCmd.Flags().DurationVar(&batteryHistoryInterval, "battery-history-interval", time.Minute, "Interval between recorded battery samples")
+	deviceapiCmd.Flags().DurationVar(&batteryHistoryRetention, "battery-history-retention", 7*24*time.Hour, "How long recorded battery samples are kept")
+	deviceapiCmd.Flags().StringVar(&anonymousScope, "anonymous-scope", "", "Scope for TCP clients without a token: none, read or write (default read, or none if --token-file is set)")
 }
 
 var deviceapiCmd = &cobra.Command{
@@ -18,16 +55,108 @@ var deviceapiCmd = &cobra.Command{
 	Args:  cobra.MaximumNArgs(0),
 	Run: func(cmd *cobra.Command, args []string) {
 
-		// Register HTTP handlers.
-		http.HandleFunc("/network", handlers.NetworkHandler)
-		http.HandleFunc("/battery", handlers.BatteryHandler)
-		http.HandleFunc("/audio/outputs", handlers.AudioOutputsHandler)
-		http.HandleFunc("/audio/inputs", handlers.AudioInputsHandler)
-		http.HandleFunc("/audio/actions", handlers.AudioActionsHandler)
+		auth, err := newDeviceapiAuth()
+		if err != nil {
+			log.Fatalf("Failed to configure authentication: %v", err)
+		}
+
+		backend, err := handlers.NewAudioBackend(audioBackend)
+		if err != nil {
+			log.Fatalf("Failed to configure audio backend: %v", err)
+		}
+
+		var batteryHistory *handlers.BatteryHistory
+		if batteryHistoryFile != "" {
+			batteryHistory, err = handlers.OpenBatteryHistory(batteryHistoryFile, batteryHistoryRetention)
+			if err != nil {
+				log.Fatalf("Failed to open battery history: %v", err)
+			}
+		}
+		deviceServer := handlers.NewServer(
+			handlers.Backends{Audio: backend, History: batteryHistory},
+			handlers.WithVolumeCeiling(maxVolume),
+			handlers.WithWebSocketOrigins(wsOrigins...),
+		)
 
-		log.Println("HTTP server listening on :8080")
-		if err := http.ListenAndServe(":8080", nil); err != nil {
+		// Register HTTP handlers, each guarded by the scope it requires.
+		mux := http.NewServeMux()
+		for _, route := range deviceServer.Routes() {
+			mux.Handle(route.Path, auth.Require(route.Scope, route.Handler))
+		}
+
+		listeners, err := deviceapiListeners(listenAddress)
+		if err != nil {
 			log.Fatalf("Failed to start server: %v", err)
 		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		// Request contexts derive from ctx so event streams end on shutdown.
+		server := &http.Server{
+			Handler:     mux,
+			ConnContext: handlers.ConnContext,
+			BaseContext: func(net.Listener) context.Context { return ctx },
+		}
+
+		go deviceServer.WatchDeviceEvents(ctx)
+		if batteryHistory != nil {
+			go batteryHistory.Record(ctx, deviceServer.Power, batteryHistoryInterval)
+		}
+
+		// Shut down gracefully once a termination signal arrives.
+		shutdownDone := make(chan struct{})
+		go func() {
+			defer close(shutdownDone)
+			<-ctx.Done()
+
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Failed to shut down server gracefully: %v", err)
+			}
+		}()
+
+		var wg sync.WaitGroup
+		for _, listener := range listeners {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				log.Printf("HTTP server listening on %s", listener.Addr())
+				if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					log.Fatalf("Failed to start server: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		<-shutdownDone
+		log.Println("HTTP server stopped")
 	},
 }
+
+// newDeviceapiAuth builds the authentication layer from the command line flags.
+func newDeviceapiAuth() (*handlers.Auth, error) {
+	anonymous := handlers.ScopeRead
+	if tokenFile != "" {
+		anonymous = handlers.ScopeNone
+	}
+	if anonymousScope != "" {
+		scope, err := handlers.ParseScope(anonymousScope)
+		if err != nil {
+			return nil, err
+		}
+		anonymous = scope
+	}
+
+	uids := make([]uint32, 0, len(peerUIDs))
+	for _, uid := range peerUIDs {
+		uids = append(uids, uint32(uid))
+	}
+
+	return handlers.NewAuth(handlers.AuthConfig{
+		TokenFile: tokenFile,
+		PeerUIDs:  uids,
+		Anonymous: anonymous,
+	})
+}
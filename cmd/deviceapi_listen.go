@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// unixListenPrefix marks a --listen value as a unix socket path.
+	unixListenPrefix = "unix:"
+
+	// systemd passes activated sockets starting at this file descriptor.
+	systemdListenFdsStart = 3
+)
+
+// deviceapiListeners returns the listeners the deviceapi server should serve on.
+// Sockets passed by systemd socket activation take precedence over the address.
+func deviceapiListeners(addr string) ([]net.Listener, error) {
+	listeners, err := systemdListeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(listeners) > 0 {
+		return listeners, nil
+	}
+
+	if path, ok := strings.CutPrefix(addr, unixListenPrefix); ok {
+		listener, err := listenUnix(path)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{listener}, nil
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on %s: %w", addr, err)
+	}
+	return []net.Listener{listener}, nil
+}
+
+// listenUnix listens on a unix socket only accessible by the current user,
+// replacing a stale socket left behind by a previous run.
+func listenUnix(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, fmt.Errorf("empty unix socket path")
+	}
+
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("could not remove stale socket %s: %w", path, err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on %s: %w", path, err)
+	}
+
+	if err := os.Chmod(path, 0o600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("could not set permissions on %s: %w", path, err)
+	}
+
+	return listener, nil
+}
+
+// systemdListeners returns the sockets passed through systemd socket activation
+// (LISTEN_PID/LISTEN_FDS), or nil if the process was not socket activated.
+func systemdListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// Do not pass the sockets on to child processes.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, count)
+	for i := range count {
+		name := "LISTEN_FD_" + strconv.Itoa(systemdListenFdsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		file := os.NewFile(uintptr(systemdListenFdsStart+i), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("could not use systemd socket %s: %w", name, err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/giftpilz0/sysutil/handlers"
+)
+
+func TestDeviceapiAnonymousScope(t *testing.T) {
+	tokens := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(tokens, []byte("b71d55a2c4 write\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name      string
+		tokenFile string
+		anonymous string
+		read      int // status of an anonymous TCP request to a read route
+		write     int // status of an anonymous TCP request to a write route
+	}{
+		{"default", "", "", http.StatusOK, http.StatusForbidden},
+		{"token file", tokens, "", http.StatusUnauthorized, http.StatusUnauthorized},
+		{"write", "", "write", http.StatusOK, http.StatusOK},
+		{"none", "", "none", http.StatusUnauthorized, http.StatusUnauthorized},
+		{"read with a token file", tokens, "read", http.StatusOK, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tokenFile, anonymousScope = test.tokenFile, test.anonymous
+			t.Cleanup(func() { tokenFile, anonymousScope = "", "" })
+
+			auth, err := newDeviceapiAuth()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for scope, want := range map[handlers.Scope]int{handlers.ScopeRead: test.read, handlers.ScopeWrite: test.write} {
+				recorder := httptest.NewRecorder()
+				auth.Require(scope, ok).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+				if recorder.Code != want {
+					t.Errorf("got status %d on a %s route, want %d", recorder.Code, scope, want)
+				}
+			}
+		})
+	}
+
+	anonymousScope = "admin"
+	t.Cleanup(func() { anonymousScope = "" })
+	if _, err := newDeviceapiAuth(); err == nil {
+		t.Error("got no error for an unknown --anonymous-scope")
+	}
+}
@@ -3,193 +3,258 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
-	"os/exec"
-	"strconv"
-	"strings"
-)
-
-const (
-	pactlCmd = "pactl"
 )
 
 // AudioInfo represents aggregated information for an audio device,
 // whether it’s an output (sink) or an input (source) device.
 type AudioInfo struct {
-	Name        string `json:"name"`
-	Volume      int    `json:"volume"` // e.g. "100%"
-	Mute        bool   `json:"mute"`
-	Default     bool   `json:"default,omitempty"`
-	Description string `json:"description"`
-	Nickname    string `json:"nickname"`
-}
-
-// RawVolumeChannel represents an individual channel's volume details from pactl.
-type RawVolumeChannel struct {
-	DB           string `json:"db"`
-	Value        int64  `json:"value"`
-	ValuePercent string `json:"value_percent"`
-}
-
-// RawVolumeChannel represents an individual channel's volume details from pactl.
-type RawDeviceProperties struct {
-	Nickname string `json:"device.nick"`
+	Index       uint32          `json:"index"`
+	Name        string          `json:"name"`
+	Volume      int             `json:"volume"` // e.g. "100%"
+	Mute        bool            `json:"mute"`
+	Default     bool            `json:"default,omitempty"`
+	Description string          `json:"description"`
+	Nickname    string          `json:"nickname"`
+	Channels    []ChannelVolume `json:"channels"`
+	Balance     float64         `json:"balance"` // -1 (left) to 1 (right)
+	ActivePort  string          `json:"activePort,omitempty"`
+	Ports       []AudioPort     `json:"ports,omitempty"`
 }
 
-// rawDevice is a common structure for unmarshaling JSON output for both sinks and sources.
-type rawDevice struct {
-	Name        string                      `json:"name"`
-	Volume      map[string]RawVolumeChannel `json:"volume"`
-	Properties  RawDeviceProperties         `json:"properties"`
-	Mute        bool                        `json:"mute"`
-	Description string                      `json:"description"`
+// ChannelVolume is the volume of a single channel of an audio device, in channel map order.
+type ChannelVolume struct {
+	Channel string `json:"channel"` // e.g. "front-left"
+	Percent int    `json:"percent"`
+	DB      string `json:"db"`
+	Value   int64  `json:"value"` // raw volume, 65536 is 100%
 }
 
 // VolumeAction defines an action for adjusting volume and mute settings,
 // and optionally setting the default device for either input (source) or output (sink).
+// Volume and mute are left untouched when Adjust or Muted are omitted.
 type VolumeAction struct {
-	Device  string `json:"device"`  // if empty, a default device will be chosen based on Type
-	Adjust  int    `json:"adjust"`  // volume as an int (0 to 100)
-	Muted   bool   `json:"muted"`   // true to mute
-	Default bool   `json:"default"` // if true, set device as the default
-	Type    string `json:"type"`    // "sink" or "source"; defaults to "sink" if empty
+	Device        string         `json:"device"`                  // if empty, a default device will be chosen based on Type
+	Adjust        *VolumeValue   `json:"adjust,omitempty"`        // absolute volume (50) or relative change ("+5", "-5")
+	Muted         *MuteValue     `json:"muted,omitempty"`         // true to mute, false to unmute or "toggle"
+	Default       bool           `json:"default"`                 // if true, set device as the default
+	Type          string         `json:"type"`                    // "sink" or "source"; defaults to "sink" if empty
+	AllowAbove100 bool           `json:"allowAbove100,omitempty"` // allow volumes above 100% up to the configured ceiling
+	Channels      map[string]int `json:"channels,omitempty"`      // volume in percent per channel, e.g. {"front-left": 80}
+	Balance       *float64       `json:"balance,omitempty"`       // -1 (left) to 1 (right), applied after Adjust and Channels
+	Port          string         `json:"port,omitempty"`          // port to switch to, applied first, e.g. "analog-output-headphones"
 }
 
-// aggregateVolume calculates an aggregated volume percentage from multiple channels.
-func aggregateVolume(volume map[string]RawVolumeChannel) int {
-	total := 0
-	count := 0
-	for _, channel := range volume {
-		percentStr := strings.TrimSuffix(channel.ValuePercent, "%")
-		if val, err := strconv.Atoi(percentStr); err == nil {
-			total += val
-			count++
-		}
-	}
-	if count == 0 {
-		return 0
-	}
-	avg := total / count
-	return avg
+// GetVolumeInfo retrieves output devices (sinks) with aggregated volume.
+func (s *Server) GetVolumeInfo() ([]AudioInfo, error) {
+	return s.Audio.Devices("sink")
 }
 
-// getAudioInfo retrieves audio devices info from pactl (sinks or sources)
-// and marks the default device based on pactl get-default-sink/source.
-func getAudioInfo(deviceType string) ([]AudioInfo, error) {
-	cmd := exec.Command(pactlCmd, "--format", "json", "list", deviceType)
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("error executing pactl for %s: %w", deviceType, err)
-	}
+// GetInputInfo retrieves input devices (sources) with aggregated volume.
+func (s *Server) GetInputInfo() ([]AudioInfo, error) {
+	return s.Audio.Devices("source")
+}
 
-	var devices []rawDevice
-	if err := json.Unmarshal(output, &devices); err != nil {
-		return nil, fmt.Errorf("error parsing pactl %s JSON: %w", deviceType, err)
+// ProcessAudioActions processes a JSON input that specifies volume/mute adjustments,
+// and optionally sets the default audio device for both inputs and outputs.
+// It returns one result per action. In atomic mode the first failure rolls back
+// every action applied before it. The error is only set, wrapping
+// ErrInvalidActions, when the input cannot be parsed or validated, in which
+// case nothing has been applied.
+func (s *Server) ProcessAudioActions(actionsJSON []byte, atomic bool) ([]ActionResult, error) {
+	var actions []VolumeAction
+	if err := json.Unmarshal(actionsJSON, &actions); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidActions, err)
 	}
 
-	audioInfos := make([]AudioInfo, 0, len(devices))
-	for _, dev := range devices {
-		audioInfos = append(audioInfos, AudioInfo{
-			Name:        dev.Name,
-			Volume:      aggregateVolume(dev.Volume),
-			Mute:        dev.Mute,
-			Description: dev.Description,
-			Nickname:    dev.Properties.Nickname,
-		})
+	results := make([]ActionResult, len(actions))
+	invalid := 0
+	for i := range actions {
+		normalizeVolumeAction(&actions[i])
+		results[i] = ActionResult{Index: i, Device: actions[i].Device, Type: actions[i].Type}
+		if err := validateVolumeAction(actions[i]); err != nil {
+			results[i].Step = ActionStepValidate
+			results[i].Error = err.Error()
+			invalid++
+		}
 	}
-
-	// Determine the default device for sinks or sources.
-	var defArg string
-	if deviceType == "sinks" {
-		defArg = "get-default-sink"
-	} else if deviceType == "sources" {
-		defArg = "get-default-source"
+	if invalid > 0 {
+		return results, fmt.Errorf("%w: %d of %d actions failed validation", ErrInvalidActions, invalid, len(actions))
 	}
 
-	if defArg != "" {
-		cmdDef := exec.Command(pactlCmd, defArg)
-		defOutput, err := cmdDef.Output()
-		if err != nil {
-			return audioInfos, fmt.Errorf("error retrieving default device using %s: %w", defArg, err)
+	var applied []audioState
+	for i, action := range actions {
+		previous := audioState{index: i}
+		if atomic {
+			state, err := s.captureAudioState(action)
+			if err != nil {
+				results[i].Step = ActionStepCapture
+				results[i].Error = err.Error()
+				s.rollbackAudioActions(results, applied)
+				break
+			}
+			previous = state
+			previous.index = i
 		}
-		defaultName := strings.TrimSpace(string(defOutput))
-		for i := range audioInfos {
-			if audioInfos[i].Name == defaultName {
-				audioInfos[i].Default = true
+
+		if step, err := s.applyVolumeAction(action); err != nil {
+			results[i].Step = step
+			results[i].Error = err.Error()
+			if atomic {
+				// Undo the steps of this action that did succeed, then the earlier actions.
+				applied = append(applied, previous)
+				s.rollbackAudioActions(results, applied)
+				break
 			}
+			continue
 		}
+
+		results[i].Applied = true
+		applied = append(applied, previous)
 	}
 
-	return audioInfos, nil
+	return results, nil
 }
 
-// GetVolumeInfo retrieves output devices (sinks) with aggregated volume.
-func GetVolumeInfo() ([]AudioInfo, error) {
-	return getAudioInfo("sinks")
-}
+// normalizeVolumeAction fills in the defaults for the type and device of an action.
+func normalizeVolumeAction(action *VolumeAction) {
+	// Default the device type to "sink" if not provided.
+	if action.Type == "" {
+		action.Type = "sink"
+	}
 
-// GetInputInfo retrieves input devices (sources) with aggregated volume.
-func GetInputInfo() ([]AudioInfo, error) {
-	return getAudioInfo("sources")
+	// If no device is specified, use the default device for the type.
+	if action.Device == "" {
+		if action.Type == "source" {
+			action.Device = "@DEFAULT_SOURCE@"
+		} else {
+			action.Device = "@DEFAULT_SINK@"
+		}
+	}
 }
 
-// ProcessAudioActions processes a JSON input that specifies volume/mute adjustments,
-// and optionally sets the default audio device for both inputs and outputs.
-func ProcessAudioActions(actionsJSON []byte) error {
-	var actions []VolumeAction
-	if err := json.Unmarshal(actionsJSON, &actions); err != nil {
-		return fmt.Errorf("failed to unmarshal volume actions: %w", err)
+// validateVolumeAction checks a normalized action before anything is applied.
+func validateVolumeAction(action VolumeAction) error {
+	if action.Type != "sink" && action.Type != "source" {
+		return fmt.Errorf("invalid type %q, expected \"sink\" or \"source\"", action.Type)
 	}
-
-	for _, action := range actions {
-		// Default the device type to "sink" if not provided.
-		if action.Type == "" {
-			action.Type = "sink"
+	if action.Balance != nil && (*action.Balance < -1 || *action.Balance > 1) {
+		return fmt.Errorf("invalid balance %g, expected -1 to 1", *action.Balance)
+	}
+	for channel, percent := range action.Channels {
+		if percent < 0 {
+			return fmt.Errorf("invalid volume %d for channel %s", percent, channel)
 		}
+	}
+	return nil
+}
 
-		// If no device is specified, use the default device for the type.
-		if action.Device == "" {
-			if action.Type == "source" {
-				action.Device = "@DEFAULT_SOURCE@"
-			} else {
-				action.Device = "@DEFAULT_SINK@"
-			}
+// applyVolumeAction sets port, mute, volume and optionally the default device with
+// the audio backend. On failure it returns the step that failed.
+func (s *Server) applyVolumeAction(action VolumeAction) (string, error) {
+	// Switch the port first, as it may change the volume of the device.
+	if action.Port != "" {
+		if err := s.Audio.SetPort(action.Type, action.Device, action.Port); err != nil {
+			return ActionStepPort, fmt.Errorf("failed to set port %s for %s %s: %w", action.Port, action.Type, action.Device, err)
 		}
+	}
 
-		// Clamp the volume adjustment between 0 and 100.
-		if action.Adjust < 0 {
-			action.Adjust = 0
-		} else if action.Adjust > 100 {
-			action.Adjust = 100
+	if action.Muted != nil {
+		if err := s.Audio.SetMute(action.Type, action.Device, *action.Muted); err != nil {
+			return ActionStepMute, fmt.Errorf("failed to set mute for %s %s: %w", action.Type, action.Device, err)
 		}
+	}
 
-		// Set mute state using pactl.
-		muteVal := "0"
-		if action.Muted {
-			muteVal = "1"
+	if action.Adjust != nil {
+		volume, changed, err := volumeChange(*action.Adjust, s.volumeLimit(action.AllowAbove100), func() (int, error) {
+			return s.currentVolume(action.Type, action.Device)
+		})
+		if err != nil {
+			return ActionStepVolume, err
 		}
-		muteCmd := exec.Command("pactl", fmt.Sprintf("set-%s-mute", action.Type), action.Device, muteVal)
-		if err := muteCmd.Run(); err != nil {
-			fmt.Printf("ProcessAudioActions: failed to set mute for %s %s: %v\n", action.Type, action.Device, err)
-			continue
+		if changed {
+			if err := s.Audio.SetVolume(action.Type, action.Device, volume); err != nil {
+				return ActionStepVolume, fmt.Errorf("failed to set volume for %s %s: %w", action.Type, action.Device, err)
+			}
 		}
+	}
 
-		// Set volume using pactl.
-		volumeStr := strconv.Itoa(action.Adjust) + "%"
-		setVolumeCmd := exec.Command("pactl", fmt.Sprintf("set-%s-volume", action.Type), action.Device, volumeStr)
-		if err := setVolumeCmd.Run(); err != nil {
-			fmt.Printf("ProcessAudioActions: failed to set volume for %s %s: %v\n", action.Type, action.Device, err)
-			continue
+	// Set per-channel volumes and balance.
+	if len(action.Channels) > 0 || action.Balance != nil {
+		values, err := s.channelArguments(action)
+		if err != nil {
+			return ActionStepChannels, err
+		}
+		if err := s.setChannelVolumes(action.Type, action.Device, values); err != nil {
+			return ActionStepChannels, err
 		}
+	}
 
-		// If Default flag is set, update the default device using pactl.
-		if action.Default {
-			setDefaultCmd := exec.Command("pactl", fmt.Sprintf("set-default-%s", action.Type), action.Device)
-			if err := setDefaultCmd.Run(); err != nil {
-				fmt.Printf("ProcessAudioActions: failed to set default for %s %s: %v\n", action.Type, action.Device, err)
-				continue
-			}
+	if action.Default {
+		if err := s.Audio.SetDefault(action.Type, action.Device); err != nil {
+			return ActionStepDefault, fmt.Errorf("failed to set default for %s %s: %w", action.Type, action.Device, err)
 		}
 	}
 
-	return nil
+	return "", nil
+}
+
+// volumeChange clamps a volume value between 0 and ceiling. Relative changes
+// stay relative so the balance between channels is kept; changed is false when
+// the volume is already at the limit.
+func volumeChange(value VolumeValue, ceiling int, current func() (int, error)) (VolumeValue, bool, error) {
+
+	if !value.Relative {
+		return VolumeValue{Percent: min(max(value.Percent, 0), ceiling)}, true, nil
+	}
+
+	volume, err := current()
+	if err != nil {
+		return VolumeValue{}, false, err
+	}
+	target := min(max(volume+value.Percent, 0), max(volume, ceiling))
+	delta := target - volume
+	return VolumeValue{Percent: delta, Relative: true}, delta != 0, nil
+}
+
+// volumeLimit returns the highest volume in percent an action may set: 100, or
+// the configured ceiling when amplification above 100% is allowed.
+func (s *Server) volumeLimit(allowAbove100 bool) int {
+	if allowAbove100 {
+		return max(s.volumeCeiling, 100)
+	}
+	return 100
+}
+
+// currentVolume returns the aggregated volume of a sink or source.
+func (s *Server) currentVolume(kind, device string) (int, error) {
+	info, _, err := s.findAudioDevice(kind, device)
+	if err != nil {
+		return 0, err
+	}
+	return info.Volume, nil
+}
+
+// findAudioDevice looks up a sink or source by name, resolving the @DEFAULT_SINK@
+// and @DEFAULT_SOURCE@ placeholders, and also returns the name of the default device.
+func (s *Server) findAudioDevice(kind, device string) (AudioInfo, string, error) {
+	infos, err := s.Audio.Devices(kind)
+	if err != nil {
+		return AudioInfo{}, "", err
+	}
+
+	var found *AudioInfo
+	defaultName := ""
+	byDefault := device == "@DEFAULT_SINK@" || device == "@DEFAULT_SOURCE@"
+	for i, info := range infos {
+		if info.Default {
+			defaultName = info.Name
+		}
+		if info.Name == device || (byDefault && info.Default) {
+			found = &infos[i]
+		}
+	}
+	if found == nil {
+		return AudioInfo{}, defaultName, fmt.Errorf("unknown %s %s", kind, device)
+	}
+	return *found, defaultName, nil
 }
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// Steps of an audio action reported when it fails.
+	ActionStepValidate = "validate"
+	ActionStepCapture  = "capture"
+	ActionStepPort     = "port"
+	ActionStepMute     = "mute"
+	ActionStepVolume   = "volume"
+	ActionStepChannels = "channels"
+	ActionStepDefault  = "default"
+	ActionStepMove     = "move"
+	ActionStepProfile  = "profile"
+
+	// Overall status of a batch of audio actions.
+	ActionsStatusSuccess = "success"
+	ActionsStatusPartial = "partial"
+	ActionsStatusFailed  = "failed"
+	ActionsStatusInvalid = "invalid"
+)
+
+// ErrInvalidActions is returned when a batch of audio actions cannot be parsed or validated.
+var ErrInvalidActions = errors.New("invalid audio actions")
+
+// ActionResult reports the outcome of a single audio action.
+type ActionResult struct {
+	Index      int    `json:"index"`
+	Device     string `json:"device"`
+	Type       string `json:"type"`
+	Applied    bool   `json:"applied"`
+	Step       string `json:"step,omitempty"`  // step that failed
+	Error      string `json:"error,omitempty"` // reason of the failure
+	RolledBack bool   `json:"rolledBack,omitempty"`
+}
+
+// ActionsResponse is the response of a batch of audio actions.
+type ActionsResponse struct {
+	Status  string         `json:"status"`
+	Results []ActionResult `json:"results"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// audioState is the state of a device or stream before an action changed it, used for rollbacks.
+type audioState struct {
+	index         int
+	kind          string
+	device        string
+	mute          bool
+	channels      []int64
+	defaultDevice string
+	owner         string // sink or source a stream was playing on
+	port          string // active port, only set when an action changes it
+	profile       string // active profile of a card
+}
+
+// captureAudioState records the current port, mute, volume and default device affected by an action.
+func (s *Server) captureAudioState(action VolumeAction) (audioState, error) {
+	info, defaultName, err := s.findAudioDevice(action.Type, action.Device)
+	if err != nil {
+		return audioState{}, fmt.Errorf("failed to capture state for rollback: %w", err)
+	}
+
+	channels := make([]int64, len(info.Channels))
+	for i, channel := range info.Channels {
+		channels[i] = channel.Value
+	}
+
+	port := ""
+	if action.Port != "" {
+		port = info.ActivePort
+	}
+
+	return audioState{
+		kind:          action.Type,
+		device:        info.Name,
+		mute:          info.Mute,
+		channels:      channels,
+		defaultDevice: defaultName,
+		port:          port,
+	}, nil
+}
+
+// rollbackAudioActions restores the captured states in reverse order and marks
+// the results of the restored actions.
+func (s *Server) rollbackAudioActions(results []ActionResult, applied []audioState) {
+	for i := len(applied) - 1; i >= 0; i-- {
+		state := applied[i]
+		if err := s.restoreAudioState(state); err != nil {
+			results[state.index].Error = joinErrors(results[state.index].Error, "rollback failed: "+err.Error())
+			continue
+		}
+		results[state.index].Applied = false
+		results[state.index].RolledBack = true
+	}
+}
+
+// restoreAudioState sets the card profile, or the port, mute, per-channel volumes,
+// default device and the device of a stream back to a captured state.
+func (s *Server) restoreAudioState(state audioState) error {
+	if state.kind == "card" {
+		return s.setCardProfile(state.device, state.profile)
+	}
+
+	// Restore the port first, as switching ports may change the volume.
+	if state.port != "" {
+		if err := s.Audio.SetPort(state.kind, state.device, state.port); err != nil {
+			return fmt.Errorf("failed to restore port for %s %s: %w", state.kind, state.device, err)
+		}
+	}
+
+	if err := s.Audio.SetMute(state.kind, state.device, MuteValue{Muted: state.mute}); err != nil {
+		return fmt.Errorf("failed to restore mute for %s %s: %w", state.kind, state.device, err)
+	}
+
+	if len(state.channels) > 0 {
+		if err := s.setChannelVolumes(state.kind, state.device, state.channels); err != nil {
+			return fmt.Errorf("failed to restore volume: %w", err)
+		}
+	}
+
+	if state.defaultDevice != "" {
+		if err := s.Audio.SetDefault(state.kind, state.defaultDevice); err != nil {
+			return fmt.Errorf("failed to restore default %s %s: %w", state.kind, state.defaultDevice, err)
+		}
+	}
+
+	if state.owner != "" {
+		if err := s.Audio.MoveStream(state.kind, state.device, state.owner); err != nil {
+			return fmt.Errorf("failed to move %s %s back to %s: %w", state.kind, state.device, state.owner, err)
+		}
+	}
+
+	return nil
+}
+
+// joinErrors appends an error message to an existing one.
+func joinErrors(existing, message string) string {
+	if existing == "" {
+		return message
+	}
+	return existing + "; " + message
+}
+
+// ActionsStatus summarizes the results of a batch of audio actions into an overall
+// status and HTTP status code: 200 when everything was applied, 207 when only some
+// actions were, 400 for invalid input and 500 when nothing could be applied.
+func ActionsStatus(results []ActionResult, err error) (string, int) {
+	if err != nil {
+		return ActionsStatusInvalid, http.StatusBadRequest
+	}
+
+	applied := 0
+	for _, result := range results {
+		if result.Applied {
+			applied++
+		}
+	}
+
+	switch {
+	case applied == len(results):
+		return ActionsStatusSuccess, http.StatusOK
+	case applied > 0:
+		return ActionsStatusPartial, http.StatusMultiStatus
+	default:
+		return ActionsStatusFailed, http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// Audio backend names accepted by NewAudioBackend.
+const (
+	AudioBackendAuto   = "auto"
+	AudioBackendNative = "native"
+	AudioBackendPactl  = "pactl"
+)
+
+// AudioBackend talks to the sound server. Kinds are "sink", "source", "sink-input"
+// and "source-output"; targets are device names, which may be @DEFAULT_SINK@ or
+// @DEFAULT_SOURCE@, or stream indexes.
+type AudioBackend interface {
+	// Devices lists the sinks or sources, marking the default one.
+	Devices(kind string) ([]AudioInfo, error)
+	// Streams lists the sink-inputs or source-outputs.
+	Streams(kind string) ([]AudioStream, error)
+	// Cards lists the sound cards.
+	Cards() ([]AudioCard, error)
+
+	SetMute(kind, target string, mute MuteValue) error
+	// SetVolume sets all channels to a volume, or shifts them all by a relative one.
+	SetVolume(kind, target string, volume VolumeValue) error
+	// SetChannelVolumes sets raw per-channel volumes in channel map order.
+	SetChannelVolumes(kind, target string, values []int64) error
+	SetPort(kind, device, port string) error
+	SetDefault(kind, device string) error
+	MoveStream(kind, stream, device string) error
+	SetCardProfile(card, profile string) error
+
+	// Subscribe calls changed with the kind of every object that changes, "sink",
+	// "source", "sink-input", "source-output", "card" or "server", until ctx is
+	// cancelled or the connection to the server fails.
+	Subscribe(ctx context.Context, changed func(kind string)) error
+}
+
+// NewAudioBackend creates the backend with the given name: "native" for the
+// PulseAudio native protocol on the user's socket, "pactl", or "auto" for native
+// when the socket is reachable and pactl otherwise.
+func NewAudioBackend(name string) (AudioBackend, error) {
+	switch name {
+	case AudioBackendPactl:
+		return NewPactlBackend(), nil
+	case AudioBackendNative:
+		return NewNativeBackend("")
+	case AudioBackendAuto, "":
+		backend, err := NewNativeBackend("")
+		if err != nil {
+			log.Printf("Native audio backend unavailable, using pactl: %v", err)
+			return NewPactlBackend(), nil
+		}
+		return backend, nil
+	default:
+		return nil, fmt.Errorf("invalid audio backend %q, expected %s, %s or %s", name, AudioBackendAuto, AudioBackendNative, AudioBackendPactl)
+	}
+}
+
+// averageVolume returns the average volume in percent of the channels of a device or stream.
+func averageVolume(channels []ChannelVolume) int {
+	if len(channels) == 0 {
+		return 0
+	}
+	total := 0
+	for _, channel := range channels {
+		total += channel.Percent
+	}
+	return total / len(channels)
+}
+
+// sortPorts orders ports by decreasing priority.
+func sortPorts(ports []AudioPort) {
+	sort.SliceStable(ports, func(i, j int) bool {
+		if ports[i].Priority != ports[j].Priority {
+			return ports[i].Priority > ports[j].Priority
+		}
+		return ports[i].Name < ports[j].Name
+	})
+}
+
+// sortProfiles orders card profiles by decreasing priority.
+func sortProfiles(profiles []CardProfile) {
+	sort.SliceStable(profiles, func(i, j int) bool {
+		if profiles[i].Priority != profiles[j].Priority {
+			return profiles[i].Priority > profiles[j].Priority
+		}
+		return profiles[i].Name < profiles[j].Name
+	})
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Port availability, which is the plugged state of jack-detected ports.
+const (
+	PortAvailable   = "available"
+	PortUnavailable = "unavailable"
+	PortUnknown     = "unknown"
+)
+
+// AudioCard is a sound card with the profiles it can be switched to, e.g. A2DP
+// or HFP for a Bluetooth headset, and its ports.
+type AudioCard struct {
+	Index         uint32        `json:"index"`
+	Name          string        `json:"name"`
+	Description   string        `json:"description"`
+	Driver        string        `json:"driver"`
+	ActiveProfile string        `json:"activeProfile"`
+	Profiles      []CardProfile `json:"profiles"` // highest priority first
+	Ports         []AudioPort   `json:"ports"`    // highest priority first
+}
+
+// CardProfile is a configuration of a card, defining the sinks and sources it provides.
+type CardProfile struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Sinks       int    `json:"sinks"`
+	Sources     int    `json:"sources"`
+	Priority    int    `json:"priority"`
+	Available   bool   `json:"available"`
+}
+
+// AudioPort is an output or input of a card or device, e.g. speakers or headphones.
+type AudioPort struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Type         string   `json:"type"` // e.g. "Speaker", "Headphones", "HDMI"
+	Priority     int      `json:"priority"`
+	Availability string   `json:"availability"`       // "available" (plugged), "unavailable" or "unknown"
+	Profiles     []string `json:"profiles,omitempty"` // card profiles providing the port
+}
+
+// CardAction switches the active profile of a card.
+type CardAction struct {
+	Card    string `json:"card"`    // card name
+	Profile string `json:"profile"` // profile name, e.g. "a2dp-sink" or "output:hdmi-stereo"
+}
+
+// GetAudioCards retrieves the sound cards with their profiles and ports.
+func (s *Server) GetAudioCards() ([]AudioCard, error) {
+	return s.Audio.Cards()
+}
+
+// findAudioCard looks up a card by name.
+func (s *Server) findAudioCard(name string) (AudioCard, error) {
+	cards, err := s.GetAudioCards()
+	if err != nil {
+		return AudioCard{}, err
+	}
+	for _, card := range cards {
+		if card.Name == name {
+			return card, nil
+		}
+	}
+	return AudioCard{}, fmt.Errorf("unknown card %s", name)
+}
+
+// setCardProfile switches the active profile of a card.
+func (s *Server) setCardProfile(card, profile string) error {
+	if err := s.Audio.SetCardProfile(card, profile); err != nil {
+		return fmt.Errorf("failed to set profile %s for card %s: %w", profile, card, err)
+	}
+	return nil
+}
+
+// ProcessCardActions processes a JSON list of CardAction, with the same results,
+// atomic mode and errors as ProcessAudioActions.
+func (s *Server) ProcessCardActions(actionsJSON []byte, atomic bool) ([]ActionResult, error) {
+	var actions []CardAction
+	if err := json.Unmarshal(actionsJSON, &actions); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidActions, err)
+	}
+
+	results := make([]ActionResult, len(actions))
+	invalid := 0
+	for i, action := range actions {
+		results[i] = ActionResult{Index: i, Device: action.Card, Type: "card"}
+		if action.Card == "" || action.Profile == "" {
+			results[i].Step = ActionStepValidate
+			results[i].Error = "card and profile are required"
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		return results, fmt.Errorf("%w: %d of %d actions failed validation", ErrInvalidActions, invalid, len(actions))
+	}
+
+	var applied []audioState
+	for i, action := range actions {
+		previous := audioState{index: i}
+		if atomic {
+			card, err := s.findAudioCard(action.Card)
+			if err != nil {
+				results[i].Step = ActionStepCapture
+				results[i].Error = fmt.Errorf("failed to capture state for rollback: %w", err).Error()
+				s.rollbackAudioActions(results, applied)
+				break
+			}
+			previous = audioState{index: i, kind: "card", device: card.Name, profile: card.ActiveProfile}
+		}
+
+		if err := s.setCardProfile(action.Card, action.Profile); err != nil {
+			results[i].Step = ActionStepProfile
+			results[i].Error = err.Error()
+			if atomic {
+				s.rollbackAudioActions(results, applied)
+				break
+			}
+			continue
+		}
+
+		results[i].Applied = true
+		applied = append(applied, previous)
+	}
+
+	return results, nil
+}
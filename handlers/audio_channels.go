@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// volumeNorm is the raw volume corresponding to 100% (PA_VOLUME_NORM).
+const volumeNorm = 65536
+
+// leftChannels and rightChannels are the channel positions on each side, used for the balance.
+var (
+	leftChannels  = map[string]bool{"front-left": true, "rear-left": true, "side-left": true, "front-left-of-center": true, "top-front-left": true, "top-rear-left": true}
+	rightChannels = map[string]bool{"front-right": true, "rear-right": true, "side-right": true, "front-right-of-center": true, "top-front-right": true, "top-rear-right": true}
+)
+
+// channelVolumes orders the per-channel volumes reported by pactl by the device's
+// channel map, falling back to alphabetical order when the map is missing.
+func channelVolumes(channelMap string, volume map[string]RawVolumeChannel) []ChannelVolume {
+	var names []string
+	if channelMap != "" {
+		names = strings.Split(channelMap, ",")
+	}
+	if len(names) != len(volume) {
+		names = names[:0]
+		for name := range volume {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	channels := make([]ChannelVolume, 0, len(names))
+	for _, name := range names {
+		raw, ok := volume[name]
+		if !ok {
+			continue
+		}
+		percent, _ := strconv.Atoi(strings.TrimSuffix(raw.ValuePercent, "%"))
+		channels = append(channels, ChannelVolume{
+			Channel: name,
+			Percent: percent,
+			DB:      raw.DB,
+			Value:   raw.Value,
+		})
+	}
+	return channels
+}
+
+// sideAverages returns the average raw volume of the left and right channels.
+func sideAverages(channels []ChannelVolume) (float64, float64, bool) {
+	var left, right float64
+	var nLeft, nRight int
+	for _, channel := range channels {
+		switch {
+		case leftChannels[channel.Channel]:
+			left += float64(channel.Value)
+			nLeft++
+		case rightChannels[channel.Channel]:
+			right += float64(channel.Value)
+			nRight++
+		}
+	}
+	if nLeft == 0 || nRight == 0 {
+		return 0, 0, false
+	}
+	return left / float64(nLeft), right / float64(nRight), true
+}
+
+// volumeBalance computes the balance between left and right channels the same way
+// as PulseAudio: -1 is fully left, 0 centered and 1 fully right.
+func volumeBalance(channels []ChannelVolume) float64 {
+	left, right, ok := sideAverages(channels)
+	if !ok || left == right {
+		return 0
+	}
+	if left > right {
+		return -1 + right/left
+	}
+	return 1 - left/right
+}
+
+// channelArguments computes the raw per-channel volumes for the Channels and
+// Balance of an action, starting from the device's current volumes.
+func (s *Server) channelArguments(action VolumeAction) ([]int64, error) {
+	info, _, err := s.findAudioDevice(action.Type, action.Device)
+	if err != nil {
+		return nil, err
+	}
+
+	ceiling := int64(s.volumeLimit(action.AllowAbove100))
+
+	channels := append([]ChannelVolume(nil), info.Channels...)
+	for name, percent := range action.Channels {
+		found := false
+		for i := range channels {
+			if channels[i].Channel == name {
+				channels[i].Value = min(int64(percent), ceiling) * volumeNorm / 100
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s %s has no channel %s", action.Type, info.Name, name)
+		}
+	}
+
+	if action.Balance != nil {
+		left, right, ok := sideAverages(channels)
+		if !ok {
+			return nil, fmt.Errorf("%s %s has no left and right channels to balance", action.Type, info.Name)
+		}
+
+		// Keep the louder side and scale the other one down, like pa_cvolume_set_balance.
+		loudest := max(left, right)
+		newLeft, newRight := loudest, loudest
+		if *action.Balance < 0 {
+			newRight = (1 + *action.Balance) * loudest
+		} else {
+			newLeft = (1 - *action.Balance) * loudest
+		}
+
+		for i := range channels {
+			switch {
+			case leftChannels[channels[i].Channel]:
+				channels[i].Value = scaleVolume(channels[i].Value, left, newLeft)
+			case rightChannels[channels[i].Channel]:
+				channels[i].Value = scaleVolume(channels[i].Value, right, newRight)
+			}
+		}
+	}
+
+	values := make([]int64, len(channels))
+	for i, channel := range channels {
+		values[i] = channel.Value
+	}
+	return values, nil
+}
+
+// scaleVolume moves a channel volume from one side average to another, keeping
+// differences between channels on the same side.
+func scaleVolume(value int64, from, to float64) int64 {
+	if from == 0 {
+		return int64(to)
+	}
+	return int64(float64(value) * to / from)
+}
+
+// setChannelVolumes sets raw per-channel volumes, in channel map order.
+func (s *Server) setChannelVolumes(kind, device string, values []int64) error {
+	if err := s.Audio.SetChannelVolumes(kind, device, values); err != nil {
+		return fmt.Errorf("failed to set channel volumes for %s %s: %w", kind, device, err)
+	}
+	return nil
+}
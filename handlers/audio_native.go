@@ -0,0 +1,458 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/giftpilz0/sysutil/internal/pulse"
+)
+
+// maxRawVolume is the highest raw volume accepted by the server (PA_VOLUME_MAX).
+const maxRawVolume = math.MaxUint32 / 2
+
+// nativeBackend speaks the PulseAudio native protocol over the user's socket,
+// keeping one connection open and reconnecting when it is lost.
+type nativeBackend struct {
+	socket string
+
+	mu     sync.Mutex
+	client *pulse.Client
+}
+
+// NewNativeBackend creates an audio backend connected to the PulseAudio or
+// pipewire-pulse server listening on socket, or on the user's default socket
+// when socket is empty.
+func NewNativeBackend(socket string) (AudioBackend, error) {
+	if socket == "" {
+		socket = pulse.DefaultSocket()
+	}
+	b := &nativeBackend{socket: socket}
+	if _, err := b.conn(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// conn returns the open connection, dialing a new one when there is none.
+func (b *nativeBackend) conn() (*pulse.Client, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.client != nil {
+		select {
+		case <-b.client.Done():
+			b.client = nil
+		default:
+			return b.client, nil
+		}
+	}
+
+	client, err := pulse.Dial(b.socket)
+	if err != nil {
+		return nil, err
+	}
+	b.client = client
+	return client, nil
+}
+
+// nativeChannels converts a raw volume into per-channel volumes in channel map order.
+func nativeChannels(channelMap []uint8, volume []uint32) []ChannelVolume {
+	channels := make([]ChannelVolume, 0, len(volume))
+	for i, value := range volume {
+		name := "mono"
+		if i < len(channelMap) {
+			name = pulse.ChannelName(channelMap[i])
+		}
+
+		db := "-inf dB"
+		if value > 0 {
+			// Volumes are cubic: 60 log10 is 20 log10 of the linear factor.
+			db = fmt.Sprintf("%0.2f dB", 60*math.Log10(float64(value)/volumeNorm))
+		}
+
+		channels = append(channels, ChannelVolume{
+			Channel: name,
+			Percent: int((int64(value)*100 + volumeNorm/2) / volumeNorm),
+			DB:      db,
+			Value:   int64(value),
+		})
+	}
+	return channels
+}
+
+// nativePorts converts ports, sorted by decreasing priority.
+func nativePorts(raws []pulse.Port) []AudioPort {
+	ports := make([]AudioPort, 0, len(raws))
+	for _, raw := range raws {
+		availability := PortUnknown
+		switch raw.Available {
+		case pulse.PortAvailableYes:
+			availability = PortAvailable
+		case pulse.PortAvailableNo:
+			availability = PortUnavailable
+		}
+		ports = append(ports, AudioPort{
+			Name:         raw.Name,
+			Description:  raw.Description,
+			Type:         pulse.PortTypeName(raw.Type),
+			Priority:     int(raw.Priority),
+			Availability: availability,
+			Profiles:     raw.Profiles,
+		})
+	}
+	sortPorts(ports)
+	return ports
+}
+
+// devices lists the raw sinks or sources with the name of the default one.
+func (b *nativeBackend) devices(kind string) ([]pulse.Device, string, error) {
+	client, err := b.conn()
+	if err != nil {
+		return nil, "", err
+	}
+	info, err := client.ServerInfo()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if kind == "source" {
+		devices, err := client.Sources()
+		return devices, info.DefaultSource, err
+	}
+	devices, err := client.Sinks()
+	return devices, info.DefaultSink, err
+}
+
+// Devices lists the sinks or sources, marking the default one.
+func (b *nativeBackend) Devices(kind string) ([]AudioInfo, error) {
+	devices, defaultName, err := b.devices(kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %ss: %w", kind, err)
+	}
+
+	audioInfos := make([]AudioInfo, 0, len(devices))
+	for _, device := range devices {
+		channels := nativeChannels(device.ChannelMap, device.Volume)
+		audioInfos = append(audioInfos, AudioInfo{
+			Index:       device.Index,
+			Name:        device.Name,
+			Volume:      averageVolume(channels),
+			Mute:        device.Mute,
+			Default:     device.Name == defaultName,
+			Description: device.Description,
+			Nickname:    device.Properties["device.nick"],
+			Channels:    channels,
+			Balance:     volumeBalance(channels),
+			ActivePort:  device.ActivePort,
+			Ports:       nativePorts(device.Ports),
+		})
+	}
+	return audioInfos, nil
+}
+
+// streams lists the raw sink-inputs or source-outputs.
+func (b *nativeBackend) streams(kind string) ([]pulse.Stream, error) {
+	client, err := b.conn()
+	if err != nil {
+		return nil, err
+	}
+	if kind == StreamSourceOutput {
+		return client.SourceOutputs()
+	}
+	return client.SinkInputs()
+}
+
+// Streams lists the sink-inputs or source-outputs with the name of their device.
+func (b *nativeBackend) Streams(kind string) ([]AudioStream, error) {
+	raws, err := b.streams(kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %ss: %w", kind, err)
+	}
+	devices, _, err := b.devices(streamDeviceKind(kind))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %ss: %w", streamDeviceKind(kind), err)
+	}
+	names := make(map[uint32]string, len(devices))
+	for _, device := range devices {
+		names[device.Index] = device.Name
+	}
+
+	streams := make([]AudioStream, 0, len(raws))
+	for _, raw := range raws {
+		name := raw.Properties["media.name"]
+		if name == "" {
+			name = raw.Name
+		}
+
+		channels := nativeChannels(raw.ChannelMap, raw.Volume)
+		stream := AudioStream{
+			Index:       raw.Index,
+			Type:        kind,
+			Name:        name,
+			AppName:     raw.Properties["application.name"],
+			Binary:      raw.Properties["application.process.binary"],
+			Volume:      averageVolume(channels),
+			Mute:        raw.Mute,
+			Corked:      raw.Corked,
+			Channels:    channels,
+			Device:      names[raw.Device],
+			DeviceIndex: raw.Device,
+		}
+		stream.PID, _ = strconv.Atoi(raw.Properties["application.process.id"])
+		streams = append(streams, stream)
+	}
+	return streams, nil
+}
+
+// Cards lists the sound cards.
+func (b *nativeBackend) Cards() ([]AudioCard, error) {
+	client, err := b.conn()
+	if err != nil {
+		return nil, err
+	}
+	raws, err := client.Cards()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cards: %w", err)
+	}
+
+	cards := make([]AudioCard, 0, len(raws))
+	for _, raw := range raws {
+		profiles := make([]CardProfile, 0, len(raw.Profiles))
+		for _, profile := range raw.Profiles {
+			profiles = append(profiles, CardProfile{
+				Name:        profile.Name,
+				Description: profile.Description,
+				Sinks:       int(profile.Sinks),
+				Sources:     int(profile.Sources),
+				Priority:    int(profile.Priority),
+				Available:   profile.Available,
+			})
+		}
+		sortProfiles(profiles)
+
+		cards = append(cards, AudioCard{
+			Index:         raw.Index,
+			Name:          raw.Name,
+			Description:   raw.Properties["device.description"],
+			Driver:        raw.Driver,
+			ActiveProfile: raw.ActiveProfile,
+			Profiles:      profiles,
+			Ports:         nativePorts(raw.Ports),
+		})
+	}
+	return cards, nil
+}
+
+// volume returns the mute state and raw volume of a device or stream, resolving
+// the @DEFAULT_SINK@ and @DEFAULT_SOURCE@ placeholders.
+func (b *nativeBackend) volume(kind, target string) (bool, []uint32, error) {
+	if kind == StreamSinkInput || kind == StreamSourceOutput {
+		index, err := streamIndex(target)
+		if err != nil {
+			return false, nil, err
+		}
+		streams, err := b.streams(kind)
+		if err != nil {
+			return false, nil, err
+		}
+		for _, stream := range streams {
+			if stream.Index == index {
+				return stream.Mute, stream.Volume, nil
+			}
+		}
+		return false, nil, fmt.Errorf("unknown %s %s", kind, target)
+	}
+
+	devices, defaultName, err := b.devices(kind)
+	if err != nil {
+		return false, nil, err
+	}
+	if target == "@DEFAULT_SINK@" || target == "@DEFAULT_SOURCE@" {
+		target = defaultName
+	}
+	for _, device := range devices {
+		if device.Name == target {
+			return device.Mute, device.Volume, nil
+		}
+	}
+	return false, nil, fmt.Errorf("unknown %s %s", kind, target)
+}
+
+// streamIndex parses the index of a stream.
+func streamIndex(target string) (uint32, error) {
+	index, err := strconv.ParseUint(target, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid stream index %q", target)
+	}
+	return uint32(index), nil
+}
+
+// SetMute mutes, unmutes or toggles a device or stream.
+func (b *nativeBackend) SetMute(kind, target string, mute MuteValue) error {
+	muted := mute.Muted
+	if mute.Toggle {
+		current, _, err := b.volume(kind, target)
+		if err != nil {
+			return err
+		}
+		muted = !current
+	}
+
+	client, err := b.conn()
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case "sink":
+		return client.SetSinkMute(target, muted)
+	case "source":
+		return client.SetSourceMute(target, muted)
+	}
+
+	index, err := streamIndex(target)
+	if err != nil {
+		return err
+	}
+	if kind == StreamSourceOutput {
+		return client.SetSourceOutputMute(index, muted)
+	}
+	return client.SetSinkInputMute(index, muted)
+}
+
+// SetVolume sets every channel to a volume or shifts them by a relative one,
+// like pactl does with "50%" and "+5%".
+func (b *nativeBackend) SetVolume(kind, target string, volume VolumeValue) error {
+	_, current, err := b.volume(kind, target)
+	if err != nil {
+		return err
+	}
+
+	delta := int64(volume.Percent) * volumeNorm / 100
+	values := make([]int64, len(current))
+	for i, value := range current {
+		if volume.Relative {
+			values[i] = min(max(int64(value)+delta, 0), maxRawVolume)
+		} else {
+			values[i] = min(max(delta, 0), maxRawVolume)
+		}
+	}
+	return b.SetChannelVolumes(kind, target, values)
+}
+
+// SetChannelVolumes sets raw per-channel volumes in channel map order.
+func (b *nativeBackend) SetChannelVolumes(kind, target string, values []int64) error {
+	volume := make([]uint32, len(values))
+	for i, value := range values {
+		volume[i] = uint32(min(max(value, 0), maxRawVolume))
+	}
+
+	client, err := b.conn()
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case "sink":
+		return client.SetSinkVolume(target, volume)
+	case "source":
+		return client.SetSourceVolume(target, volume)
+	}
+
+	index, err := streamIndex(target)
+	if err != nil {
+		return err
+	}
+	if kind == StreamSourceOutput {
+		return client.SetSourceOutputVolume(index, volume)
+	}
+	return client.SetSinkInputVolume(index, volume)
+}
+
+// SetPort switches the active port of a sink or source.
+func (b *nativeBackend) SetPort(kind, device, port string) error {
+	client, err := b.conn()
+	if err != nil {
+		return err
+	}
+	if kind == "source" {
+		return client.SetSourcePort(device, port)
+	}
+	return client.SetSinkPort(device, port)
+}
+
+// SetDefault makes a sink or source the default one.
+func (b *nativeBackend) SetDefault(kind, device string) error {
+	client, err := b.conn()
+	if err != nil {
+		return err
+	}
+	if kind == "source" {
+		return client.SetDefaultSource(device)
+	}
+	return client.SetDefaultSink(device)
+}
+
+// MoveStream moves a sink-input to another sink or a source-output to another source.
+func (b *nativeBackend) MoveStream(kind, stream, device string) error {
+	index, err := streamIndex(stream)
+	if err != nil {
+		return err
+	}
+	client, err := b.conn()
+	if err != nil {
+		return err
+	}
+	if kind == StreamSourceOutput {
+		return client.MoveSourceOutput(index, device)
+	}
+	return client.MoveSinkInput(index, device)
+}
+
+// SetCardProfile switches the active profile of a card.
+func (b *nativeBackend) SetCardProfile(card, profile string) error {
+	client, err := b.conn()
+	if err != nil {
+		return err
+	}
+	return client.SetCardProfile(card, profile)
+}
+
+// nativeFacilities are the object kinds reported by Subscribe for each facility.
+var nativeFacilities = map[pulse.Facility]string{
+	pulse.FacilitySink:         "sink",
+	pulse.FacilitySource:       "source",
+	pulse.FacilitySinkInput:    StreamSinkInput,
+	pulse.FacilitySourceOutput: StreamSourceOutput,
+	pulse.FacilityServer:       "server",
+	pulse.FacilityCard:         "card",
+}
+
+// Subscribe listens for change events on a dedicated connection, so that the
+// events never wait behind replies to queries.
+func (b *nativeBackend) Subscribe(ctx context.Context, changed func(kind string)) error {
+	client, err := pulse.Dial(b.socket)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	events, err := client.Subscribe()
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to audio events: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-client.Done():
+			return fmt.Errorf("audio server connection closed")
+		case event := <-events:
+			if kind, ok := nativeFacilities[event.Facility]; ok {
+				changed(kind)
+			}
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	pactlCmd = "pactl"
+)
+
+// RawVolumeChannel represents an individual channel's volume details from pactl.
+type RawVolumeChannel struct {
+	DB           string `json:"db"`
+	Value        int64  `json:"value"`
+	ValuePercent string `json:"value_percent"`
+}
+
+// RawVolumeChannel represents an individual channel's volume details from pactl.
+type RawDeviceProperties struct {
+	Nickname string `json:"device.nick"`
+}
+
+// rawDevice is a common structure for unmarshaling JSON output for both sinks and sources.
+type rawDevice struct {
+	Index       uint32                      `json:"index"`
+	Name        string                      `json:"name"`
+	ChannelMap  string                      `json:"channel_map"`
+	Volume      map[string]RawVolumeChannel `json:"volume"`
+	Properties  RawDeviceProperties         `json:"properties"`
+	Mute        bool                        `json:"mute"`
+	Description string                      `json:"description"`
+	Ports       []rawPort                   `json:"ports"`
+	ActivePort  string                      `json:"active_port"`
+}
+
+// rawStreamProperties are the stream properties used from pactl.
+type rawStreamProperties struct {
+	MediaName string `json:"media.name"`
+	AppName   string `json:"application.name"`
+	Binary    string `json:"application.process.binary"`
+	PID       string `json:"application.process.id"`
+}
+
+// rawStream is the pactl JSON output for both sink-inputs and source-outputs.
+type rawStream struct {
+	Index      uint32                      `json:"index"`
+	Sink       *uint32                     `json:"sink"`
+	Source     *uint32                     `json:"source"`
+	ChannelMap string                      `json:"channel_map"`
+	Volume     map[string]RawVolumeChannel `json:"volume"`
+	Mute       bool                        `json:"mute"`
+	Corked     bool                        `json:"corked"`
+	Properties rawStreamProperties         `json:"properties"`
+}
+
+// rawPort is the pactl JSON output for a port, of a card or of a sink or source.
+type rawPort struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Type         string   `json:"type"`
+	Priority     int      `json:"priority"`
+	Availability string   `json:"availability"`
+	Profiles     []string `json:"profiles"`
+}
+
+// rawProfile is the pactl JSON output for a card profile.
+type rawProfile struct {
+	Description string `json:"description"`
+	Sinks       int    `json:"sinks"`
+	Sources     int    `json:"sources"`
+	Priority    int    `json:"priority"`
+	Available   bool   `json:"available"`
+}
+
+// rawCard is the pactl JSON output for a card.
+type rawCard struct {
+	Index      uint32 `json:"index"`
+	Name       string `json:"name"`
+	Driver     string `json:"driver"`
+	Properties struct {
+		Description string `json:"device.description"`
+	} `json:"properties"`
+	Profiles      map[string]rawProfile `json:"profiles"`
+	ActiveProfile string                `json:"active_profile"`
+	Ports         map[string]rawPort    `json:"ports"`
+}
+
+// pactlBackend runs pactl for every query and change.
+type pactlBackend struct{}
+
+// NewPactlBackend creates an audio backend running the pactl command line tool.
+func NewPactlBackend() AudioBackend {
+	return pactlBackend{}
+}
+
+// list runs "pactl list" for a kind of objects and decodes its JSON output.
+func (pactlBackend) list(objects string, out any) error {
+	output, err := exec.Command(pactlCmd, "--format", "json", "list", objects).Output()
+	if err != nil {
+		return fmt.Errorf("error executing pactl for %s: %w", objects, err)
+	}
+	if err := json.Unmarshal(output, out); err != nil {
+		return fmt.Errorf("error parsing pactl %s JSON: %w", objects, err)
+	}
+	return nil
+}
+
+// run runs a pactl command changing the server state. Its output, such as
+// "Failure: No such entity", is part of the error.
+func (pactlBackend) run(args ...string) error {
+	output, err := exec.Command(pactlCmd, args...).CombinedOutput()
+	if err != nil {
+		if message := strings.TrimSpace(string(output)); message != "" {
+			return fmt.Errorf("error executing pactl %s: %w: %s", args[0], err, message)
+		}
+		return fmt.Errorf("error executing pactl %s: %w", args[0], err)
+	}
+	return nil
+}
+
+// Devices retrieves audio devices info from pactl (sinks or sources)
+// and marks the default device based on pactl get-default-sink/source.
+func (b pactlBackend) Devices(kind string) ([]AudioInfo, error) {
+	var devices []rawDevice
+	if err := b.list(kind+"s", &devices); err != nil {
+		return nil, err
+	}
+
+	audioInfos := make([]AudioInfo, 0, len(devices))
+	for _, dev := range devices {
+		channels := channelVolumes(dev.ChannelMap, dev.Volume)
+		audioInfos = append(audioInfos, AudioInfo{
+			Index:       dev.Index,
+			Name:        dev.Name,
+			Volume:      averageVolume(channels),
+			Mute:        dev.Mute,
+			Description: dev.Description,
+			Nickname:    dev.Properties.Nickname,
+			Channels:    channels,
+			Balance:     volumeBalance(channels),
+			ActivePort:  dev.ActivePort,
+			Ports:       pactlPorts(dev.Ports),
+		})
+	}
+
+	// Determine the default device for sinks or sources.
+	defArg := "get-default-" + kind
+	defOutput, err := exec.Command(pactlCmd, defArg).Output()
+	if err != nil {
+		return audioInfos, fmt.Errorf("error retrieving default device using %s: %w", defArg, err)
+	}
+	defaultName := strings.TrimSpace(string(defOutput))
+	for i := range audioInfos {
+		if audioInfos[i].Name == defaultName {
+			audioInfos[i].Default = true
+		}
+	}
+
+	return audioInfos, nil
+}
+
+// Streams retrieves the streams of one kind from pactl, resolving the index of
+// the device each stream is attached to into its name.
+func (b pactlBackend) Streams(kind string) ([]AudioStream, error) {
+	var raws []rawStream
+	if err := b.list(kind+"s", &raws); err != nil {
+		return nil, err
+	}
+
+	devices, err := b.Devices(streamDeviceKind(kind))
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uint32]string, len(devices))
+	for _, device := range devices {
+		names[device.Index] = device.Name
+	}
+
+	streams := make([]AudioStream, 0, len(raws))
+	for _, raw := range raws {
+		deviceIndex := raw.Sink
+		if kind == StreamSourceOutput {
+			deviceIndex = raw.Source
+		}
+
+		channels := channelVolumes(raw.ChannelMap, raw.Volume)
+		stream := AudioStream{
+			Index:    raw.Index,
+			Type:     kind,
+			Name:     raw.Properties.MediaName,
+			AppName:  raw.Properties.AppName,
+			Binary:   raw.Properties.Binary,
+			Volume:   averageVolume(channels),
+			Mute:     raw.Mute,
+			Corked:   raw.Corked,
+			Channels: channels,
+		}
+		stream.PID, _ = strconv.Atoi(raw.Properties.PID)
+		if deviceIndex != nil {
+			stream.DeviceIndex = *deviceIndex
+			stream.Device = names[*deviceIndex]
+		}
+		streams = append(streams, stream)
+	}
+	return streams, nil
+}
+
+// Cards retrieves the sound cards with their profiles and ports from pactl.
+func (b pactlBackend) Cards() ([]AudioCard, error) {
+	var raws []rawCard
+	if err := b.list("cards", &raws); err != nil {
+		return nil, err
+	}
+
+	cards := make([]AudioCard, 0, len(raws))
+	for _, raw := range raws {
+		profiles := make([]CardProfile, 0, len(raw.Profiles))
+		for name, profile := range raw.Profiles {
+			profiles = append(profiles, CardProfile{
+				Name:        name,
+				Description: profile.Description,
+				Sinks:       profile.Sinks,
+				Sources:     profile.Sources,
+				Priority:    profile.Priority,
+				Available:   profile.Available,
+			})
+		}
+		sortProfiles(profiles)
+
+		ports := make([]rawPort, 0, len(raw.Ports))
+		for name, port := range raw.Ports {
+			port.Name = name
+			ports = append(ports, port)
+		}
+
+		cards = append(cards, AudioCard{
+			Index:         raw.Index,
+			Name:          raw.Name,
+			Description:   raw.Properties.Description,
+			Driver:        raw.Driver,
+			ActiveProfile: raw.ActiveProfile,
+			Profiles:      profiles,
+			Ports:         pactlPorts(ports),
+		})
+	}
+	return cards, nil
+}
+
+// pactlPorts converts pactl ports, sorted by decreasing priority.
+func pactlPorts(raws []rawPort) []AudioPort {
+	ports := make([]AudioPort, 0, len(raws))
+	for _, raw := range raws {
+		availability := PortUnknown
+		switch raw.Availability {
+		case "available":
+			availability = PortAvailable
+		case "not available":
+			availability = PortUnavailable
+		}
+		ports = append(ports, AudioPort{
+			Name:         raw.Name,
+			Description:  raw.Description,
+			Type:         raw.Type,
+			Priority:     raw.Priority,
+			Availability: availability,
+			Profiles:     raw.Profiles,
+		})
+	}
+	sortPorts(ports)
+	return ports
+}
+
+// SetMute runs pactl set-<kind>-mute with 1, 0 or toggle.
+func (b pactlBackend) SetMute(kind, target string, mute MuteValue) error {
+	muteVal := "0"
+	switch {
+	case mute.Toggle:
+		muteVal = "toggle"
+	case mute.Muted:
+		muteVal = "1"
+	}
+	return b.run(fmt.Sprintf("set-%s-mute", kind), target, muteVal)
+}
+
+// SetVolume runs pactl set-<kind>-volume with "50%", or "+5%" and "-5%" for relative changes.
+func (b pactlBackend) SetVolume(kind, target string, volume VolumeValue) error {
+	volumeStr := strconv.Itoa(volume.Percent) + "%"
+	if volume.Relative && volume.Percent >= 0 {
+		volumeStr = "+" + volumeStr
+	}
+	return b.run(fmt.Sprintf("set-%s-volume", kind), target, volumeStr)
+}
+
+// SetChannelVolumes runs pactl set-<kind>-volume with one raw volume per channel.
+func (b pactlBackend) SetChannelVolumes(kind, target string, values []int64) error {
+	args := []string{fmt.Sprintf("set-%s-volume", kind), target}
+	for _, value := range values {
+		args = append(args, strconv.FormatInt(value, 10))
+	}
+	return b.run(args...)
+}
+
+// SetPort runs pactl set-<kind>-port.
+func (b pactlBackend) SetPort(kind, device, port string) error {
+	return b.run(fmt.Sprintf("set-%s-port", kind), device, port)
+}
+
+// SetDefault runs pactl set-default-<kind>.
+func (b pactlBackend) SetDefault(kind, device string) error {
+	return b.run(fmt.Sprintf("set-default-%s", kind), device)
+}
+
+// MoveStream runs pactl move-<kind>.
+func (b pactlBackend) MoveStream(kind, stream, device string) error {
+	return b.run(fmt.Sprintf("move-%s", kind), stream, device)
+}
+
+// SetCardProfile runs pactl set-card-profile.
+func (b pactlBackend) SetCardProfile(card, profile string) error {
+	return b.run("set-card-profile", card, profile)
+}
+
+// Subscribe runs "pactl subscribe" and reports the kind of object of each line,
+// e.g. "Event 'change' on sink #53".
+func (pactlBackend) Subscribe(ctx context.Context, changed func(kind string)) error {
+	cmd := exec.CommandContext(ctx, pactlCmd, "subscribe")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error executing pactl subscribe: %w", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[0] != "Event" {
+			continue
+		}
+		changed(fields[3])
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("pactl subscribe exited: %w", err)
+	}
+	return fmt.Errorf("pactl subscribe exited")
+}
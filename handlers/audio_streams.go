@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+const (
+	// Kinds of application streams.
+	StreamSinkInput    = "sink-input"    // playback stream, played on a sink
+	StreamSourceOutput = "source-output" // recording stream, recorded from a source
+)
+
+// AudioStream is a running application stream: playback (sink-input) or recording
+// (source-output), with the device it is attached to.
+type AudioStream struct {
+	Index       uint32          `json:"index"`
+	Type        string          `json:"type"` // "sink-input" or "source-output"
+	Name        string          `json:"name"` // media name, e.g. the title being played
+	AppName     string          `json:"appName"`
+	Binary      string          `json:"binary"`
+	PID         int             `json:"pid,omitempty"`
+	Volume      int             `json:"volume"`
+	Mute        bool            `json:"mute"`
+	Corked      bool            `json:"corked"` // paused by the application
+	Channels    []ChannelVolume `json:"channels"`
+	Device      string          `json:"device"` // sink or source name
+	DeviceIndex uint32          `json:"deviceIndex"`
+}
+
+// StreamAction changes the volume or mute state of an application stream, or moves
+// it to another device. Fields left empty are untouched.
+type StreamAction struct {
+	Stream        uint32       `json:"stream"`                  // stream index
+	Type          string       `json:"type"`                    // "sink-input" or "source-output"; defaults to "sink-input" if empty
+	Adjust        *VolumeValue `json:"adjust,omitempty"`        // absolute volume (50) or relative change ("+5", "-5")
+	Muted         *MuteValue   `json:"muted,omitempty"`         // true to mute, false to unmute or "toggle"
+	MoveTo        string       `json:"moveTo,omitempty"`        // name of the sink or source to move the stream to
+	AllowAbove100 bool         `json:"allowAbove100,omitempty"` // allow volumes above 100% up to the configured ceiling
+}
+
+// streamDeviceKind returns the device kind a stream kind is attached to.
+func streamDeviceKind(kind string) string {
+	if kind == StreamSourceOutput {
+		return "source"
+	}
+	return "sink"
+}
+
+// GetAudioStreams retrieves the application streams of a kind, or of both kinds
+// when kind is empty.
+func (s *Server) GetAudioStreams(kind string) ([]AudioStream, error) {
+	switch kind {
+	case StreamSinkInput, StreamSourceOutput:
+		return s.Audio.Streams(kind)
+	case "":
+		playback, err := s.Audio.Streams(StreamSinkInput)
+		if err != nil {
+			return nil, err
+		}
+		recording, err := s.Audio.Streams(StreamSourceOutput)
+		if err != nil {
+			return nil, err
+		}
+		return append(playback, recording...), nil
+	default:
+		return nil, fmt.Errorf("invalid stream type %q, expected %q or %q", kind, StreamSinkInput, StreamSourceOutput)
+	}
+}
+
+// findAudioStream looks up a stream by kind and index.
+func (s *Server) findAudioStream(kind string, index uint32) (AudioStream, error) {
+	streams, err := s.Audio.Streams(kind)
+	if err != nil {
+		return AudioStream{}, err
+	}
+	for _, stream := range streams {
+		if stream.Index == index {
+			return stream, nil
+		}
+	}
+	return AudioStream{}, fmt.Errorf("unknown %s %d", kind, index)
+}
+
+// ProcessStreamActions processes a JSON list of StreamAction, with the same results,
+// atomic mode and errors as ProcessAudioActions.
+func (s *Server) ProcessStreamActions(actionsJSON []byte, atomic bool) ([]ActionResult, error) {
+	var actions []StreamAction
+	if err := json.Unmarshal(actionsJSON, &actions); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidActions, err)
+	}
+
+	results := make([]ActionResult, len(actions))
+	invalid := 0
+	for i := range actions {
+		if actions[i].Type == "" {
+			actions[i].Type = StreamSinkInput
+		}
+		results[i] = ActionResult{Index: i, Device: strconv.FormatUint(uint64(actions[i].Stream), 10), Type: actions[i].Type}
+		if actions[i].Type != StreamSinkInput && actions[i].Type != StreamSourceOutput {
+			results[i].Step = ActionStepValidate
+			results[i].Error = fmt.Sprintf("invalid type %q, expected %q or %q", actions[i].Type, StreamSinkInput, StreamSourceOutput)
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		return results, fmt.Errorf("%w: %d of %d actions failed validation", ErrInvalidActions, invalid, len(actions))
+	}
+
+	var applied []audioState
+	for i, action := range actions {
+		previous := audioState{index: i}
+		if atomic {
+			state, err := s.captureStreamState(action)
+			if err != nil {
+				results[i].Step = ActionStepCapture
+				results[i].Error = err.Error()
+				s.rollbackAudioActions(results, applied)
+				break
+			}
+			previous = state
+			previous.index = i
+		}
+
+		if step, err := s.applyStreamAction(action); err != nil {
+			results[i].Step = step
+			results[i].Error = err.Error()
+			if atomic {
+				applied = append(applied, previous)
+				s.rollbackAudioActions(results, applied)
+				break
+			}
+			continue
+		}
+
+		results[i].Applied = true
+		applied = append(applied, previous)
+	}
+
+	return results, nil
+}
+
+// captureStreamState records the current mute, volume and device of a stream.
+func (s *Server) captureStreamState(action StreamAction) (audioState, error) {
+	stream, err := s.findAudioStream(action.Type, action.Stream)
+	if err != nil {
+		return audioState{}, fmt.Errorf("failed to capture state for rollback: %w", err)
+	}
+
+	channels := make([]int64, len(stream.Channels))
+	for i, channel := range stream.Channels {
+		channels[i] = channel.Value
+	}
+
+	return audioState{
+		kind:     action.Type,
+		device:   strconv.FormatUint(uint64(stream.Index), 10),
+		mute:     stream.Mute,
+		channels: channels,
+		owner:    stream.Device,
+	}, nil
+}
+
+// applyStreamAction sets mute and volume of a stream and moves it with the audio
+// backend. On failure it returns the step that failed.
+func (s *Server) applyStreamAction(action StreamAction) (string, error) {
+	index := strconv.FormatUint(uint64(action.Stream), 10)
+
+	if action.Muted != nil {
+		if err := s.Audio.SetMute(action.Type, index, *action.Muted); err != nil {
+			return ActionStepMute, fmt.Errorf("failed to set mute for %s %s: %w", action.Type, index, err)
+		}
+	}
+
+	if action.Adjust != nil {
+		volume, changed, err := volumeChange(*action.Adjust, s.volumeLimit(action.AllowAbove100), func() (int, error) {
+			stream, err := s.findAudioStream(action.Type, action.Stream)
+			return stream.Volume, err
+		})
+		if err != nil {
+			return ActionStepVolume, err
+		}
+		if changed {
+			if err := s.Audio.SetVolume(action.Type, index, volume); err != nil {
+				return ActionStepVolume, fmt.Errorf("failed to set volume for %s %s: %w", action.Type, index, err)
+			}
+		}
+	}
+
+	if action.MoveTo != "" {
+		if err := s.Audio.MoveStream(action.Type, index, action.MoveTo); err != nil {
+			return ActionStepMove, fmt.Errorf("failed to move %s %s to %s: %w", action.Type, index, action.MoveTo, err)
+		}
+	}
+
+	return "", nil
+}
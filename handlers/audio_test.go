@@ -0,0 +1,315 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/giftpilz0/sysutil/client"
+	"github.com/giftpilz0/sysutil/handlers"
+	"github.com/giftpilz0/sysutil/handlers/handlerstest"
+)
+
+// useFakeAudio creates an audio backend with two sinks, a source, a playback
+// stream on the default sink and a card.
+func useFakeAudio(t *testing.T) *handlerstest.FakeAudio {
+	t.Helper()
+
+	speakers := handlerstest.Device("speakers", 50, 50)
+	speakers.Index = 1
+	speakers.Default = true
+	speakers.ActivePort = "analog-output-speaker"
+	speakers.Ports = []handlers.AudioPort{{Name: "analog-output-speaker"}, {Name: "analog-output-headphones"}}
+	hdmi := handlerstest.Device("hdmi", 100, 100)
+	hdmi.Index = 2
+	mic := handlerstest.Device("mic", 80)
+	mic.Index = 3
+	mic.Default = true
+
+	fake := &handlerstest.FakeAudio{
+		Sinks:      []handlers.AudioInfo{speakers, hdmi},
+		Sources:    []handlers.AudioInfo{mic},
+		SinkInputs: []handlers.AudioStream{handlerstest.Stream(handlers.StreamSinkInput, 12, speakers, 40, 40)},
+		SoundCards: []handlers.AudioCard{{
+			Name:          "card0",
+			ActiveProfile: "output:analog-stereo",
+			Profiles:      []handlers.CardProfile{{Name: "output:analog-stereo"}, {Name: "output:hdmi-stereo"}},
+		}},
+	}
+	return fake
+}
+
+// device returns a device of the fake backend by name.
+func device(t *testing.T, fake *handlerstest.FakeAudio, kind, name string) handlers.AudioInfo {
+	t.Helper()
+
+	devices, err := fake.Devices(kind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, device := range devices {
+		if device.Name == name {
+			return device
+		}
+	}
+	t.Fatalf("no %s %s", kind, name)
+	return handlers.AudioInfo{}
+}
+
+func TestAudioOutputs(t *testing.T) {
+	t.Parallel()
+
+	fake := useFakeAudio(t)
+	c := newClient(t, handlers.ScopeRead, handlers.Backends{Audio: fake})
+
+	outputs, err := c.AudioOutputs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 2 {
+		t.Fatalf("got %d outputs, want 2", len(outputs))
+	}
+	if outputs[0].Name != "speakers" || outputs[0].Volume != 50 || !outputs[0].Default {
+		t.Errorf("got output %+v, want default speakers at 50%%", outputs[0])
+	}
+	if len(outputs[0].Channels) != 2 || outputs[0].Channels[0].Channel != "front-left" {
+		t.Errorf("got channels %+v, want front-left and front-right", outputs[0].Channels)
+	}
+}
+
+func TestAudioActions(t *testing.T) {
+	t.Parallel()
+
+	fake := useFakeAudio(t)
+	c := newClient(t, handlers.ScopeWrite, handlers.Backends{Audio: fake})
+
+	response, err := c.AudioActions(context.Background(), []handlers.VolumeAction{
+		{Adjust: handlers.RelativeVolume(5), Port: "analog-output-headphones"},
+		{Device: "hdmi", Muted: handlers.ToggleMute(), Default: true},
+		{Type: "source", Adjust: handlers.RelativeVolume(-30)},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != handlers.ActionsStatusSuccess {
+		t.Fatalf("got status %s, want %s: %+v", response.Status, handlers.ActionsStatusSuccess, response.Results)
+	}
+
+	speakers := device(t, fake, "sink", "speakers")
+	if speakers.Volume != 55 || speakers.ActivePort != "analog-output-headphones" || speakers.Default {
+		t.Errorf("got speakers %+v, want 55%% on headphones, not default", speakers)
+	}
+	if hdmi := device(t, fake, "sink", "hdmi"); !hdmi.Mute || !hdmi.Default {
+		t.Errorf("got hdmi %+v, want muted default", hdmi)
+	}
+	if mic := device(t, fake, "source", "mic"); mic.Volume != 50 {
+		t.Errorf("got mic volume %d, want 50", mic.Volume)
+	}
+}
+
+func TestAudioActionsBalance(t *testing.T) {
+	t.Parallel()
+
+	fake := useFakeAudio(t)
+	c := newClient(t, handlers.ScopeWrite, handlers.Backends{Audio: fake})
+
+	balance := -0.5
+	if _, err := c.AudioActions(context.Background(), []handlers.VolumeAction{{Device: "hdmi", Balance: &balance}}, false); err != nil {
+		t.Fatal(err)
+	}
+	hdmi := device(t, fake, "sink", "hdmi")
+	if hdmi.Channels[0].Percent != 100 || hdmi.Channels[1].Percent != 50 || hdmi.Balance != -0.5 {
+		t.Errorf("got channels %+v and balance %g, want 100%%, 50%% and -0.5", hdmi.Channels, hdmi.Balance)
+	}
+}
+
+func TestAudioVolumeCeiling(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		name    string
+		options []handlers.Option
+		ceiling int
+	}{
+		{"default", nil, 150},
+		{"configured", []handlers.Option{handlers.WithVolumeCeiling(120)}, 120},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := useFakeAudio(t)
+			c, err := client.New(serve(t, handlers.ScopeWrite, handlers.NewServer(handlers.Backends{Audio: fake}, test.options...)).URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.AudioActions(context.Background(), []handlers.VolumeAction{
+				{Device: "hdmi", Adjust: handlers.AbsoluteVolume(200), AllowAbove100: true},
+				{Device: "speakers", Adjust: handlers.AbsoluteVolume(200)},
+			}, false); err != nil {
+				t.Fatal(err)
+			}
+			if hdmi := device(t, fake, "sink", "hdmi"); hdmi.Volume != test.ceiling {
+				t.Errorf("got hdmi at %d%%, want the ceiling of %d%%", hdmi.Volume, test.ceiling)
+			}
+			if speakers := device(t, fake, "sink", "speakers"); speakers.Volume != 100 {
+				t.Errorf("got speakers at %d%%, want 100%% without allowAbove100", speakers.Volume)
+			}
+		})
+	}
+}
+
+func TestAudioActionsInvalid(t *testing.T) {
+	t.Parallel()
+
+	fake := useFakeAudio(t)
+	c := newClient(t, handlers.ScopeWrite, handlers.Backends{Audio: fake})
+
+	response, err := c.AudioActions(context.Background(), []handlers.VolumeAction{
+		{Adjust: handlers.AbsoluteVolume(20)},
+		{Type: "speaker"},
+	}, false)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("got error %v, want 400", err)
+	}
+	if response.Results[1].Step != handlers.ActionStepValidate {
+		t.Errorf("got step %q, want %q", response.Results[1].Step, handlers.ActionStepValidate)
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("got calls %q, want none", calls)
+	}
+}
+
+func TestAudioActionsAtomicRollback(t *testing.T) {
+	t.Parallel()
+
+	fake := useFakeAudio(t)
+	fake.Fail("SetVolume", "hdmi", errors.New("connection refused"))
+	c := newClient(t, handlers.ScopeWrite, handlers.Backends{Audio: fake})
+
+	actions := []handlers.VolumeAction{
+		{Device: "speakers", Adjust: handlers.AbsoluteVolume(70), Muted: handlers.Mute(true)},
+		{Device: "hdmi", Adjust: handlers.AbsoluteVolume(30)},
+	}
+	response, err := c.AudioActions(context.Background(), actions, true)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("got error %v, want 500", err)
+	}
+	if !response.Results[0].RolledBack || response.Results[1].Step != handlers.ActionStepVolume {
+		t.Errorf("got results %+v, want the first rolled back and the second failed at volume", response.Results)
+	}
+	if speakers := device(t, fake, "sink", "speakers"); speakers.Volume != 50 || speakers.Mute {
+		t.Errorf("got speakers %+v, want restored to 50%% unmuted", speakers)
+	}
+
+	// Without atomic mode the first action stays applied.
+	response, err = c.AudioActions(context.Background(), actions, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Status != handlers.ActionsStatusPartial {
+		t.Errorf("got status %s, want %s", response.Status, handlers.ActionsStatusPartial)
+	}
+	if speakers := device(t, fake, "sink", "speakers"); speakers.Volume != 70 || !speakers.Mute {
+		t.Errorf("got speakers %+v, want muted at 70%%", speakers)
+	}
+}
+
+func TestAudioStreamActions(t *testing.T) {
+	t.Parallel()
+
+	fake := useFakeAudio(t)
+	c := newClient(t, handlers.ScopeWrite, handlers.Backends{Audio: fake})
+
+	response, err := c.AudioStreamActions(context.Background(), []handlers.StreamAction{
+		{Stream: 12, Adjust: handlers.RelativeVolume(10), MoveTo: "hdmi"},
+	}, true)
+	if err != nil {
+		t.Fatalf("%v: %+v", err, response.Results)
+	}
+
+	streams, err := c.AudioStreams(context.Background(), handlers.StreamSinkInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 1 || streams[0].Volume != 50 || streams[0].Device != "hdmi" || streams[0].DeviceIndex != 2 {
+		t.Errorf("got streams %+v, want stream 12 at 50%% on hdmi", streams)
+	}
+
+	// Moving to a missing sink fails and rolls the volume back.
+	response, err = c.AudioStreamActions(context.Background(), []handlers.StreamAction{
+		{Stream: 12, Adjust: handlers.AbsoluteVolume(20), MoveTo: "missing"},
+	}, true)
+	if err == nil || response.Results[0].Step != handlers.ActionStepMove {
+		t.Fatalf("got error %v and results %+v, want a failed move", err, response.Results)
+	}
+	if streams, _ := fake.Streams(handlers.StreamSinkInput); streams[0].Volume != 50 {
+		t.Errorf("got stream volume %d, want 50", streams[0].Volume)
+	}
+}
+
+func TestAudioCardActions(t *testing.T) {
+	t.Parallel()
+
+	fake := useFakeAudio(t)
+	c := newClient(t, handlers.ScopeWrite, handlers.Backends{Audio: fake})
+
+	response, err := c.AudioCardActions(context.Background(), []handlers.CardAction{
+		{Card: "card0", Profile: "output:hdmi-stereo"},
+		{Card: "card0", Profile: "a2dp-sink"},
+	}, true)
+	if err == nil || response.Results[1].Step != handlers.ActionStepProfile || !response.Results[0].RolledBack {
+		t.Fatalf("got error %v and results %+v, want the second action to fail and the first rolled back", err, response.Results)
+	}
+
+	cards, err := c.AudioCards(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cards[0].ActiveProfile != "output:analog-stereo" {
+		t.Errorf("got profile %s, want output:analog-stereo", cards[0].ActiveProfile)
+	}
+	want := []string{
+		"SetCardProfile card0 output:hdmi-stereo",
+		"SetCardProfile card0 a2dp-sink",
+		"SetCardProfile card0 output:analog-stereo",
+	}
+	if calls := fake.Calls(); len(calls) != len(want) || calls[0] != want[0] || calls[1] != want[1] || calls[2] != want[2] {
+		t.Errorf("got calls %q, want %q", calls, want)
+	}
+}
+
+func TestAudioActionsScope(t *testing.T) {
+	t.Parallel()
+
+	fake := useFakeAudio(t)
+	c := newClient(t, handlers.ScopeRead, handlers.Backends{Audio: fake})
+
+	_, err := c.AudioActions(context.Background(), []handlers.VolumeAction{{Adjust: handlers.AbsoluteVolume(20)}}, false)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("got error %v, want 403", err)
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("got calls %q, want none", calls)
+	}
+}
+
+func TestPactlError(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho 'Failure: No such entity' >&2\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(dir, "pactl"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+
+	err := handlers.NewPactlBackend().SetMute("sink", "missing", handlers.MuteValue{Muted: true})
+	if err == nil || !strings.Contains(err.Error(), "Failure: No such entity") {
+		t.Errorf("got error %v, want the message of pactl", err)
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultVolumeCeiling is the highest volume allowed with AllowAbove100 unless configured otherwise.
+	defaultVolumeCeiling = 150
+
+	// muteToggle is the JSON value of a MuteValue that inverts the mute state.
+	muteToggle = "toggle"
+)
+
+// VolumeValue is an absolute volume in percent or, when Relative is set, a change
+// of the current volume. In JSON it is a number or a string such as "50", "+5" or "-5".
+type VolumeValue struct {
+	Percent  int
+	Relative bool
+}
+
+// AbsoluteVolume returns a VolumeValue setting the volume to percent.
+func AbsoluteVolume(percent int) *VolumeValue {
+	return &VolumeValue{Percent: percent}
+}
+
+// RelativeVolume returns a VolumeValue changing the volume by delta percent.
+func RelativeVolume(delta int) *VolumeValue {
+	return &VolumeValue{Percent: delta, Relative: true}
+}
+
+// UnmarshalJSON accepts a number or a string with an optional sign and "%" suffix.
+func (v *VolumeValue) UnmarshalJSON(data []byte) error {
+	var number int
+	if err := json.Unmarshal(data, &number); err == nil {
+		*v = VolumeValue{Percent: number}
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("volume must be a number or a string like \"+5\": %s", data)
+	}
+
+	text = strings.TrimSuffix(strings.TrimSpace(text), "%")
+	percent, err := strconv.Atoi(text)
+	if err != nil {
+		return fmt.Errorf("invalid volume %q", text)
+	}
+	*v = VolumeValue{
+		Percent:  percent,
+		Relative: strings.HasPrefix(text, "+") || strings.HasPrefix(text, "-"),
+	}
+	return nil
+}
+
+// MarshalJSON writes absolute volumes as numbers and relative changes as signed strings.
+func (v VolumeValue) MarshalJSON() ([]byte, error) {
+	if !v.Relative {
+		return json.Marshal(v.Percent)
+	}
+	return json.Marshal(fmt.Sprintf("%+d", v.Percent))
+}
+
+// OpenAPISchema describes the JSON representation of a VolumeValue.
+func (VolumeValue) OpenAPISchema() map[string]any {
+	return map[string]any{
+		"oneOf": []any{
+			map[string]any{"type": "integer", "description": "Absolute volume in percent"},
+			map[string]any{"type": "string", "pattern": `^[+-]?\d+%?$`, "description": "Absolute volume, or relative change when signed"},
+		},
+	}
+}
+
+// MuteValue mutes, unmutes or toggles the mute state. In JSON it is true, false or "toggle".
+type MuteValue struct {
+	Muted  bool
+	Toggle bool
+}
+
+// Mute returns a MuteValue setting the mute state.
+func Mute(muted bool) *MuteValue {
+	return &MuteValue{Muted: muted}
+}
+
+// ToggleMute returns a MuteValue inverting the mute state.
+func ToggleMute() *MuteValue {
+	return &MuteValue{Toggle: true}
+}
+
+// UnmarshalJSON accepts a boolean or the string "toggle".
+func (m *MuteValue) UnmarshalJSON(data []byte) error {
+	var muted bool
+	if err := json.Unmarshal(data, &muted); err == nil {
+		*m = MuteValue{Muted: muted}
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil || text != muteToggle {
+		return fmt.Errorf("muted must be true, false or \"toggle\": %s", data)
+	}
+	*m = MuteValue{Toggle: true}
+	return nil
+}
+
+// MarshalJSON writes the mute state as a boolean or "toggle".
+func (m MuteValue) MarshalJSON() ([]byte, error) {
+	if m.Toggle {
+		return json.Marshal(muteToggle)
+	}
+	return json.Marshal(m.Muted)
+}
+
+// OpenAPISchema describes the JSON representation of a MuteValue.
+func (MuteValue) OpenAPISchema() map[string]any {
+	return map[string]any{
+		"oneOf": []any{
+			map[string]any{"type": "boolean"},
+			map[string]any{"type": "string", "enum": []string{muteToggle}},
+		},
+	}
+}
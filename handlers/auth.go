@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Scope is the level of access granted to a client.
+type Scope int
+
+const (
+	// ScopeNone grants no access at all.
+	ScopeNone Scope = iota
+	// ScopeRead allows reading device state.
+	ScopeRead
+	// ScopeWrite allows reading and changing device state.
+	ScopeWrite
+)
+
+// String returns the name of the scope as used in token files and flags.
+func (s Scope) String() string {
+	switch s {
+	case ScopeRead:
+		return "read"
+	case ScopeWrite:
+		return "write"
+	default:
+		return "none"
+	}
+}
+
+// ParseScope converts a scope name ("none", "read" or "write") into a Scope.
+func ParseScope(name string) (Scope, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "none":
+		return ScopeNone, nil
+	case "read":
+		return ScopeRead, nil
+	case "write":
+		return ScopeWrite, nil
+	default:
+		return ScopeNone, fmt.Errorf("unknown scope %q", name)
+	}
+}
+
+// AuthConfig configures how clients are authenticated.
+type AuthConfig struct {
+	// TokenFile is a file with one bearer token per line, optionally followed by its scope.
+	TokenFile string
+	// PeerUIDs are the users granted write access when connecting over a unix socket.
+	PeerUIDs []uint32
+	// Anonymous is the scope granted to TCP clients without a token.
+	Anonymous Scope
+}
+
+// Auth authenticates requests and enforces per-route scopes.
+type Auth struct {
+	tokens    []authToken
+	peerUIDs  map[uint32]struct{}
+	anonymous Scope
+}
+
+// authToken is a bearer token together with the scope it grants.
+type authToken struct {
+	value []byte
+	scope Scope
+}
+
+// connContextKey is the context key holding the client's net.Conn.
+type connContextKey struct{}
+
+// scopeContextKey is the context key holding the scope granted to a request.
+type scopeContextKey struct{}
+
+// NewAuth creates an Auth from the given configuration, loading the token file if set.
+func NewAuth(config AuthConfig) (*Auth, error) {
+	auth := &Auth{
+		peerUIDs:  make(map[uint32]struct{}, len(config.PeerUIDs)),
+		anonymous: config.Anonymous,
+	}
+
+	for _, uid := range config.PeerUIDs {
+		auth.peerUIDs[uid] = struct{}{}
+	}
+
+	if config.TokenFile != "" {
+		tokens, err := loadTokens(config.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		auth.tokens = tokens
+	}
+
+	return auth, nil
+}
+
+// loadTokens reads a token file. Each non-empty line that does not start with '#'
+// holds a token optionally followed by a scope; tokens without a scope grant write access.
+func loadTokens(path string) ([]authToken, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open token file: %w", err)
+	}
+	defer file.Close()
+
+	var tokens []authToken
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("token file line %d: expected \"<token> [scope]\"", lineNumber)
+		}
+
+		scope := ScopeWrite
+		if len(fields) == 2 {
+			if scope, err = ParseScope(fields[1]); err != nil {
+				return nil, fmt.Errorf("token file line %d: %w", lineNumber, err)
+			}
+		}
+
+		tokens = append(tokens, authToken{value: []byte(fields[0]), scope: scope})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read token file: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// ConnContext stores the client connection in the request context so Auth can
+// check unix socket peer credentials. Use it as http.Server.ConnContext.
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, conn)
+}
+
+// Require wraps a handler so it is only served to clients granted at least the given scope.
+func (a *Auth) Require(scope Scope, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		granted, err := a.authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="deviceapi"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if granted < scope {
+			if granted == ScopeNone {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="deviceapi"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), scopeContextKey{}, granted)))
+	})
+}
+
+// ScopeFromContext returns the scope granted to the request by Auth.Require,
+// or ScopeNone for requests that did not pass through it.
+func ScopeFromContext(ctx context.Context) Scope {
+	scope, _ := ctx.Value(scopeContextKey{}).(Scope)
+	return scope
+}
+
+// authenticate determines the scope granted to the client of a request.
+func (a *Auth) authenticate(r *http.Request) (Scope, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return ScopeNone, fmt.Errorf("unsupported authorization scheme")
+		}
+		return a.tokenScope(strings.TrimSpace(token))
+	}
+
+	if conn, ok := r.Context().Value(connContextKey{}).(*net.UnixConn); ok {
+		uid, err := peerUID(conn)
+		if err != nil {
+			return ScopeNone, fmt.Errorf("could not check peer credentials: %w", err)
+		}
+		if _, ok := a.peerUIDs[uid]; !ok {
+			return ScopeNone, fmt.Errorf("uid %d is not allowed", uid)
+		}
+		return ScopeWrite, nil
+	}
+
+	return a.anonymous, nil
+}
+
+// tokenScope looks up the scope of a bearer token in constant time.
+func (a *Auth) tokenScope(token string) (Scope, error) {
+	scope := ScopeNone
+	found := false
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(t.value, []byte(token)) == 1 {
+			scope = t.scope
+			found = true
+		}
+	}
+	if !found {
+		return ScopeNone, fmt.Errorf("invalid token")
+	}
+	return scope, nil
+}
@@ -0,0 +1,86 @@
+//go:build linux
+
+package handlers_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/giftpilz0/sysutil/handlers"
+)
+
+func TestAuthPeerCredentials(t *testing.T) {
+	uid := uint32(os.Getuid())
+	tests := []struct {
+		name    string
+		uids    []uint32
+		token   string
+		status  int
+		granted string
+	}{
+		{"allowed uid", []uint32{uid + 1, uid}, "", http.StatusOK, "write"},
+		{"other uid", []uint32{uid + 1}, "", http.StatusUnauthorized, ""},
+		{"token before the uid", []uint32{uid}, "readtoken", http.StatusOK, "read"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Anonymous clients would get write access, but unix socket clients
+			// are only ever checked by uid.
+			auth, err := handlers.NewAuth(handlers.AuthConfig{
+				TokenFile: tokenFile(t, "readtoken read\n"),
+				PeerUIDs:  test.uids,
+				Anonymous: handlers.ScopeWrite,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(t.TempDir(), "deviceapi.sock")
+			listener, err := net.Listen("unix", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			server := httptest.NewUnstartedServer(auth.Require(handlers.ScopeRead, scopeHandler))
+			server.Listener.Close()
+			server.Listener = listener
+			server.Config.ConnContext = handlers.ConnContext
+			server.Start()
+			t.Cleanup(server.Close)
+
+			httpClient := &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return new(net.Dialer).DialContext(ctx, "unix", path)
+				},
+			}}
+			request, err := http.NewRequest(http.MethodGet, "http://localhost/battery", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.token != "" {
+				request.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			resp, err := httpClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != test.status {
+				t.Fatalf("got status %d (%s), want %d", resp.StatusCode, body, test.status)
+			}
+			if test.status == http.StatusOK && string(body) != test.granted {
+				t.Errorf("got scope %s, want %s", body, test.granted)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/giftpilz0/sysutil/handlers"
+)
+
+// tokenFile writes a token file and returns its path.
+func tokenFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// scopeHandler answers with the scope Auth.Require granted.
+var scopeHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(handlers.ScopeFromContext(r.Context()).String()))
+})
+
+func TestTokenFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"scopes", "# tokens\n\nreadtoken read\n  writetoken   write  \ndefaulttoken\nnonetoken none\n", ""},
+		{"unknown scope", "token admin\n", `token file line 1: unknown scope "admin"`},
+		{"too many fields", "# comment\ntoken read write\n", `token file line 2: expected "<token> [scope]"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := handlers.NewAuth(handlers.AuthConfig{TokenFile: tokenFile(t, test.content)})
+			if test.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if test.err != "" && (err == nil || err.Error() != test.err) {
+				t.Fatalf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+
+	if _, err := handlers.NewAuth(handlers.AuthConfig{TokenFile: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("got no error for a missing token file")
+	}
+}
+
+func TestAuthRequire(t *testing.T) {
+	tokens := tokenFile(t, "readtoken read\nwritetoken\nnonetoken none\n")
+	tests := []struct {
+		name          string
+		anonymous     handlers.Scope
+		scope         handlers.Scope
+		authorization string
+		status        int
+		granted       string
+	}{
+		{"read token on a read route", handlers.ScopeNone, handlers.ScopeRead, "Bearer readtoken", http.StatusOK, "read"},
+		{"read token on a write route", handlers.ScopeNone, handlers.ScopeWrite, "Bearer readtoken", http.StatusForbidden, ""},
+		{"write token without a scope", handlers.ScopeNone, handlers.ScopeWrite, "Bearer writetoken", http.StatusOK, "write"},
+		{"token without access", handlers.ScopeWrite, handlers.ScopeRead, "Bearer nonetoken", http.StatusUnauthorized, ""},
+		{"wrong token", handlers.ScopeWrite, handlers.ScopeRead, "Bearer readtoken2", http.StatusUnauthorized, ""},
+		{"other scheme", handlers.ScopeWrite, handlers.ScopeRead, "Basic cmVhZHRva2Vu", http.StatusUnauthorized, ""},
+		{"missing token", handlers.ScopeNone, handlers.ScopeRead, "", http.StatusUnauthorized, ""},
+		{"anonymous read", handlers.ScopeRead, handlers.ScopeRead, "", http.StatusOK, "read"},
+		{"anonymous read on a write route", handlers.ScopeRead, handlers.ScopeWrite, "", http.StatusForbidden, ""},
+		{"anonymous write", handlers.ScopeWrite, handlers.ScopeWrite, "", http.StatusOK, "write"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth, err := handlers.NewAuth(handlers.AuthConfig{TokenFile: tokens, Anonymous: test.anonymous})
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := httptest.NewRequest(http.MethodGet, "/battery", nil)
+			if test.authorization != "" {
+				request.Header.Set("Authorization", test.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			auth.Require(test.scope, scopeHandler).ServeHTTP(recorder, request)
+
+			if recorder.Code != test.status {
+				t.Fatalf("got status %d, want %d", recorder.Code, test.status)
+			}
+			if test.status == http.StatusOK && recorder.Body.String() != test.granted {
+				t.Errorf("got scope %s, want %s", recorder.Body, test.granted)
+			}
+			challenged := recorder.Header().Get("WWW-Authenticate") != ""
+			if challenged != (test.status == http.StatusUnauthorized) {
+				t.Errorf("got WWW-Authenticate %q with status %d", recorder.Header().Get("WWW-Authenticate"), recorder.Code)
+			}
+		})
+	}
+}
+
+func TestJSONContentType(t *testing.T) {
+	t.Parallel()
+
+	fake := useFakeAudio(t)
+	network := useFakeNetwork(t)
+	server := newServer(t, handlers.ScopeWrite, handlers.Backends{Audio: fake, Network: network})
+
+	for _, test := range []struct {
+		path, body, contentType string
+		status                  int
+	}{
+		{"/audio/actions", `[{"device":"hdmi","adjust":20}]`, "text/plain", http.StatusUnsupportedMediaType},
+		{"/audio/actions", `[{"device":"hdmi","adjust":20}]`, "", http.StatusUnsupportedMediaType},
+		{"/network/vpn/up", `{"connection":"corp"}`, "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"/audio/actions", `[{"device":"hdmi","adjust":20}]`, "application/json; charset=utf-8", http.StatusOK},
+	} {
+		request, err := http.NewRequest(http.MethodPost, server.URL+test.path, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.contentType != "" {
+			request.Header.Set("Content-Type", test.contentType)
+		}
+		resp, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("got status %d posting %q to %s, want %d", resp.StatusCode, test.contentType, test.path, test.status)
+		}
+	}
+
+	want := []string{"SetVolume hdmi sink 20"}
+	if calls := fake.Calls(); len(calls) != 1 || calls[0] != want[0] {
+		t.Errorf("got calls %q, want %q", calls, want)
+	}
+	if calls := network.Calls(); len(calls) != 0 {
+		t.Errorf("got network calls %q, want none", calls)
+	}
+}
@@ -1,7 +1,11 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"math"
+	"time"
 
 	"github.com/godbus/dbus/v5"
 )
@@ -9,16 +13,71 @@ import (
 const (
 	upowerService         = "org.freedesktop.UPower"
 	upowerPath            = "/org/freedesktop/UPower"
+	upowerInterface       = "org.freedesktop.UPower"
 	upowerDeviceInterface = "org.freedesktop.UPower.Device"
 
 	// UPower device type for battery.
-	batteryDeviceType int32 = 2
+	batteryDeviceType uint32 = 2
 )
 
-// Battery holds battery status information.
+// powerDeviceTypes are the names of the UPower device types, indexed by type.
+var powerDeviceTypes = []string{
+	"unknown", "line-power", "battery", "ups", "monitor", "mouse", "keyboard", "pda", "phone",
+	"media-player", "tablet", "computer", "gaming-input", "pen", "touchpad", "modem", "network",
+	"headset", "speakers", "headphones", "video", "other-audio", "remote-control", "printer",
+	"scanner", "camera", "wearable", "toy", "bluetooth-generic",
+}
+
+// Battery holds the battery status of the system and every power device.
+// Percentage and State are those of the display device, and empty when the
+// system has no battery.
 type Battery struct {
-	Percentage float64 `json:"percentage"`
-	State      string  `json:"state"`
+	Percentage float64       `json:"percentage"`
+	State      string        `json:"state"`
+	Display    *PowerDevice  `json:"display,omitempty"` // combined state of the batteries powering the system
+	Devices    []PowerDevice `json:"devices"`
+}
+
+// PowerDevice is a device known to UPower: a battery, the line power supply, a
+// UPS or the battery of a peripheral such as a mouse or headset.
+type PowerDevice struct {
+	Path        string  `json:"path"`       // UPower object path
+	NativePath  string  `json:"nativePath"` // e.g. "BAT0" or the sysfs path of the device
+	Type        string  `json:"type"`       // e.g. "battery", "line-power", "mouse", "headset"
+	Model       string  `json:"model"`
+	Vendor      string  `json:"vendor"`
+	Serial      string  `json:"serial,omitempty"`
+	PowerSupply bool    `json:"powerSupply"` // powers the system, as opposed to a peripheral
+	Present     bool    `json:"present"`
+	Online      bool    `json:"online,omitempty"` // line power connected
+	Percentage  float64 `json:"percentage"`
+	State       string  `json:"state"`
+
+	// Telemetry of batteries, zero when the device does not report it.
+	TimeToEmpty      int64   `json:"timeToEmpty,omitempty"` // seconds until empty while discharging
+	TimeToFull       int64   `json:"timeToFull,omitempty"`  // seconds until full while charging
+	EnergyRate       float64 `json:"energyRate,omitempty"`  // W, drawn or charged
+	Energy           float64 `json:"energy,omitempty"`      // Wh
+	EnergyFull       float64 `json:"energyFull,omitempty"`  // Wh when full now
+	EnergyFullDesign float64 `json:"energyFullDesign,omitempty"`
+	Voltage          float64 `json:"voltage,omitempty"`      // V
+	Temperature      float64 `json:"temperature,omitempty"`  // °C
+	ChargeCycles     int     `json:"chargeCycles,omitempty"` // omitted when unknown
+	Capacity         float64 `json:"capacity,omitempty"`     // health in percent, EnergyFull of EnergyFullDesign
+
+	// Charge thresholds stop charging between the start and end percentages when enabled.
+	ChargeThresholdSupported bool   `json:"chargeThresholdSupported,omitempty"`
+	ChargeThresholdEnabled   bool   `json:"chargeThresholdEnabled,omitempty"`
+	ChargeStartThreshold     uint32 `json:"chargeStartThreshold,omitempty"`
+	ChargeEndThreshold       uint32 `json:"chargeEndThreshold,omitempty"`
+}
+
+// PowerDeviceTypeToString converts a UPower device type into its name.
+func PowerDeviceTypeToString(deviceType uint32) string {
+	if int(deviceType) < len(powerDeviceTypes) {
+		return powerDeviceTypes[deviceType]
+	}
+	return "unknown"
 }
 
 // BatteryStateToString converts a battery state (integer) into a human‑readable string.
@@ -43,11 +102,47 @@ func BatteryStateToString(state int32) string {
 	}
 }
 
-// GetBatteryStatus retrieves battery information using UPower via DBus.
-func GetBatteryStatus() (Battery, error) {
+// PowerBackend reads the battery state and changes the power settings, from
+// UPower and power-profiles-daemon by default.
+type PowerBackend interface {
+	// Battery returns the state of the system battery and every power device.
+	Battery() (Battery, error)
+	// History returns the history UPower keeps for each device over timespan,
+	// with about resolution points per history, skipping devices failing to report it.
+	History(timespan time.Duration, resolution uint32) ([]PowerDeviceHistory, error)
+
+	PowerProfiles() (PowerProfiles, error)
+	SetPowerProfile(profile string) error
+	// SetChargeThreshold enables or disables the charge thresholds of the device
+	// with the given UPower object path.
+	SetChargeThreshold(device string, enabled bool) error
+	// Subscribe calls changed whenever the power state may have changed, until ctx
+	// is cancelled or the connection fails.
+	Subscribe(ctx context.Context, changed func()) error
+}
+
+// systemPowerBackend queries UPower and power-profiles-daemon over DBus.
+type systemPowerBackend struct {
+	conn *dbus.Conn
+}
+
+// NewSystemPowerBackend creates a power backend talking to UPower and
+// power-profiles-daemon on conn, or on the shared system bus connection when
+// conn is nil.
+func NewSystemPowerBackend(conn *dbus.Conn) PowerBackend {
+	return systemPowerBackend{conn: conn}
+}
+
+// GetBatteryStatus retrieves battery information from the power backend.
+func (s *Server) GetBatteryStatus() (Battery, error) {
+	return s.Power.Battery()
+}
+
+// Battery retrieves every power device and the display device using UPower via DBus.
+func (b systemPowerBackend) Battery() (Battery, error) {
 	var battery Battery
 
-	conn, err := dbus.SystemBus()
+	conn, err := busConn(b.conn)
 	if err != nil {
 		return battery, fmt.Errorf("failed to connect to system DBus for battery: %w", err)
 	}
@@ -56,63 +151,171 @@ func GetBatteryStatus() (Battery, error) {
 
 	// Enumerate UPower devices.
 	var devicePaths []dbus.ObjectPath
-	if err = upowerObj.Call("org.freedesktop.UPower.EnumerateDevices", 0).Store(&devicePaths); err != nil {
+	if err = upowerObj.Call(upowerInterface+".EnumerateDevices", 0).Store(&devicePaths); err != nil {
 		return battery, fmt.Errorf("failed to enumerate UPower devices: %w", err)
 	}
 
+	battery.Devices = make([]PowerDevice, 0, len(devicePaths))
 	for _, path := range devicePaths {
-		devObj := conn.Object(upowerService, path)
-
-		// Retrieve the device type.
-		typeVar, err := GetProperty(devObj, upowerDeviceInterface, "Type")
+		// Skip devices removed since they were enumerated.
+		device, err := powerDevice(conn, path)
 		if err != nil {
 			continue
 		}
+		battery.Devices = append(battery.Devices, device)
+	}
 
-		var devType int32
-		switch t := typeVar.Value().(type) {
-		case int32:
-			devType = t
-		case uint32:
-			devType = int32(t)
-		default:
-			continue
+	// The display device combines the batteries powering the system. Versions of
+	// UPower without it get the first of these batteries instead.
+	var displayPath dbus.ObjectPath
+	if err := upowerObj.Call(upowerInterface+".GetDisplayDevice", 0).Store(&displayPath); err == nil {
+		if display, err := powerDevice(conn, displayPath); err == nil {
+			battery.Display = &display
+		}
+	}
+	if battery.Display == nil {
+		for i, device := range battery.Devices {
+			if device.Type == powerDeviceTypes[batteryDeviceType] && device.PowerSupply {
+				battery.Display = &battery.Devices[i]
+				break
+			}
 		}
+	}
 
-		// Check if the device is a battery.
-		if devType != batteryDeviceType {
+	if battery.Display != nil && battery.Display.Present {
+		battery.Percentage = battery.Display.Percentage
+		battery.State = battery.Display.State
+	}
+	return battery, nil
+}
+
+// powerDevice reads the properties of a UPower device.
+func powerDevice(conn *dbus.Conn, path dbus.ObjectPath) (PowerDevice, error) {
+	props, err := GetAllProperties(conn.Object(upowerService, path), upowerDeviceInterface)
+	if err != nil {
+		return PowerDevice{}, fmt.Errorf("failed to get properties of %s: %w", path, err)
+	}
+
+	return PowerDevice{
+		Path:        string(path),
+		NativePath:  stringProperty(props, "NativePath"),
+		Type:        PowerDeviceTypeToString(uint32(intProperty(props, "Type"))),
+		Model:       stringProperty(props, "Model"),
+		Vendor:      stringProperty(props, "Vendor"),
+		Serial:      stringProperty(props, "Serial"),
+		PowerSupply: boolProperty(props, "PowerSupply"),
+		Present:     boolProperty(props, "IsPresent"),
+		Online:      boolProperty(props, "Online"),
+		Percentage:  floatProperty(props, "Percentage"),
+		State:       BatteryStateToString(int32(intProperty(props, "State"))),
+
+		TimeToEmpty:      intProperty(props, "TimeToEmpty"),
+		TimeToFull:       intProperty(props, "TimeToFull"),
+		EnergyRate:       floatProperty(props, "EnergyRate"),
+		Energy:           floatProperty(props, "Energy"),
+		EnergyFull:       floatProperty(props, "EnergyFull"),
+		EnergyFullDesign: floatProperty(props, "EnergyFullDesign"),
+		Voltage:          floatProperty(props, "Voltage"),
+		Temperature:      floatProperty(props, "Temperature"),
+		// UPower reports -1 when the number of cycles is unknown.
+		ChargeCycles: max(int(intProperty(props, "ChargeCycles")), 0),
+		Capacity:     floatProperty(props, "Capacity"),
+
+		ChargeThresholdSupported: boolProperty(props, "ChargeThresholdSupported"),
+		ChargeThresholdEnabled:   boolProperty(props, "ChargeThresholdEnabled"),
+		ChargeStartThreshold:     uint32(intProperty(props, "ChargeStartThreshold")),
+		ChargeEndThreshold:       uint32(intProperty(props, "ChargeEndThreshold")),
+	}, nil
+}
+
+// History reads the charge and rate history and the statistics of every device
+// supporting them using UPower via DBus.
+func (b systemPowerBackend) History(timespan time.Duration, resolution uint32) ([]PowerDeviceHistory, error) {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to system DBus for battery history: %w", err)
+	}
+
+	var devicePaths []dbus.ObjectPath
+	if err := conn.Object(upowerService, upowerPath).Call(upowerInterface+".EnumerateDevices", 0).Store(&devicePaths); err != nil {
+		return nil, fmt.Errorf("failed to enumerate UPower devices: %w", err)
+	}
+
+	histories := []PowerDeviceHistory{}
+	for _, path := range devicePaths {
+		devObj := conn.Object(upowerService, path)
+		props, err := GetAllProperties(devObj, upowerDeviceInterface)
+		if err != nil || !boolProperty(props, "HasHistory") {
 			continue
 		}
 
-		// Retrieve battery percentage.
-		percVar, err := GetProperty(devObj, upowerDeviceInterface, "Percentage")
-		if err != nil {
-			return battery, fmt.Errorf("failed to get battery percentage: %w", err)
+		// A device failing to report its history is skipped, the others are still returned.
+		history := PowerDeviceHistory{Path: string(path), NativePath: stringProperty(props, "NativePath")}
+		if history.Charge, err = upowerHistory(devObj, "charge", timespan, resolution); err != nil {
+			log.Printf("Skipping UPower history: %v", err)
+			continue
 		}
-		percentage, ok := percVar.Value().(float64)
-		if !ok {
+		if history.Rate, err = upowerHistory(devObj, "rate", timespan, resolution); err != nil {
+			log.Printf("Skipping UPower history: %v", err)
 			continue
 		}
-
-		// Retrieve battery state.
-		stateVar, err := GetProperty(devObj, upowerDeviceInterface, "State")
-		if err != nil {
-			return battery, fmt.Errorf("failed to get battery state: %w", err)
+		if boolProperty(props, "HasStatistics") {
+			if history.ChargingStatistics, err = upowerStatistics(devObj, "charging"); err != nil {
+				log.Printf("Skipping UPower history: %v", err)
+				continue
+			}
+			if history.DischargeStatistics, err = upowerStatistics(devObj, "discharging"); err != nil {
+				log.Printf("Skipping UPower history: %v", err)
+				continue
+			}
 		}
-		var stateInt int32
-		switch s := stateVar.Value().(type) {
-		case int32:
-			stateInt = s
-		case uint32:
-			stateInt = int32(s)
-		default:
-			stateInt = 0
+		histories = append(histories, history)
+	}
+	return histories, nil
+}
+
+// upowerHistory calls GetHistory on a device for a kind of history, "charge" or "rate".
+func upowerHistory(devObj dbus.BusObject, kind string, timespan time.Duration, resolution uint32) ([]HistoryPoint, error) {
+	var items []struct {
+		Time  uint32
+		Value float64
+		State uint32
+	}
+	seconds := uint32(min(max(timespan/time.Second, 0), math.MaxUint32))
+	call := devObj.Call(upowerDeviceInterface+".GetHistory", 0, kind, seconds, resolution)
+	if err := call.Store(&items); err != nil {
+		return nil, fmt.Errorf("failed to get %s history of %s: %w", kind, devObj.Path(), err)
+	}
+
+	points := make([]HistoryPoint, len(items))
+	for i, item := range items {
+		points[i] = HistoryPoint{
+			Time:  time.Unix(int64(item.Time), 0).UTC(),
+			Value: item.Value,
+			State: BatteryStateToString(int32(item.State)),
 		}
+	}
+	return points, nil
+}
 
-		battery.Percentage = percentage
-		battery.State = BatteryStateToString(stateInt)
-		return battery, nil
+// upowerStatistics calls GetStatistics on a device for "charging" or "discharging".
+func upowerStatistics(devObj dbus.BusObject, kind string) ([]StatisticPoint, error) {
+	var items []struct {
+		Value    float64
+		Accuracy float64
+	}
+	if err := devObj.Call(upowerDeviceInterface+".GetStatistics", 0, kind).Store(&items); err != nil {
+		return nil, fmt.Errorf("failed to get %s statistics of %s: %w", kind, devObj.Path(), err)
 	}
 
-	return battery, nil
+	points := make([]StatisticPoint, len(items))
+	for i, item := range items {
+		points[i] = StatisticPoint{Value: item.Value, Accuracy: item.Accuracy}
+	}
+	return points, nil
+}
+
+// Subscribe listens for signals from UPower, mostly PropertiesChanged on the devices.
+func (b systemPowerBackend) Subscribe(ctx context.Context, changed func()) error {
+	return watchSignals(ctx, b.conn, upowerService, upowerPath, changed)
 }
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultHistorySince is how far back /battery/history looks without ?since=.
+	defaultHistorySince = 24 * time.Hour
+
+	// defaultHistoryResolution is the number of points requested from UPower without ?step=.
+	defaultHistoryResolution = 150
+)
+
+// BatterySample is the state of the system battery at a point in time.
+type BatterySample struct {
+	Time       time.Time `json:"time"`
+	Percentage float64   `json:"percentage"`
+	EnergyRate float64   `json:"energyRate"` // W
+	State      string    `json:"state"`
+}
+
+// BatteryHistoryResponse holds the samples recorded by deviceapi and the history
+// and statistics kept by UPower.
+type BatteryHistoryResponse struct {
+	Samples []BatterySample      `json:"samples"` // empty unless deviceapi records the history
+	UPower  []PowerDeviceHistory `json:"upower"`  // empty when UPower failed
+
+	// UPowerError tells why UPower's history is missing.
+	UPowerError string `json:"upowerError,omitempty"`
+}
+
+// PowerDeviceHistory is the history UPower keeps for a device, with its
+// statistics about charge and discharge speed.
+type PowerDeviceHistory struct {
+	Path                string           `json:"path"`
+	NativePath          string           `json:"nativePath"`
+	Charge              []HistoryPoint   `json:"charge"`                        // percentage
+	Rate                []HistoryPoint   `json:"rate"`                          // W
+	ChargingStatistics  []StatisticPoint `json:"chargingStatistics,omitempty"`  // by percentage
+	DischargeStatistics []StatisticPoint `json:"dischargeStatistics,omitempty"` // by percentage
+}
+
+// HistoryPoint is a value of a UPower history.
+type HistoryPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+	State string    `json:"state"`
+}
+
+// StatisticPoint is a UPower statistic, a correction factor for the time
+// estimates at a given percentage, with its accuracy in percent.
+type StatisticPoint struct {
+	Value    float64 `json:"value"`
+	Accuracy float64 `json:"accuracy"`
+}
+
+// BatteryHistory is a file based time series of battery samples. The file holds
+// one JSON sample per line, oldest first.
+type BatteryHistory struct {
+	path      string
+	retention time.Duration
+
+	mu      sync.Mutex
+	samples []BatterySample
+	dropped int // samples still in the file but older than retention
+}
+
+// OpenBatteryHistory loads the samples of a history file younger than retention,
+// creating the file if needed.
+func OpenBatteryHistory(path string, retention time.Duration) (*BatteryHistory, error) {
+	h := &BatteryHistory{path: path, retention: retention}
+
+	file, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to open battery history: %w", err)
+	}
+	if file != nil {
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var sample BatterySample
+			// Skip lines truncated by a crash while appending.
+			if err := json.Unmarshal(scanner.Bytes(), &sample); err == nil {
+				h.samples = append(h.samples, sample)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read battery history: %w", err)
+		}
+	}
+
+	h.prune(time.Now())
+	if err := h.compact(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Add appends a sample to the history.
+func (h *BatteryHistory) Add(sample BatterySample) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	line, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open battery history: %w", err)
+	}
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write battery history: %w", err)
+	}
+
+	h.samples = append(h.samples, sample)
+	h.prune(sample.Time)
+
+	// Rewrite the file once most of it is expired.
+	if h.dropped > len(h.samples) {
+		return h.compact()
+	}
+	return nil
+}
+
+// prune forgets samples older than retention. It must be called with h.mu held.
+func (h *BatteryHistory) prune(now time.Time) {
+	cutoff := now.Add(-h.retention)
+	expired := 0
+	for expired < len(h.samples) && h.samples[expired].Time.Before(cutoff) {
+		expired++
+	}
+	h.samples = h.samples[expired:]
+	h.dropped += expired
+}
+
+// compact rewrites the file with the retained samples only. It must be called
+// with h.mu held, or before h is shared.
+func (h *BatteryHistory) compact() error {
+	temp, err := os.CreateTemp(filepath.Dir(h.path), filepath.Base(h.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to compact battery history: %w", err)
+	}
+	defer os.Remove(temp.Name())
+
+	writer := bufio.NewWriter(temp)
+	encoder := json.NewEncoder(writer)
+	for _, sample := range h.samples {
+		encoder.Encode(sample)
+	}
+	err = writer.Flush()
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), h.path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to compact battery history: %w", err)
+	}
+
+	h.dropped = 0
+	return nil
+}
+
+// Samples returns the samples taken since a time. With a step, samples are
+// averaged over intervals of that length, each reported at the start of its
+// interval with the last state seen in it.
+func (h *BatteryHistory) Samples(since time.Time, step time.Duration) []BatterySample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	samples := []BatterySample{}
+	var count int
+	for _, sample := range h.samples {
+		if sample.Time.Before(since) {
+			continue
+		}
+		if step <= 0 {
+			samples = append(samples, sample)
+			continue
+		}
+
+		start := since.Add(sample.Time.Sub(since) / step * step)
+		last := len(samples) - 1
+		if last < 0 || !samples[last].Time.Equal(start) {
+			samples = append(samples, BatterySample{Time: start, Percentage: sample.Percentage, EnergyRate: sample.EnergyRate, State: sample.State})
+			count = 1
+			continue
+		}
+
+		// Running averages of the interval.
+		count++
+		samples[last].Percentage += (sample.Percentage - samples[last].Percentage) / float64(count)
+		samples[last].EnergyRate += (sample.EnergyRate - samples[last].EnergyRate) / float64(count)
+		samples[last].State = sample.State
+	}
+	return samples
+}
+
+// Record adds a sample of the system battery read from power every interval until
+// ctx is cancelled. Nothing is recorded while the system has no battery.
+func (h *BatteryHistory) Record(ctx context.Context, power PowerBackend, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		battery, err := power.Battery()
+		if err != nil {
+			log.Printf("Failed to sample battery for history: %v", err)
+		} else if battery.Display != nil && battery.State != "" {
+			sample := BatterySample{
+				Time:       time.Now().UTC().Truncate(time.Second),
+				Percentage: battery.Percentage,
+				EnergyRate: battery.Display.EnergyRate,
+				State:      battery.State,
+			}
+			if err := h.Add(sample); err != nil {
+				log.Printf("Failed to record battery history: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GetBatteryHistory returns the recorded samples since a time, averaged over
+// step if set, and the history UPower keeps for the same period. The samples are
+// returned even when UPower fails, with the error in UPowerError.
+func (s *Server) GetBatteryHistory(since time.Time, step time.Duration) BatteryHistoryResponse {
+	response := BatteryHistoryResponse{Samples: []BatterySample{}, UPower: []PowerDeviceHistory{}}
+	if s.History != nil {
+		response.Samples = s.History.Samples(since, step)
+	}
+
+	timespan := max(time.Since(since), 0)
+	resolution := uint32(defaultHistoryResolution)
+	if step > 0 {
+		resolution = uint32(min(max(timespan/step, 1), math.MaxUint32))
+	}
+	history, err := s.Power.History(timespan, resolution)
+	if err != nil {
+		log.Printf("Failed to get UPower history: %v", err)
+		response.UPowerError = err.Error()
+		return response
+	}
+	response.UPower = history
+	return response
+}
+
+// parseHistorySince parses ?since= as a time in RFC 3339 format, not after now,
+// or a duration before now, e.g. "12h".
+func parseHistorySince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return now.Add(-defaultHistorySince), nil
+	}
+	if since, err := time.Parse(time.RFC3339, value); err == nil {
+		if since.After(now) {
+			return time.Time{}, fmt.Errorf("invalid since %q, the time is in the future", value)
+		}
+		return since, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return time.Time{}, fmt.Errorf("invalid since %q, expected a time like 2006-01-02T15:04:05Z or a duration like 12h", value)
+	}
+	return now.Add(-duration), nil
+}
@@ -0,0 +1,108 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/giftpilz0/sysutil/client"
+	"github.com/giftpilz0/sysutil/handlers"
+	"github.com/giftpilz0/sysutil/handlers/handlerstest"
+)
+
+func TestBatteryHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "battery.jsonl")
+	history, err := handlers.OpenBatteryHistory(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := range 10 {
+		sample := handlers.BatterySample{Time: start.Add(time.Duration(i) * 10 * time.Minute), Percentage: float64(90 - i), EnergyRate: 8, State: "Discharging"}
+		if err := history.Add(sample); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Samples older than an hour before the last one are expired.
+	samples := history.Samples(start, 0)
+	if len(samples) != 7 || samples[0].Percentage != 87 {
+		t.Fatalf("got %d samples starting with %+v, want 7 starting at 87%%", len(samples), samples[0])
+	}
+
+	averaged := history.Samples(start.Add(time.Hour), 30*time.Minute)
+	if len(averaged) != 2 || averaged[0].Percentage != 83 || averaged[1].Percentage != 81 || !averaged[1].Time.Equal(start.Add(90*time.Minute)) {
+		t.Errorf("got %+v, want averages of 83%% and 81%% at 13:00 and 13:30", averaged)
+	}
+
+	// Reopening loads the samples back, including those not yet compacted away,
+	// and drops them once expired.
+	reopened, err := handlers.OpenBatteryHistory(path, 100*365*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.Samples(start, 0); len(got) != 10 {
+		t.Errorf("got %d samples after reopening, want 10", len(got))
+	}
+	reopened, err = handlers.OpenBatteryHistory(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.Samples(start, 0); len(got) != 0 {
+		t.Errorf("got %d samples after reopening with a short retention, want none", len(got))
+	}
+}
+
+func TestBatteryHistoryEndpoint(t *testing.T) {
+	history, err := handlers.OpenBatteryHistory(filepath.Join(t.TempDir(), "battery.jsonl"), 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	history.Add(handlers.BatterySample{Time: now.Add(-3 * time.Hour), Percentage: 80, State: "Discharging"})
+	history.Add(handlers.BatterySample{Time: now.Add(-time.Hour), Percentage: 60, State: "Discharging"})
+
+	fake := handlerstest.NewFakePower(handlers.Battery{})
+	fake.SetHistory([]handlers.PowerDeviceHistory{{NativePath: "BAT0", Charge: []handlers.HistoryPoint{{Time: now, Value: 60, State: "Discharging"}}}})
+	server := newServer(t, handlers.ScopeRead, handlers.Backends{Power: fake, History: history})
+	c, err := client.New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := c.BatteryHistory(context.Background(), now.Add(-2*time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Samples) != 1 || response.Samples[0].Percentage != 60 {
+		t.Errorf("got samples %+v, want the one at 60%%", response.Samples)
+	}
+	if len(response.UPower) != 1 || response.UPower[0].Charge[0].Value != 60 {
+		t.Errorf("got UPower history %+v, want the one of BAT0", response.UPower)
+	}
+
+	fake.Set(handlers.Battery{}, errors.New("UPower is not running"))
+	response, err = c.BatteryHistory(context.Background(), now.Add(-2*time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Samples) != 1 || len(response.UPower) != 0 || response.UPowerError != "UPower is not running" {
+		t.Errorf("got history %+v with a failing UPower, want the sample and the error", response)
+	}
+
+	for _, since := range []string{"yesterday", now.Add(time.Hour).Format(time.RFC3339)} {
+		resp, err := http.Get(server.URL + "/battery/history?since=" + url.QueryEscape(since))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("got status %d for since %s, want 400", resp.StatusCode, since)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	bluezService           = "org.bluez"
+	bluezAdapterInterface  = "org.bluez.Adapter1"
+	bluezDeviceInterface   = "org.bluez.Device1"
+	bluezBatteryInterface  = "org.bluez.Battery1"
+	objectManagerInterface = "org.freedesktop.DBus.ObjectManager"
+)
+
+// bluetoothDiscoveryLength is how long discovery runs unless the request says otherwise.
+const bluetoothDiscoveryLength = 30 * time.Second
+
+// ErrInvalidBluetoothRequest is returned when a Bluetooth change names an unknown
+// adapter or device, or an adapter that is powered off.
+var ErrInvalidBluetoothRequest = errors.New("invalid bluetooth request")
+
+// Bluetooth holds the Bluetooth adapters and the devices they know.
+type Bluetooth struct {
+	Adapters []BluetoothAdapter `json:"adapters"`
+	Devices  []BluetoothDevice  `json:"devices"`
+}
+
+// BluetoothAdapter is a Bluetooth controller.
+type BluetoothAdapter struct {
+	Path         string `json:"path"`
+	Name         string `json:"name"` // e.g. "hci0"
+	Address      string `json:"address"`
+	Alias        string `json:"alias"` // name shown to other devices
+	Powered      bool   `json:"powered"`
+	Discoverable bool   `json:"discoverable"`
+	Pairable     bool   `json:"pairable"`
+	Discovering  bool   `json:"discovering"`
+}
+
+// BluetoothDevice is a remote device paired with or discovered by an adapter.
+type BluetoothDevice struct {
+	Path      string `json:"path"`
+	Adapter   string `json:"adapter"` // e.g. "hci0"
+	Address   string `json:"address"`
+	Name      string `json:"name"`           // alias, or the address of devices without a name
+	Icon      string `json:"icon,omitempty"` // e.g. "audio-headset" or "input-keyboard"
+	Paired    bool   `json:"paired"`
+	Trusted   bool   `json:"trusted"`
+	Connected bool   `json:"connected"`
+	Blocked   bool   `json:"blocked"`
+	RSSI      *int16 `json:"rssi,omitempty"`    // signal strength in dBm, while discovering
+	Battery   *uint8 `json:"battery,omitempty"` // percent, for devices reporting it
+}
+
+// BluetoothPowerRequest powers an adapter on or off.
+type BluetoothPowerRequest struct {
+	Adapter string `json:"adapter,omitempty"` // name or address, the first adapter if empty
+	Powered bool   `json:"powered"`
+}
+
+// BluetoothDiscoveryRequest starts or stops looking for devices.
+type BluetoothDiscoveryRequest struct {
+	Adapter string `json:"adapter,omitempty"` // name or address, the first adapter if empty
+	Seconds int    `json:"seconds,omitempty"` // how long to discover, 30 if unset
+	Stop    bool   `json:"stop,omitempty"`    // stop discovering now instead
+}
+
+// BluetoothDeviceRequest connects, disconnects, pairs or removes a device.
+type BluetoothDeviceRequest struct {
+	Device string `json:"device"` // address or name
+}
+
+// BluetoothBackend reads and changes the Bluetooth adapters and devices, through
+// BlueZ by default. Adapters and devices are given by object path.
+type BluetoothBackend interface {
+	Adapters() ([]BluetoothAdapter, error)
+	Devices() ([]BluetoothDevice, error)
+	SetPowered(adapter string, powered bool) error
+	StartDiscovery(adapter string) error
+	StopDiscovery(adapter string) error
+	ConnectDevice(device string) error
+	DisconnectDevice(device string) error
+	// PairDevice pairs with a device and trusts it, so that it can reconnect.
+	PairDevice(device string) error
+	// RemoveDevice unpairs a device and forgets it.
+	RemoveDevice(device string) error
+}
+
+// GetBluetooth retrieves the adapters and devices from the Bluetooth backend.
+func (s *Server) GetBluetooth() (Bluetooth, error) {
+	adapters, err := s.Bluetooth.Adapters()
+	if err != nil {
+		return Bluetooth{}, err
+	}
+	devices, err := s.Bluetooth.Devices()
+	if err != nil {
+		return Bluetooth{}, err
+	}
+	return Bluetooth{Adapters: adapters, Devices: devices}, nil
+}
+
+// SetBluetoothPowered powers an adapter on or off.
+func (s *Server) SetBluetoothPowered(request BluetoothPowerRequest) error {
+	adapter, err := s.findBluetoothAdapter(request.Adapter)
+	if err != nil {
+		return err
+	}
+	if err := s.Bluetooth.SetPowered(adapter.Path, request.Powered); err != nil {
+		return fmt.Errorf("failed to power %s: %w", adapter.Name, err)
+	}
+	return nil
+}
+
+// SetBluetoothDiscovery starts discovering devices on an adapter for the requested
+// time, extending a discovery started by the server, or stops it. A discovery
+// started by another client keeps running until that client stops it.
+func (s *Server) SetBluetoothDiscovery(request BluetoothDiscoveryRequest) error {
+	if request.Seconds < 0 {
+		return fmt.Errorf("%w: negative discovery time %d", ErrInvalidBluetoothRequest, request.Seconds)
+	}
+
+	// The adapter is read under the lock so that a discovery stopped by an expiring
+	// timer is seen as stopped.
+	s.discoveryMu.Lock()
+	defer s.discoveryMu.Unlock()
+	adapter, err := s.findBluetoothAdapter(request.Adapter)
+	if err != nil {
+		return err
+	}
+	timer := s.discoveryTimers[adapter.Path]
+	if timer != nil {
+		timer.Stop()
+		delete(s.discoveryTimers, adapter.Path)
+	}
+
+	if request.Stop {
+		if !adapter.Discovering {
+			return nil
+		}
+		if err := s.Bluetooth.StopDiscovery(adapter.Path); err != nil {
+			return fmt.Errorf("failed to stop discovery on %s: %w", adapter.Name, err)
+		}
+		return nil
+	}
+
+	if !adapter.Powered {
+		return fmt.Errorf("%w: adapter %s is powered off", ErrInvalidBluetoothRequest, adapter.Name)
+	}
+	if adapter.Discovering && timer == nil {
+		return nil
+	}
+	if !adapter.Discovering {
+		if err := s.Bluetooth.StartDiscovery(adapter.Path); err != nil {
+			return fmt.Errorf("failed to start discovery on %s: %w", adapter.Name, err)
+		}
+	}
+	length := bluetoothDiscoveryLength
+	if request.Seconds > 0 {
+		length = time.Duration(request.Seconds) * time.Second
+	}
+	var expiry *time.Timer
+	expiry = time.AfterFunc(length, func() {
+		s.discoveryMu.Lock()
+		defer s.discoveryMu.Unlock()
+		// A timer that fired while the discovery was extended or stopped has been
+		// replaced or removed and must leave the discovery alone.
+		if s.discoveryTimers[adapter.Path] != expiry {
+			return
+		}
+		delete(s.discoveryTimers, adapter.Path)
+		if err := s.Bluetooth.StopDiscovery(adapter.Path); err != nil {
+			log.Printf("Failed to stop discovery on %s: %v", adapter.Name, err)
+		}
+	})
+	s.discoveryTimers[adapter.Path] = expiry
+	return nil
+}
+
+// ConnectBluetoothDevice connects a device, which is usually paired first.
+func (s *Server) ConnectBluetoothDevice(device string) error {
+	found, err := s.findBluetoothDevice(device)
+	if err != nil {
+		return err
+	}
+	if err := s.Bluetooth.ConnectDevice(found.Path); err != nil {
+		return fmt.Errorf("failed to connect %s: %w", device, err)
+	}
+	return nil
+}
+
+// DisconnectBluetoothDevice disconnects a device.
+func (s *Server) DisconnectBluetoothDevice(device string) error {
+	found, err := s.findBluetoothDevice(device)
+	if err != nil {
+		return err
+	}
+	if err := s.Bluetooth.DisconnectDevice(found.Path); err != nil {
+		return fmt.Errorf("failed to disconnect %s: %w", device, err)
+	}
+	return nil
+}
+
+// PairBluetoothDevice pairs with and trusts a device. Paired devices are left alone.
+func (s *Server) PairBluetoothDevice(device string) error {
+	found, err := s.findBluetoothDevice(device)
+	if err != nil {
+		return err
+	}
+	if found.Paired {
+		return nil
+	}
+	if err := s.Bluetooth.PairDevice(found.Path); err != nil {
+		return fmt.Errorf("failed to pair %s: %w", device, err)
+	}
+	return nil
+}
+
+// RemoveBluetoothDevice unpairs and forgets a device.
+func (s *Server) RemoveBluetoothDevice(device string) error {
+	found, err := s.findBluetoothDevice(device)
+	if err != nil {
+		return err
+	}
+	if err := s.Bluetooth.RemoveDevice(found.Path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", device, err)
+	}
+	return nil
+}
+
+// findBluetoothAdapter returns the adapter with a name or address, or the first
+// adapter when adapter is empty.
+func (s *Server) findBluetoothAdapter(adapter string) (BluetoothAdapter, error) {
+	adapters, err := s.Bluetooth.Adapters()
+	if err != nil {
+		return BluetoothAdapter{}, err
+	}
+	index := slices.IndexFunc(adapters, func(a BluetoothAdapter) bool {
+		return adapter == "" || a.Name == adapter || strings.EqualFold(a.Address, adapter)
+	})
+	if index < 0 {
+		if adapter == "" {
+			return BluetoothAdapter{}, fmt.Errorf("%w: no bluetooth adapter", ErrInvalidBluetoothRequest)
+		}
+		return BluetoothAdapter{}, fmt.Errorf("%w: unknown bluetooth adapter %q", ErrInvalidBluetoothRequest, adapter)
+	}
+	return adapters[index], nil
+}
+
+// findBluetoothDevice returns the device with an address, or else the only device
+// with a name.
+func (s *Server) findBluetoothDevice(device string) (BluetoothDevice, error) {
+	devices, err := s.Bluetooth.Devices()
+	if err != nil {
+		return BluetoothDevice{}, err
+	}
+	if index := slices.IndexFunc(devices, func(d BluetoothDevice) bool { return strings.EqualFold(d.Address, device) }); index >= 0 {
+		return devices[index], nil
+	}
+
+	var found []BluetoothDevice
+	for _, d := range devices {
+		if d.Name == device {
+			found = append(found, d)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return BluetoothDevice{}, fmt.Errorf("%w: unknown bluetooth device %q", ErrInvalidBluetoothRequest, device)
+	case 1:
+		return found[0], nil
+	}
+	return BluetoothDevice{}, fmt.Errorf("%w: %d devices are named %q, use the address", ErrInvalidBluetoothRequest, len(found), device)
+}
+
+// blueZBackend queries BlueZ over DBus.
+type blueZBackend struct {
+	conn *dbus.Conn
+}
+
+// NewBlueZBackend creates a Bluetooth backend talking to BlueZ on conn, or on
+// the shared system bus connection when conn is nil.
+func NewBlueZBackend(conn *dbus.Conn) BluetoothBackend {
+	return blueZBackend{conn: conn}
+}
+
+// objects returns the interfaces and properties of every BlueZ object, by path.
+func (b blueZBackend) objects() (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, error) {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to system DBus: %w", err)
+	}
+
+	var objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	if err := conn.Object(bluezService, "/").Call(objectManagerInterface+".GetManagedObjects", 0).Store(&objects); err != nil {
+		return nil, fmt.Errorf("failed to list bluetooth objects: %w", err)
+	}
+	return objects, nil
+}
+
+// Adapters lists the adapters of BlueZ via DBus.
+func (b blueZBackend) Adapters() ([]BluetoothAdapter, error) {
+	objects, err := b.objects()
+	if err != nil {
+		return nil, err
+	}
+
+	adapters := []BluetoothAdapter{}
+	for objectPath, interfaces := range objects {
+		props, ok := interfaces[bluezAdapterInterface]
+		if !ok {
+			continue
+		}
+		adapters = append(adapters, BluetoothAdapter{
+			Path:         string(objectPath),
+			Name:         path.Base(string(objectPath)),
+			Address:      stringProperty(props, "Address"),
+			Alias:        stringProperty(props, "Alias"),
+			Powered:      boolProperty(props, "Powered"),
+			Discoverable: boolProperty(props, "Discoverable"),
+			Pairable:     boolProperty(props, "Pairable"),
+			Discovering:  boolProperty(props, "Discovering"),
+		})
+	}
+	slices.SortFunc(adapters, func(a, b BluetoothAdapter) int { return strings.Compare(a.Path, b.Path) })
+	return adapters, nil
+}
+
+// Devices lists the devices of BlueZ via DBus, with their battery level when
+// they report one.
+func (b blueZBackend) Devices() ([]BluetoothDevice, error) {
+	objects, err := b.objects()
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []BluetoothDevice{}
+	for objectPath, interfaces := range objects {
+		props, ok := interfaces[bluezDeviceInterface]
+		if !ok {
+			continue
+		}
+		adapter, _ := props["Adapter"].Value().(dbus.ObjectPath)
+		device := BluetoothDevice{
+			Path:      string(objectPath),
+			Adapter:   path.Base(string(adapter)),
+			Address:   stringProperty(props, "Address"),
+			Name:      stringProperty(props, "Alias"),
+			Icon:      stringProperty(props, "Icon"),
+			Paired:    boolProperty(props, "Paired"),
+			Trusted:   boolProperty(props, "Trusted"),
+			Connected: boolProperty(props, "Connected"),
+			Blocked:   boolProperty(props, "Blocked"),
+		}
+		if rssi, ok := props["RSSI"].Value().(int16); ok {
+			device.RSSI = &rssi
+		}
+		if battery, ok := interfaces[bluezBatteryInterface]["Percentage"].Value().(uint8); ok {
+			device.Battery = &battery
+		}
+		devices = append(devices, device)
+	}
+	slices.SortFunc(devices, func(a, b BluetoothDevice) int { return strings.Compare(a.Path, b.Path) })
+	return devices, nil
+}
+
+// SetPowered sets the Powered property of an adapter via DBus.
+func (b blueZBackend) SetPowered(adapter string, powered bool) error {
+	return b.setProperty(adapter, bluezAdapterInterface, "Powered", powered)
+}
+
+// StartDiscovery calls StartDiscovery on an adapter via DBus. BlueZ stops the
+// discovery when the connection that started it closes.
+func (b blueZBackend) StartDiscovery(adapter string) error {
+	return b.call(adapter, bluezAdapterInterface+".StartDiscovery")
+}
+
+// StopDiscovery calls StopDiscovery on an adapter via DBus.
+func (b blueZBackend) StopDiscovery(adapter string) error {
+	return b.call(adapter, bluezAdapterInterface+".StopDiscovery")
+}
+
+// ConnectDevice calls Connect on a device via DBus.
+func (b blueZBackend) ConnectDevice(device string) error {
+	return b.call(device, bluezDeviceInterface+".Connect")
+}
+
+// DisconnectDevice calls Disconnect on a device via DBus.
+func (b blueZBackend) DisconnectDevice(device string) error {
+	return b.call(device, bluezDeviceInterface+".Disconnect")
+}
+
+// PairDevice calls Pair on a device and sets its Trusted property via DBus.
+func (b blueZBackend) PairDevice(device string) error {
+	if err := b.call(device, bluezDeviceInterface+".Pair"); err != nil {
+		return err
+	}
+	return b.setProperty(device, bluezDeviceInterface, "Trusted", true)
+}
+
+// RemoveDevice calls RemoveDevice on the adapter of a device via DBus.
+func (b blueZBackend) RemoveDevice(device string) error {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to system DBus: %w", err)
+	}
+
+	adapter, err := GetProperty(conn.Object(bluezService, dbus.ObjectPath(device)), bluezDeviceInterface, "Adapter")
+	if err != nil {
+		return fmt.Errorf("failed to get adapter: %w", err)
+	}
+	adapterPath, _ := adapter.Value().(dbus.ObjectPath)
+	return conn.Object(bluezService, adapterPath).Call(bluezAdapterInterface+".RemoveDevice", 0, dbus.ObjectPath(device)).Err
+}
+
+// call calls a method without arguments on a BlueZ object.
+func (b blueZBackend) call(objectPath, method string) error {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to system DBus: %w", err)
+	}
+	return conn.Object(bluezService, dbus.ObjectPath(objectPath)).Call(method, 0).Err
+}
+
+// setProperty sets a property of a BlueZ object.
+func (b blueZBackend) setProperty(objectPath, iface, name string, value any) error {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to system DBus: %w", err)
+	}
+	return conn.Object(bluezService, dbus.ObjectPath(objectPath)).SetProperty(iface+"."+name, dbus.MakeVariant(value))
+}
@@ -0,0 +1,701 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/giftpilz0/sysutil/client"
+	"github.com/giftpilz0/sysutil/handlers"
+	"github.com/giftpilz0/sysutil/handlers/handlerstest"
+)
+
+func TestBatteryUPower(t *testing.T) {
+	bus := handlerstest.StartBus(t)
+	upower := handlerstest.ExportUPower(t, bus.Conn(t),
+		&handlerstest.UPowerDevice{Type: 2, PowerSupply: true, IsPresent: true, Percentage: 60, State: 2},
+		handlerstest.UPowerDevice{Type: 1, NativePath: "AC", PowerSupply: true, IsPresent: true},
+		handlerstest.UPowerDevice{
+			Type: 2, NativePath: "BAT0", Model: "5B10W13930", Vendor: "SMP", PowerSupply: true, IsPresent: true, Percentage: 42.5, State: 2,
+			TimeToEmpty: 7980, EnergyRate: 9.1, Energy: 21.2, EnergyFull: 49.9, EnergyFullDesign: 57, Voltage: 11.9, Temperature: 31.5,
+			ChargeCycles: 212, Capacity: 87.5,
+		},
+		handlerstest.UPowerDevice{Type: 2, NativePath: "BAT1", PowerSupply: true, IsPresent: true, Percentage: 77.5, State: 2, ChargeCycles: -1},
+		handlerstest.UPowerDevice{Type: 5, NativePath: "hidpp_battery_0", Model: "MX Master 3", IsPresent: true, Percentage: 55, State: 2},
+	)
+	backend := handlers.NewSystemPowerBackend(bus.Conn(t))
+	c := newClient(t, handlers.ScopeRead, handlers.Backends{Power: backend})
+
+	battery, err := c.Battery(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if battery.Percentage != 60 || battery.State != "Discharging" || battery.Display == nil {
+		t.Errorf("got battery %+v, want the display device at 60%% discharging", battery)
+	}
+	want := []handlers.PowerDevice{
+		{Path: "/org/freedesktop/UPower/devices/device0", NativePath: "AC", Type: "line-power", PowerSupply: true, Present: true, State: "Unknown"},
+		{
+			Path: "/org/freedesktop/UPower/devices/device1", NativePath: "BAT0", Type: "battery", Model: "5B10W13930", Vendor: "SMP", PowerSupply: true, Present: true, Percentage: 42.5, State: "Discharging",
+			TimeToEmpty: 7980, EnergyRate: 9.1, Energy: 21.2, EnergyFull: 49.9, EnergyFullDesign: 57, Voltage: 11.9, Temperature: 31.5,
+			ChargeCycles: 212, Capacity: 87.5,
+		},
+		{Path: "/org/freedesktop/UPower/devices/device2", NativePath: "BAT1", Type: "battery", PowerSupply: true, Present: true, Percentage: 77.5, State: "Discharging"},
+		{Path: "/org/freedesktop/UPower/devices/device3", NativePath: "hidpp_battery_0", Type: "mouse", Model: "MX Master 3", Present: true, Percentage: 55, State: "Discharging"},
+	}
+	if len(battery.Devices) != len(want) {
+		t.Fatalf("got %d devices, want %d", len(battery.Devices), len(want))
+	}
+	for i := range want {
+		if battery.Devices[i] != want[i] {
+			t.Errorf("got device %+v, want %+v", battery.Devices[i], want[i])
+		}
+	}
+
+	waitForChange(t, backend.Subscribe, func() { upower.SetDisplay("State", uint32(1)) })
+	if battery, _ := c.Battery(context.Background()); battery.State != "Charging" {
+		t.Errorf("got state %s, want Charging", battery.State)
+	}
+}
+
+func TestBatteryUPowerWithoutDisplayDevice(t *testing.T) {
+	bus := handlerstest.StartBus(t)
+	handlerstest.ExportUPower(t, bus.Conn(t), nil,
+		handlerstest.UPowerDevice{Type: 6, IsPresent: true, Percentage: 10},
+		handlerstest.UPowerDevice{Type: 2, NativePath: "BAT0", PowerSupply: true, IsPresent: true, Percentage: 42.5, State: 4},
+	)
+	server := handlers.NewServer(handlers.Backends{Power: handlers.NewSystemPowerBackend(bus.Conn(t))})
+
+	battery, err := server.GetBatteryStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if battery.Percentage != 42.5 || battery.State != "Fully charged" || battery.Display.NativePath != "BAT0" {
+		t.Errorf("got battery %+v, want BAT0 at 42.5%% fully charged", battery)
+	}
+}
+
+func TestBatteryHistoryUPower(t *testing.T) {
+	bus := handlerstest.StartBus(t)
+	handlerstest.ExportUPower(t, bus.Conn(t), nil,
+		handlerstest.UPowerDevice{Type: 1, NativePath: "AC"},
+		handlerstest.UPowerDevice{
+			Type: 2, NativePath: "BAT0", PowerSupply: true, IsPresent: true,
+			History: map[string][]handlerstest.UPowerHistoryItem{
+				"charge": {{Time: 1772366400, Value: 81, State: 2}, {Time: 1772367000, Value: 79, State: 2}},
+				"rate":   {{Time: 1772366400, Value: 9.5, State: 2}},
+			},
+			Statistics: map[string][]handlerstest.UPowerStatisticsItem{
+				"discharging": {{Value: 1.1, Accuracy: 80}},
+			},
+		},
+		handlerstest.UPowerDevice{
+			Type: 2, NativePath: "BAT1", IsPresent: true,
+			History: map[string][]handlerstest.UPowerHistoryItem{"charge": {{Time: 1772366400, Value: 50, State: 2}}},
+		},
+	)
+	server := handlers.NewServer(handlers.Backends{Power: handlers.NewSystemPowerBackend(bus.Conn(t))})
+
+	history := server.GetBatteryHistory(time.Now().Add(-time.Hour), 0)
+	if history.UPowerError != "" {
+		t.Fatal(history.UPowerError)
+	}
+	if len(history.UPower) != 1 {
+		t.Fatalf("got %d device histories, want the one of BAT0", len(history.UPower))
+	}
+	bat0 := history.UPower[0]
+	if len(bat0.Charge) != 2 || bat0.Charge[1].Value != 79 || bat0.Charge[1].State != "Discharging" ||
+		!bat0.Charge[0].Time.Equal(time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("got charge history %+v", bat0.Charge)
+	}
+	if len(bat0.Rate) != 1 || len(bat0.ChargingStatistics) != 0 || bat0.DischargeStatistics[0].Accuracy != 80 {
+		t.Errorf("got history %+v", bat0)
+	}
+}
+
+func TestPowerProfilesAndChargeThreshold(t *testing.T) {
+	bus := handlerstest.StartBus(t)
+	service := bus.Conn(t)
+	handlerstest.ExportUPower(t, service, nil,
+		handlerstest.UPowerDevice{Type: 2, NativePath: "BAT0", PowerSupply: true, IsPresent: true,
+			ChargeThresholdSupported: true, ChargeStartThreshold: 75, ChargeEndThreshold: 80},
+		handlerstest.UPowerDevice{Type: 2, NativePath: "BAT1", PowerSupply: true, IsPresent: true},
+	)
+	ppd := handlerstest.ExportPowerProfiles(t, service, "platform_profile", "balanced", "power-saver", "balanced", "performance")
+	c := newClient(t, handlers.ScopeWrite, handlers.Backends{Power: handlers.NewSystemPowerBackend(bus.Conn(t))})
+	ctx := context.Background()
+
+	profiles, err := c.PowerProfiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profiles.Active != "balanced" || len(profiles.Profiles) != 3 || profiles.Profiles[0] != (handlers.PowerProfile{Name: "power-saver", Driver: "platform_profile"}) {
+		t.Errorf("got profiles %+v, want three with balanced active", profiles)
+	}
+
+	if err := c.SetPowerProfile(ctx, "performance"); err != nil {
+		t.Fatal(err)
+	}
+	if active := ppd.Active(); active != "performance" {
+		t.Errorf("got active profile %s, want performance", active)
+	}
+	var apiErr *client.Error
+	if err := c.SetPowerProfile(ctx, "turbo"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("got error %v for an unknown profile, want 400", err)
+	}
+
+	if err := c.SetChargeThreshold(ctx, "BAT0", true); err != nil {
+		t.Fatal(err)
+	}
+	battery, err := c.Battery(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bat0 := battery.Devices[0]; !bat0.ChargeThresholdEnabled || bat0.ChargeStartThreshold != 75 || bat0.ChargeEndThreshold != 80 {
+		t.Errorf("got %+v, want thresholds of 75%% to 80%% enabled", bat0)
+	}
+	if err := c.SetChargeThreshold(ctx, "BAT1", true); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("got error %v for a battery without thresholds, want 400", err)
+	}
+}
+
+func TestNetworkManager(t *testing.T) {
+	bus := handlerstest.StartBus(t)
+	nm := handlerstest.ExportNetworkManager(t, bus.Conn(t),
+		handlerstest.NetworkDevice{
+			Interface: "eth0", DeviceType: 1, HwAddress: "3C:52:82:4A:1B:07", Mtu: 1500, Speed: 1000, State: 100, IP4Connectivity: 4,
+			IP4: &handlerstest.IPConfig{
+				Addresses:   []string{"192.168.1.10/24", "192.168.1.11/24"},
+				Gateway:     "192.168.1.1",
+				Nameservers: []string{"192.168.1.1", "9.9.9.9"},
+				Domains:     []string{"lan"},
+				DHCP:        map[string]string{"ip_address": "192.168.1.10", "dhcp_server_identifier": "192.168.1.1", "dhcp_lease_time": "86400", "expiry": "1792303200"},
+			},
+			IP6: &handlerstest.IPConfig{
+				Addresses:   []string{"2001:db8::10/64", "fe80::3e52:82ff:fe4a:1b07/64"},
+				Gateway:     "fe80::1",
+				Nameservers: []string{"2001:db8::1"},
+				DHCP:        map[string]string{"ip6_address": "2001:db8::10"},
+			},
+		},
+		handlerstest.NetworkDevice{Interface: "wlan0", DeviceType: 2, Address: "10.0.0.5", SSID: "home", Strength: 73, Speed: 866, State: 100, IP4Connectivity: 3},
+		handlerstest.NetworkDevice{Interface: "wlan1", DeviceType: 2, State: 30, StateReason: 39},
+	)
+	nm.AddConnection(t, handlerstest.Connection{ID: "home", UUID: "8a1c3b4e-home", Type: "802-11-wireless", SSID: "home"})
+	backend := handlers.NewNetworkManagerBackend(bus.Conn(t))
+	c := newClient(t, handlers.ScopeRead, handlers.Backends{Network: backend})
+	if err := handlers.NewServer(handlers.Backends{Network: backend}).ActivateConnection("home", "wlan0"); err != nil {
+		t.Fatal(err)
+	}
+
+	devices, err := c.Network(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiry := time.Unix(1792303200, 0).UTC()
+	want := []handlers.NetworkDevice{
+		{
+			DeviceName: "/org/freedesktop/NetworkManager/Devices/0", Interface: "eth0", IpAddress: "192.168.1.10", DeviceType: 1,
+			Type: "ethernet", State: "activated", StateReason: "none", IP4Connectivity: "full",
+			HwAddress: "3C:52:82:4A:1B:07", Mtu: 1500, Speed: 1000,
+			IPv4: &handlers.IPConfig{
+				Addresses:   []handlers.IPAddress{{Address: "192.168.1.10", Prefix: 24}, {Address: "192.168.1.11", Prefix: 24}},
+				Gateway:     "192.168.1.1",
+				Nameservers: []string{"192.168.1.1", "9.9.9.9"},
+				Domains:     []string{"lan"},
+				DHCP: &handlers.DHCPLease{
+					Server: "192.168.1.1", LeaseTime: 86400, Expiry: &expiry,
+					Options: map[string]string{"ip_address": "192.168.1.10", "dhcp_server_identifier": "192.168.1.1", "dhcp_lease_time": "86400", "expiry": "1792303200"},
+				},
+			},
+			IPv6: &handlers.IPConfig{
+				Addresses:   []handlers.IPAddress{{Address: "2001:db8::10", Prefix: 64}, {Address: "fe80::3e52:82ff:fe4a:1b07", Prefix: 64}},
+				Gateway:     "fe80::1",
+				Nameservers: []string{"2001:db8::1"},
+				Domains:     []string{},
+				DHCP:        &handlers.DHCPLease{Options: map[string]string{"ip6_address": "2001:db8::10"}},
+			},
+		},
+		{
+			DeviceName: "/org/freedesktop/NetworkManager/Devices/1", Interface: "wlan0", IpAddress: "10.0.0.5", WifiSSID: "home", DeviceType: 2, WifiStrength: 73, Speed: 866,
+			Type: "wifi", State: "activated", StateReason: "none", IP4Connectivity: "limited", Connection: "home", ConnectionUUID: "8a1c3b4e-home",
+			IPv4: &handlers.IPConfig{Addresses: []handlers.IPAddress{{Address: "10.0.0.5", Prefix: 24}}, Nameservers: []string{}, Domains: []string{}},
+		},
+		{
+			DeviceName: "/org/freedesktop/NetworkManager/Devices/2", Interface: "wlan1", DeviceType: 2,
+			Type: "wifi", State: "disconnected", StateReason: "user-requested", IP4Connectivity: "unknown",
+		},
+	}
+	if len(devices) != len(want) {
+		t.Fatalf("got %d devices, want %d", len(devices), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(devices[i], want[i]) {
+			t.Errorf("got device %+v, want %+v", devices[i], want[i])
+		}
+	}
+
+	status, err := c.NetworkStatus(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (handlers.NetworkStatus{State: "connected-global", Connectivity: "full", PrimaryConnection: "home"}); status != want {
+		t.Errorf("got status %+v, want %+v", status, want)
+	}
+	nm.SetGlobal("Connectivity", uint32(2))
+	if status, _ := c.NetworkStatus(context.Background()); status.Connectivity != "portal" {
+		t.Errorf("got connectivity %s behind a captive portal, want portal", status.Connectivity)
+	}
+
+	waitForChange(t, backend.Subscribe, func() { nm.Set(0, "Interface", "eth1") })
+}
+
+func TestWifiScanNetworkManager(t *testing.T) {
+	bus := handlerstest.StartBus(t)
+	nm := handlerstest.ExportNetworkManager(t, bus.Conn(t),
+		handlerstest.NetworkDevice{Interface: "eth0", DeviceType: 1},
+		handlerstest.NetworkDevice{Interface: "wlan0", DeviceType: 2, SSID: "home", Strength: 73, AccessPoints: []handlerstest.AccessPoint{
+			{SSID: "office", BSSID: "a4:2b:b0:11:22:33", Frequency: 5180, Strength: 81, Flags: 1, RsnFlags: 0x288},
+			{SSID: "cafe", BSSID: "a4:2b:b0:44:55:66", Frequency: 2437, Strength: 40},
+		}},
+		handlerstest.NetworkDevice{Interface: "wlan1", DeviceType: 2, AccessPoints: []handlerstest.AccessPoint{
+			{SSID: "home", BSSID: "a4:2b:b0:77:88:99", Frequency: 6115, Strength: 20, Flags: 1, WpaFlags: 0x100, RsnFlags: 0x500},
+		}},
+	)
+	nm.AddConnection(t, handlerstest.Connection{ID: "Wired", UUID: "2d2f7a3c-wired", Type: "802-3-ethernet"})
+	nm.AddConnection(t, handlerstest.Connection{ID: "home", UUID: "8a1c3b4e-home", Type: "802-11-wireless", SSID: "home"})
+	c := newClient(t, handlers.ScopeWrite, handlers.Backends{Network: handlers.NewNetworkManagerBackend(bus.Conn(t))})
+
+	accessPoints, err := c.ScanWifi(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nm.Scans() != 2 {
+		t.Errorf("got %d scans, want one per Wi-Fi device", nm.Scans())
+	}
+	want := []handlers.AccessPoint{
+		{
+			Device: "wlan0", Path: "/org/freedesktop/NetworkManager/AccessPoint/1", SSID: "office", BSSID: "A4:2B:B0:11:22:33",
+			Frequency: 5180, Band: "5GHz", Channel: 36, Strength: 81, Security: []string{"WPA2", "802.1X"},
+		},
+		{
+			Device: "wlan0", Path: "/org/freedesktop/NetworkManager/AccessPoint/0", SSID: "home", Strength: 73, Security: []string{},
+			Active: true, Saved: true, SavedConnection: "8a1c3b4e-home",
+		},
+		{
+			Device: "wlan0", Path: "/org/freedesktop/NetworkManager/AccessPoint/2", SSID: "cafe", BSSID: "A4:2B:B0:44:55:66",
+			Frequency: 2437, Band: "2.4GHz", Channel: 6, Strength: 40, Security: []string{},
+		},
+		{
+			Device: "wlan1", Path: "/org/freedesktop/NetworkManager/AccessPoint/3", SSID: "home", BSSID: "A4:2B:B0:77:88:99",
+			Frequency: 6115, Band: "6GHz", Channel: 33, Strength: 20, Security: []string{"WPA", "WPA2", "WPA3"},
+			Saved: true, SavedConnection: "8a1c3b4e-home",
+		},
+	}
+	if !reflect.DeepEqual(accessPoints, want) {
+		t.Errorf("got access points %+v, want %+v", accessPoints, want)
+	}
+
+	if _, err := c.ScanWifi(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	if nm.Scans() != 2 {
+		t.Errorf("got %d scans after listing without rescan, want 2", nm.Scans())
+	}
+}
+
+func TestNetworkConnectionsNetworkManager(t *testing.T) {
+	bus := handlerstest.StartBus(t)
+	nm := handlerstest.ExportNetworkManager(t, bus.Conn(t),
+		handlerstest.NetworkDevice{Interface: "eth0", DeviceType: 1},
+		handlerstest.NetworkDevice{Interface: "wlan0", DeviceType: 2, SSID: "home", Strength: 73, AccessPoints: []handlerstest.AccessPoint{
+			{SSID: "flat", Strength: 60, Flags: 1, RsnFlags: 0x188},
+			{SSID: "lab", Strength: 55, Flags: 1, RsnFlags: 0x488},
+			{SSID: "corp", Strength: 50, Flags: 1, RsnFlags: 0x288},
+			{SSID: "cafe", Strength: 40},
+		}},
+	)
+	nm.AddConnection(t, handlerstest.Connection{ID: "Wired", UUID: "2d2f7a3c-wired", Type: "802-3-ethernet"})
+	nm.AddConnection(t, handlerstest.Connection{ID: "home", UUID: "8a1c3b4e-home", Type: "802-11-wireless", SSID: "home"})
+	c := newClient(t, handlers.ScopeWrite, handlers.Backends{Network: handlers.NewNetworkManagerBackend(bus.Conn(t))})
+	ctx := context.Background()
+
+	profiles, err := c.Connections(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantProfiles := []handlers.ConnectionProfile{
+		{Path: "/org/freedesktop/NetworkManager/Settings/0", ID: "Wired", UUID: "2d2f7a3c-wired", Type: "802-3-ethernet"},
+		{Path: "/org/freedesktop/NetworkManager/Settings/1", ID: "home", UUID: "8a1c3b4e-home", Type: "802-11-wireless", SSID: "home"},
+	}
+	if !reflect.DeepEqual(profiles, wantProfiles) {
+		t.Errorf("got profiles %+v, want %+v", profiles, wantProfiles)
+	}
+
+	if err := c.ActivateConnection(ctx, "home", "wlan0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ActivateConnection(ctx, "2d2f7a3c-wired", ""); err != nil {
+		t.Fatal(err)
+	}
+	wantActivations := []handlerstest.Activation{
+		{Connection: "/org/freedesktop/NetworkManager/Settings/1", Device: "/org/freedesktop/NetworkManager/Devices/1", SpecificObject: "/"},
+		{Connection: "/org/freedesktop/NetworkManager/Settings/0", Device: "/", SpecificObject: "/"},
+	}
+	if activations := nm.Activations(); !reflect.DeepEqual(activations, wantActivations) {
+		t.Errorf("got activations %+v, want %+v", activations, wantActivations)
+	}
+
+	for _, request := range []handlers.WifiConnectRequest{
+		{SSID: "flat", Password: "correct horse"},
+		{SSID: "lab", Password: "short", Device: "wlan0"},
+		{SSID: "cafe"},
+		{SSID: "attic", Password: "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", Hidden: true},
+	} {
+		if err := c.ConnectWifi(ctx, request); err != nil {
+			t.Fatalf("connecting to %s: %v", request.SSID, err)
+		}
+	}
+	wantConnections := []handlerstest.Connection{
+		{Path: "/org/freedesktop/NetworkManager/Settings/2", ID: "flat", Type: "802-11-wireless", SSID: "flat", KeyMgmt: "wpa-psk", PSK: "correct horse"},
+		{Path: "/org/freedesktop/NetworkManager/Settings/3", ID: "lab", Type: "802-11-wireless", SSID: "lab", KeyMgmt: "sae", PSK: "short"},
+		{Path: "/org/freedesktop/NetworkManager/Settings/4", ID: "cafe", Type: "802-11-wireless", SSID: "cafe"},
+		{Path: "/org/freedesktop/NetworkManager/Settings/5", ID: "attic", Type: "802-11-wireless", SSID: "attic", Hidden: true, KeyMgmt: "wpa-psk", PSK: "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+	}
+	connections := nm.Connections()[2:]
+	for i := range connections {
+		connections[i].UUID = ""
+	}
+	if !reflect.DeepEqual(connections, wantConnections) {
+		t.Errorf("got connections %+v, want %+v", connections, wantConnections)
+	}
+	if activation := nm.Activations()[2]; activation.Device != "/org/freedesktop/NetworkManager/Devices/1" || activation.SpecificObject != "/org/freedesktop/NetworkManager/AccessPoint/1" {
+		t.Errorf("got activation %+v, want flat on wlan0", activation)
+	}
+
+	var apiErr *client.Error
+	for _, request := range []handlers.WifiConnectRequest{
+		{SSID: "flat", Password: "short"},
+		{SSID: "flat"},
+		{SSID: "corp", Password: "secret"},
+		{SSID: "attic", Password: "correct horse"},
+		{SSID: "flat", Password: "correct horse", Device: "eth0"},
+		{Password: "correct horse"},
+	} {
+		if err := c.ConnectWifi(ctx, request); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+			t.Errorf("got error %v for %+v, want 400", err, request)
+		}
+	}
+
+	if err := c.DisconnectDevice(ctx, "wlan0"); err != nil {
+		t.Fatal(err)
+	}
+	if disconnected := nm.Disconnected(); len(disconnected) != 1 || disconnected[0] != "/org/freedesktop/NetworkManager/Devices/1" {
+		t.Errorf("got disconnected devices %v, want wlan0", disconnected)
+	}
+	if err := c.DisconnectDevice(ctx, "wlan9"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("got error %v for an unknown device, want 400", err)
+	}
+
+	if err := c.DeleteConnection(ctx, "8a1c3b4e-home"); err != nil {
+		t.Fatal(err)
+	}
+	if profiles, _ := c.Connections(ctx); len(profiles) != 5 || slices.ContainsFunc(profiles, func(p handlers.ConnectionProfile) bool { return p.ID == "home" }) {
+		t.Errorf("got profiles %+v after deleting home", profiles)
+	}
+	if err := c.ActivateConnection(ctx, "home", ""); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("got error %v for a deleted connection, want 400", err)
+	}
+}
+
+func TestVPNNetworkManager(t *testing.T) {
+	bus := handlerstest.StartBus(t)
+	nm := handlerstest.ExportNetworkManager(t, bus.Conn(t), handlerstest.NetworkDevice{Interface: "eth0", DeviceType: 1})
+	nm.AddConnection(t, handlerstest.Connection{ID: "Wired", UUID: "2d2f7a3c-wired", Type: "802-3-ethernet"})
+	nm.AddConnection(t, handlerstest.Connection{ID: "corp", UUID: "5b7e9f1a-corp", Type: "vpn", VPNService: "org.freedesktop.NetworkManager.openvpn"})
+	nm.AddConnection(t, handlerstest.Connection{ID: "wg0", UUID: "c3d4e5f6-wg0", Type: "wireguard"})
+	c := newClient(t, handlers.ScopeWrite, handlers.Backends{Network: handlers.NewNetworkManagerBackend(bus.Conn(t))})
+	ctx := context.Background()
+
+	if err := c.ActivateConnection(ctx, "Wired", "eth0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VPNUp(ctx, "corp"); err != nil {
+		t.Fatal(err)
+	}
+	connections, err := c.VPN(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []handlers.VPNConnection{
+		{ID: "corp", UUID: "5b7e9f1a-corp", Type: "vpn", VPNService: "org.freedesktop.NetworkManager.openvpn", Active: true, State: "activated"},
+		{ID: "wg0", UUID: "c3d4e5f6-wg0", Type: "wireguard", State: "deactivated"},
+	}
+	if !reflect.DeepEqual(connections, want) {
+		t.Errorf("got VPN connections %+v, want %+v", connections, want)
+	}
+	if activation := nm.Activations()[1]; activation.Connection != "/org/freedesktop/NetworkManager/Settings/1" || activation.Device != "/" {
+		t.Errorf("got activation %+v, want corp without a device", activation)
+	}
+
+	if err := c.VPNDown(ctx, "5b7e9f1a-corp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VPNDown(ctx, "wg0"); err != nil {
+		t.Errorf("got error %v bringing down an inactive VPN, want none", err)
+	}
+	connections, err = c.VPN(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if connections[0].Active || connections[0].State != "deactivated" {
+		t.Errorf("got %+v, want corp deactivated", connections[0])
+	}
+	if status, _ := c.NetworkStatus(ctx); status.PrimaryConnection != "Wired" {
+		t.Errorf("got primary connection %q, want Wired to stay up", status.PrimaryConnection)
+	}
+
+	var apiErr *client.Error
+	if err := c.VPNUp(ctx, "Wired"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("got error %v for an ethernet connection, want 400", err)
+	}
+	if err := c.VPNDown(ctx, "home"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("got error %v for an unknown connection, want 400", err)
+	}
+}
+
+func TestRadioNetworkManager(t *testing.T) {
+	bus := handlerstest.StartBus(t)
+	nm := handlerstest.ExportNetworkManager(t, bus.Conn(t), handlerstest.NetworkDevice{Interface: "wlan0", DeviceType: 2})
+	rfkill := handlerstest.NewFakeRfkill(
+		handlers.RfkillDevice{Index: 0, Name: "phy0", Type: "wlan"},
+		handlers.RfkillDevice{Index: 1, Name: "hci0", Type: "bluetooth"},
+	)
+	c := newClient(t, handlers.ScopeWrite, handlers.Backends{Network: handlers.NewNetworkManagerBackend(bus.Conn(t)), Rfkill: rfkill})
+	ctx := context.Background()
+
+	state, err := c.Radio(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := handlers.NetworkRadios{Networking: true, Wireless: true, WirelessHardware: true, Wwan: true, WwanHardware: true}
+	if state.NetworkRadios != all || state.AirplaneMode || len(state.Rfkill) != 2 {
+		t.Errorf("got radio state %+v, want everything enabled", state)
+	}
+
+	off := false
+	if err := c.EnableRadio(ctx, handlers.RadioRequest{Networking: &off, Bluetooth: &off}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.EnableRadio(ctx, handlers.RadioRequest{Networking: &off}); err != nil {
+		t.Errorf("got error %v disabling networking twice, want none", err)
+	}
+	state, err = c.Radio(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Networking || !state.Wireless || state.Rfkill[0].Soft || !state.Rfkill[1].Soft {
+		t.Errorf("got radio state %+v, want networking and bluetooth disabled", state)
+	}
+
+	if err := c.SetAirplaneMode(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	state, err = c.Radio(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.AirplaneMode || state.Wireless || state.Wwan || !state.Rfkill[0].Soft {
+		t.Errorf("got radio state %+v, want airplane mode", state)
+	}
+
+	// A hardware block counts as disabled, and airplane mode still fails
+	// partially when rfkill cannot be changed.
+	nm.SetGlobal("WirelessHardwareEnabled", false)
+	rfkill.SetError(errors.New("permission denied"))
+	if err := c.SetAirplaneMode(ctx, false); err == nil {
+		t.Error("got no error with a failing rfkill backend")
+	}
+	rfkill.SetError(nil)
+	state, err = c.Radio(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.AirplaneMode || !state.Wireless || !state.Wwan || state.WirelessHardware {
+		t.Errorf("got radio state %+v, want Wi-Fi re-enabled in software only", state)
+	}
+}
+
+func TestBluetoothBlueZ(t *testing.T) {
+	bus := handlerstest.StartBus(t)
+	bluez := handlerstest.ExportBlueZ(t, bus.Conn(t),
+		[]handlerstest.BluetoothAdapter{{Name: "hci0", Address: "00:1A:7D:DA:71:13", Alias: "laptop"}},
+		handlerstest.BluetoothDevice{Adapter: "hci0", Address: "AC:80:0A:2E:31:5D", Alias: "WH-1000XM4", Icon: "audio-headset", Paired: true, Battery: 70},
+		handlerstest.BluetoothDevice{Adapter: "hci0", Address: "F4:73:35:0B:9A:21", Alias: "Keyboard K380", Icon: "input-keyboard", RSSI: -58},
+	)
+	c := newClient(t, handlers.ScopeWrite, handlers.Backends{Bluetooth: handlers.NewBlueZBackend(bus.Conn(t))})
+	ctx := context.Background()
+
+	state, err := c.Bluetooth(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantAdapters := []handlers.BluetoothAdapter{
+		{Path: "/org/bluez/hci0", Name: "hci0", Address: "00:1A:7D:DA:71:13", Alias: "laptop", Pairable: true},
+	}
+	if !reflect.DeepEqual(state.Adapters, wantAdapters) {
+		t.Errorf("got adapters %+v, want %+v", state.Adapters, wantAdapters)
+	}
+	battery, rssi := uint8(70), int16(-58)
+	wantDevices := []handlers.BluetoothDevice{
+		{Path: "/org/bluez/hci0/dev_AC_80_0A_2E_31_5D", Adapter: "hci0", Address: "AC:80:0A:2E:31:5D", Name: "WH-1000XM4", Icon: "audio-headset", Paired: true, Trusted: true, Battery: &battery},
+		{Path: "/org/bluez/hci0/dev_F4_73_35_0B_9A_21", Adapter: "hci0", Address: "F4:73:35:0B:9A:21", Name: "Keyboard K380", Icon: "input-keyboard", RSSI: &rssi},
+	}
+	if !reflect.DeepEqual(state.Devices, wantDevices) {
+		t.Errorf("got devices %+v, want %+v", state.Devices, wantDevices)
+	}
+
+	var apiErr *client.Error
+	if err := c.BluetoothDiscovery(ctx, handlers.BluetoothDiscoveryRequest{}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("got error %v discovering with the adapter off, want 400", err)
+	}
+	if err := c.SetBluetoothPowered(ctx, "", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.BluetoothDiscovery(ctx, handlers.BluetoothDiscoveryRequest{Adapter: "hci0", Seconds: 60}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.BluetoothDiscovery(ctx, handlers.BluetoothDiscoveryRequest{Adapter: "00:1a:7d:da:71:13"}); err != nil {
+		t.Errorf("got error %v extending the discovery, want none", err)
+	}
+	if !bluez.Get("/org/bluez/hci0", "Powered").(bool) || !bluez.Get("/org/bluez/hci0", "Discovering").(bool) {
+		t.Error("got adapter off or not discovering, want it discovering")
+	}
+	if err := c.BluetoothDiscovery(ctx, handlers.BluetoothDiscoveryRequest{Stop: true}); err != nil {
+		t.Fatal(err)
+	}
+	if bluez.Get("/org/bluez/hci0", "Discovering").(bool) {
+		t.Error("got adapter discovering, want discovery stopped")
+	}
+
+	// A discovery started by another deviceapi is not stopped by the timer of this one.
+	other := newClient(t, handlers.ScopeWrite, handlers.Backends{Bluetooth: handlers.NewBlueZBackend(bus.Conn(t))})
+	if err := other.BluetoothDiscovery(ctx, handlers.BluetoothDiscoveryRequest{Seconds: 60}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.BluetoothDiscovery(ctx, handlers.BluetoothDiscoveryRequest{Seconds: 1}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if !bluez.Get("/org/bluez/hci0", "Discovering").(bool) {
+		t.Error("got discovery stopped by a client that did not start it, want it running")
+	}
+	if err := other.BluetoothDiscovery(ctx, handlers.BluetoothDiscoveryRequest{Stop: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.PairBluetoothDevice(ctx, "f4:73:35:0b:9a:21"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PairBluetoothDevice(ctx, "WH-1000XM4"); err != nil {
+		t.Errorf("got error %v pairing a paired device, want none", err)
+	}
+	if err := c.ConnectBluetoothDevice(ctx, "Keyboard K380"); err != nil {
+		t.Fatal(err)
+	}
+	keyboard := "/org/bluez/hci0/dev_F4_73_35_0B_9A_21"
+	if !bluez.Get(keyboard, "Paired").(bool) || !bluez.Get(keyboard, "Trusted").(bool) || !bluez.Get(keyboard, "Connected").(bool) {
+		t.Error("got keyboard not paired, trusted and connected")
+	}
+	if err := c.DisconnectBluetoothDevice(ctx, "Keyboard K380"); err != nil {
+		t.Fatal(err)
+	}
+	if bluez.Get(keyboard, "Connected").(bool) {
+		t.Error("got keyboard connected, want it disconnected")
+	}
+
+	if err := c.RemoveBluetoothDevice(ctx, "WH-1000XM4"); err != nil {
+		t.Fatal(err)
+	}
+	if removed := bluez.Removed(); len(removed) != 1 || removed[0] != "/org/bluez/hci0/dev_AC_80_0A_2E_31_5D" {
+		t.Errorf("got removed devices %v, want the headset", removed)
+	}
+	if err := c.ConnectBluetoothDevice(ctx, "WH-1000XM4"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("got error %v for a removed device, want 400", err)
+	}
+}
+
+func TestBluetoothDiscoveryExtended(t *testing.T) {
+	bus := handlerstest.StartBus(t)
+	bluez := handlerstest.ExportBlueZ(t, bus.Conn(t),
+		[]handlerstest.BluetoothAdapter{{Name: "hci0", Address: "00:1A:7D:DA:71:13", Powered: true}},
+	)
+	deviceServer := handlers.NewServer(handlers.Backends{Bluetooth: handlers.NewBlueZBackend(bus.Conn(t))})
+	c, err := client.New(serve(t, handlers.ScopeWrite, deviceServer).URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := c.BluetoothDiscovery(ctx, handlers.BluetoothDiscoveryRequest{Seconds: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The timer fires while the discovery is being extended and waits for the
+	// extension to finish.
+	unlock := deviceServer.LockDiscovery()
+	time.Sleep(1500 * time.Millisecond)
+	extended := make(chan error)
+	go func() {
+		extended <- c.BluetoothDiscovery(ctx, handlers.BluetoothDiscoveryRequest{Seconds: 60})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	unlock()
+	if err := <-extended; err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if !bluez.Get("/org/bluez/hci0", "Discovering").(bool) {
+		t.Error("got discovery stopped by the timer it was extended from, want it running")
+	}
+	if err := c.BluetoothDiscovery(ctx, handlers.BluetoothDiscoveryRequest{Stop: true}); err != nil {
+		t.Fatal(err)
+	}
+	if bluez.Get("/org/bluez/hci0", "Discovering").(bool) {
+		t.Error("got discovery running after stopping it")
+	}
+}
+
+// waitForChange subscribes to a backend and repeats change until the
+// subscription reports it.
+func waitForChange(t *testing.T, subscribe func(context.Context, func()) error, change func()) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 1)
+	go subscribe(ctx, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	// The subscription may not be registered yet when change first runs.
+	timeout := time.After(5 * time.Second)
+	for {
+		change()
+		select {
+		case <-changed:
+			return
+		case <-time.After(50 * time.Millisecond):
+		case <-timeout:
+			t.Fatal("no change reported")
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Event types pushed to clients, each carrying the same JSON as the matching GET endpoint.
+	EventAudioOutputs = "audio.outputs"
+	EventAudioInputs  = "audio.inputs"
+	EventAudioStreams = "audio.streams"
+	EventAudioCards   = "audio.cards"
+	EventBattery      = "battery"
+	EventNetwork      = "network"
+
+	// subscriberBuffer is how many events a slow client may lag behind before it is dropped.
+	subscriberBuffer = 32
+
+	// eventsKeepAlive is the interval of SSE comments keeping idle connections open.
+	eventsKeepAlive = 30 * time.Second
+)
+
+// Event is a typed device state change.
+type Event struct {
+	ID   uint64          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// EventBroker keeps the latest state per event type and fans changes out to subscribers.
+type EventBroker struct {
+	mu          sync.Mutex
+	nextID      uint64
+	latest      map[string]Event
+	subscribers map[chan Event]struct{}
+}
+
+// NewEventBroker creates an empty event broker.
+func NewEventBroker() *EventBroker {
+	return &EventBroker{
+		latest:      make(map[string]Event),
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Publish stores the state for an event type and notifies subscribers if it changed.
+func (b *EventBroker) Publish(eventType string, state any) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", eventType, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if last, ok := b.latest[eventType]; ok && bytes.Equal(last.Data, data) {
+		return nil
+	}
+
+	b.nextID++
+	event := Event{ID: b.nextID, Type: eventType, Data: data}
+	b.latest[eventType] = event
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// The client cannot keep up; drop it so it reconnects and resyncs.
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return nil
+}
+
+// Snapshot returns the latest event of every type, oldest first.
+func (b *EventBroker) Snapshot() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	snapshot := make([]Event, 0, len(b.latest))
+	for _, event := range b.latest {
+		snapshot = append(snapshot, event)
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].ID < snapshot[j].ID })
+	return snapshot
+}
+
+// Subscribe registers a new subscriber. The returned channel is closed when the
+// subscriber falls behind or the returned cancel function is called.
+func (b *EventBroker) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return ch, cancel
+}
+
+// parseEventTypes reads the optional comma separated "types" query parameter.
+// A nil result means all event types are wanted.
+func parseEventTypes(r *http.Request) map[string]bool {
+	param := r.URL.Query().Get("types")
+	if param == "" {
+		return nil
+	}
+
+	types := make(map[string]bool)
+	for _, t := range strings.Split(param, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types[t] = true
+		}
+	}
+	return types
+}
+
+// EventsHandler streams device state changes as Server-Sent Events. The current
+// state of every type is sent first, followed by changes as they happen.
+func (s *Server) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	types := parseEventTypes(r)
+	ch, cancel := s.events.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(event Event) error {
+		if types != nil && !types[event.Type] {
+			return nil
+		}
+		_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+		return err
+	}
+
+	// Changes published between Subscribe and Snapshot are already part of the snapshot.
+	var lastID uint64
+	for _, event := range s.events.Snapshot() {
+		if err := send(event); err != nil {
+			return
+		}
+		lastID = event.ID
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if event.ID <= lastID {
+				continue
+			}
+			if err := send(event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/giftpilz0/sysutil/client"
+	"github.com/giftpilz0/sysutil/handlers"
+	"github.com/giftpilz0/sysutil/handlers/handlerstest"
+)
+
+func TestEventBroker(t *testing.T) {
+	broker := handlers.NewEventBroker()
+	events, cancel := broker.Subscribe()
+
+	for _, publish := range []struct {
+		eventType string
+		state     any
+	}{
+		{handlers.EventBattery, map[string]int{"percentage": 81}},
+		{handlers.EventNetwork, []string{"wlan0"}},
+		{handlers.EventBattery, map[string]int{"percentage": 81}}, // unchanged, not sent
+		{handlers.EventBattery, map[string]int{"percentage": 80}},
+	} {
+		if err := broker.Publish(publish.eventType, publish.state); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := broker.Publish(handlers.EventBattery, func() {}); err == nil {
+		t.Error("got no error publishing a state without JSON")
+	}
+
+	want := []handlers.Event{
+		{ID: 1, Type: handlers.EventBattery, Data: json.RawMessage(`{"percentage":81}`)},
+		{ID: 2, Type: handlers.EventNetwork, Data: json.RawMessage(`["wlan0"]`)},
+		{ID: 3, Type: handlers.EventBattery, Data: json.RawMessage(`{"percentage":80}`)},
+	}
+	for _, want := range want {
+		if event := <-events; event.ID != want.ID || event.Type != want.Type || string(event.Data) != string(want.Data) {
+			t.Errorf("got event %d %s %s, want %d %s %s", event.ID, event.Type, event.Data, want.ID, want.Type, want.Data)
+		}
+	}
+
+	// The snapshot holds the latest event of each type, oldest first.
+	snapshot := broker.Snapshot()
+	if len(snapshot) != 2 || snapshot[0].ID != 2 || snapshot[1].ID != 3 {
+		t.Errorf("got snapshot %+v, want the network event and the second battery event", snapshot)
+	}
+
+	cancel()
+	cancel()
+	if _, ok := <-events; ok {
+		t.Error("got an event after cancel, want the channel closed")
+	}
+}
+
+func TestEventBrokerSlowSubscriber(t *testing.T) {
+	broker := handlers.NewEventBroker()
+	slow, cancelSlow := broker.Subscribe()
+	defer cancelSlow()
+	fast, cancelFast := broker.Subscribe()
+	defer cancelFast()
+
+	const published = 100
+	received := 0
+	for i := range published {
+		if err := broker.Publish(handlers.EventBattery, i); err != nil {
+			t.Fatal(err)
+		}
+		if event := <-fast; event.Data == nil {
+			t.Fatal("got an empty event")
+		}
+		received++
+	}
+
+	// The slow subscriber gets the events buffered before it fell behind, then
+	// its channel is closed so it reconnects and starts from the snapshot.
+	buffered := 0
+	for range slow {
+		buffered++
+	}
+	if buffered == 0 || buffered >= published {
+		t.Errorf("got %d of %d events on the slow subscriber, want it dropped after its buffer", buffered, published)
+	}
+	if received != published {
+		t.Errorf("got %d of %d events on the fast subscriber", received, published)
+	}
+}
+
+// watchEvents serves a server watching its backends with a short debounce and
+// resync interval and returns the event stream of the given types.
+func watchEvents(t *testing.T, backends handlers.Backends, resync time.Duration, types ...string) <-chan handlers.Event {
+	t.Helper()
+
+	deviceServer := handlers.NewServer(backends)
+	deviceServer.SetEventIntervals(100*time.Millisecond, resync)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go deviceServer.WatchDeviceEvents(ctx)
+
+	c, err := client.New(serve(t, handlers.ScopeRead, deviceServer).URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := c.Events(ctx, types...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stream.Close() })
+
+	events := make(chan handlers.Event)
+	go func() {
+		defer close(events)
+		for {
+			event, err := stream.Next()
+			if err != nil {
+				return
+			}
+			events <- event
+		}
+	}()
+	return events
+}
+
+// nextEvent waits for the next event of a stream started by watchEvents.
+func nextEvent(t *testing.T, events <-chan handlers.Event) handlers.Event {
+	t.Helper()
+
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("event stream ended")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("got no event")
+	}
+	return handlers.Event{}
+}
+
+// noEvent checks that a stream started by watchEvents stays quiet for a while.
+func noEvent(t *testing.T, events <-chan handlers.Event, wait time.Duration) {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		t.Errorf("got event %d %s %s, want none", event.ID, event.Type, event.Data)
+	case <-time.After(wait):
+	}
+}
+
+func TestEventsDebounce(t *testing.T) {
+	t.Parallel()
+
+	fake := useFakeAudio(t)
+	backends := handlers.Backends{Audio: fake, Power: handlerstest.NewFakePower(handlers.Battery{}), Network: handlerstest.NewFakeNetwork()}
+	events := watchEvents(t, backends, time.Hour, handlers.EventAudioOutputs)
+
+	// The stream starts with the current outputs.
+	var outputs []handlers.AudioInfo
+	if event := nextEvent(t, events); event.Type != handlers.EventAudioOutputs || json.Unmarshal(event.Data, &outputs) != nil || len(outputs) != 2 {
+		t.Fatalf("got event %s %s, want the two outputs", event.Type, event.Data)
+	}
+
+	// A burst of changes becomes a single event with the final state.
+	for _, percent := range []int{20, 30, 40} {
+		if err := fake.SetVolume("sink", "hdmi", *handlers.AbsoluteVolume(percent)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	event := nextEvent(t, events)
+	if err := json.Unmarshal(event.Data, &outputs); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != handlers.EventAudioOutputs || outputs[1].Name != "hdmi" || outputs[1].Volume != 40 {
+		t.Errorf("got event %s %s, want hdmi at 40%%", event.Type, event.Data)
+	}
+	noEvent(t, events, 300*time.Millisecond)
+
+	// Notifications without a change send nothing.
+	fake.Notify("sink")
+	noEvent(t, events, 300*time.Millisecond)
+}
+
+func TestEventsResync(t *testing.T) {
+	t.Parallel()
+
+	// The inputs cannot be read at first and change without a notification.
+	fake := useFakeAudio(t)
+	fake.Fail("Devices", "source", errors.New("connection refused"))
+	backends := handlers.Backends{Audio: fake, Power: handlerstest.NewFakePower(handlers.Battery{}), Network: handlerstest.NewFakeNetwork()}
+	events := watchEvents(t, backends, 500*time.Millisecond, handlers.EventAudioInputs)
+	noEvent(t, events, 300*time.Millisecond)
+
+	fake.Fail("Devices", "source", nil)
+	if event := nextEvent(t, events); event.Type != handlers.EventAudioInputs {
+		t.Errorf("got event %s, want the inputs after the resync", event.Type)
+	}
+}
+
+func TestEventsTypes(t *testing.T) {
+	t.Parallel()
+
+	fake := useFakeAudio(t)
+	power := handlerstest.NewFakePower(handlers.Battery{Percentage: 81, State: "Discharging"})
+	backends := handlers.Backends{Audio: fake, Power: power, Network: handlerstest.NewFakeNetwork()}
+	events := watchEvents(t, backends, time.Hour, handlers.EventBattery, handlers.EventAudioCards)
+
+	// The current state of both types arrives first.
+	seen := map[string]bool{}
+	for range 2 {
+		seen[nextEvent(t, events).Type] = true
+	}
+	if !seen[handlers.EventBattery] || !seen[handlers.EventAudioCards] {
+		t.Fatalf("got events %v, want battery and audio.cards", seen)
+	}
+
+	// Output changes are filtered out, battery changes are not.
+	if err := fake.SetVolume("sink", "hdmi", *handlers.AbsoluteVolume(20)); err != nil {
+		t.Fatal(err)
+	}
+	power.Set(handlers.Battery{Percentage: 80, State: "Discharging"}, nil)
+	var battery handlers.Battery
+	event := nextEvent(t, events)
+	if event.Type != handlers.EventBattery || json.Unmarshal(event.Data, &battery) != nil || battery.Percentage != 80 {
+		t.Errorf("got event %s %s, want the battery at 80%%", event.Type, event.Data)
+	}
+	noEvent(t, events, 300*time.Millisecond)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	// eventsDebounce coalesces bursts of change notifications into a single refresh.
+	eventsDebounce = 250 * time.Millisecond
+
+	// eventsResync refreshes every event type periodically in case a notification was missed.
+	eventsResync = time.Minute
+
+	// eventsRetryDelay is how long a failed watcher waits before starting again.
+	eventsRetryDelay = 5 * time.Second
+)
+
+// eventSources maps each event type to the function collecting its current state.
+func (s *Server) eventSources() map[string]func() (any, error) {
+	return map[string]func() (any, error){
+		EventAudioOutputs: func() (any, error) { return s.GetVolumeInfo() },
+		EventAudioInputs:  func() (any, error) { return s.GetInputInfo() },
+		EventAudioStreams: func() (any, error) { return s.GetAudioStreams("") },
+		EventAudioCards:   func() (any, error) { return s.GetAudioCards() },
+		EventBattery:      func() (any, error) { return s.GetBatteryStatus() },
+		EventNetwork:      func() (any, error) { return s.GetNetworkDevices() },
+	}
+}
+
+// WatchDeviceEvents keeps the event stream up to date until ctx is cancelled. Audio
+// changes come from the audio backend subscription, battery and network changes from the
+// power and network backends, which listen to DBus signals sent by UPower and NetworkManager.
+func (s *Server) WatchDeviceEvents(ctx context.Context) {
+	requests := make(chan string, len(s.eventSources()))
+	trigger := func(eventTypes ...string) {
+		for _, eventType := range eventTypes {
+			select {
+			case requests <- eventType:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+
+	go watchWithRetry(ctx, "audio", func() error { return s.watchAudioEvents(ctx, trigger) })
+	go watchWithRetry(ctx, "power", func() error { return s.Power.Subscribe(ctx, func() { trigger(EventBattery) }) })
+	go watchWithRetry(ctx, "network", func() error { return s.Network.Subscribe(ctx, func() { trigger(EventNetwork) }) })
+
+	s.refreshEvents(ctx, requests)
+}
+
+// refreshEvents publishes the state of every requested event type, coalescing
+// requests arriving within s.eventsDebounce of each other.
+func (s *Server) refreshEvents(ctx context.Context, requests <-chan string) {
+	sources := s.eventSources()
+	pending := make(map[string]bool)
+	for eventType := range sources {
+		pending[eventType] = true
+	}
+
+	debounce := time.NewTimer(0)
+	defer debounce.Stop()
+	resync := time.NewTicker(s.eventsResync)
+	defer resync.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case eventType := <-requests:
+			if len(pending) == 0 {
+				debounce.Reset(s.eventsDebounce)
+			}
+			pending[eventType] = true
+		case <-resync.C:
+			for eventType := range sources {
+				pending[eventType] = true
+			}
+			debounce.Reset(0)
+		case <-debounce.C:
+			for eventType := range pending {
+				state, err := sources[eventType]()
+				if err != nil {
+					log.Printf("Failed to refresh %s event: %v", eventType, err)
+					continue
+				}
+				if err := s.events.Publish(eventType, state); err != nil {
+					log.Printf("Failed to publish %s event: %v", eventType, err)
+				}
+			}
+			clear(pending)
+		}
+	}
+}
+
+// watchWithRetry runs a watcher and restarts it after eventsRetryDelay until ctx is cancelled.
+func watchWithRetry(ctx context.Context, name string, watch func() error) {
+	for {
+		err := watch()
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("%s event watcher stopped: %v, restarting in %s", name, err, eventsRetryDelay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(eventsRetryDelay):
+		}
+	}
+}
+
+// watchAudioEvents subscribes to the audio backend and triggers a refresh of the
+// audio event types affected by each change.
+func (s *Server) watchAudioEvents(ctx context.Context, trigger func(...string)) error {
+	return s.Audio.Subscribe(ctx, func(kind string) {
+		switch kind {
+		case "sink":
+			trigger(EventAudioOutputs)
+		case "source":
+			trigger(EventAudioInputs)
+		case "sink-input", "source-output":
+			trigger(EventAudioStreams)
+		case "server":
+			// Default device changes affect both directions and the streams on them.
+			trigger(EventAudioOutputs, EventAudioInputs, EventAudioStreams)
+		case "card":
+			// Profile changes also replace the sinks and sources of the card.
+			trigger(EventAudioCards, EventAudioOutputs, EventAudioInputs, EventAudioStreams)
+		}
+	})
+}
@@ -0,0 +1,17 @@
+package handlers
+
+import "time"
+
+// SetEventIntervals changes how long the server coalesces change notifications
+// and how often it refreshes every event type, so tests need not wait for the
+// defaults.
+func (s *Server) SetEventIntervals(debounce, resync time.Duration) {
+	s.eventsDebounce, s.eventsResync = debounce, resync
+}
+
+// LockDiscovery holds the lock of the Bluetooth discovery timers until the
+// returned function is called, so tests can let a timer fire during a request.
+func (s *Server) LockDiscovery() (unlock func()) {
+	s.discoveryMu.Lock()
+	return s.discoveryMu.Unlock
+}
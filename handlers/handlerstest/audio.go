@@ -0,0 +1,465 @@
+// Package handlerstest provides in-memory backends and a private DBus daemon with
+// mock UPower and NetworkManager services, to test the handlers package without
+// a desktop session.
+package handlerstest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/giftpilz0/sysutil/handlers"
+)
+
+// volumeNorm is the raw volume corresponding to 100%.
+const volumeNorm = 65536
+
+// FakeAudio is an in-memory handlers.AudioBackend. Set the fields before handing
+// it to handlers.NewServer; afterwards use the methods, which lock it.
+type FakeAudio struct {
+	Sinks         []handlers.AudioInfo
+	Sources       []handlers.AudioInfo
+	SinkInputs    []handlers.AudioStream
+	SourceOutputs []handlers.AudioStream
+	SoundCards    []handlers.AudioCard
+
+	mu          sync.Mutex
+	calls       []string
+	failures    map[string]error
+	subscribers map[chan string]struct{}
+}
+
+// Calls returns the changes made so far, e.g. "SetVolume sink speakers +5".
+func (f *FakeAudio) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// Fail makes every call of method, e.g. "SetVolume" or "Devices", on target fail
+// with err. An empty target fails the method for every target; the target of
+// Devices is the kind.
+func (f *FakeAudio) Fail(method, target string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures == nil {
+		f.failures = make(map[string]error)
+	}
+	f.failures[method+" "+target] = err
+}
+
+// Notify reports a change of an object kind to the subscribers, as the sound
+// server would for changes made by other clients.
+func (f *FakeAudio) Notify(kind string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.notify(kind)
+}
+
+// notify must be called with f.mu held.
+func (f *FakeAudio) notify(kind string) {
+	for subscriber := range f.subscribers {
+		select {
+		case subscriber <- kind:
+		default:
+		}
+	}
+}
+
+// record logs a call and returns the injected failure for it, if any. It must
+// be called with f.mu held.
+func (f *FakeAudio) record(method, target string, args ...string) error {
+	f.calls = append(f.calls, strings.Join(append([]string{method, target}, args...), " "))
+	return f.failure(method, target)
+}
+
+// failure returns the injected failure for a call, if any. It must be called
+// with f.mu held.
+func (f *FakeAudio) failure(method, target string) error {
+	if err, ok := f.failures[method+" "+target]; ok {
+		return err
+	}
+	return f.failures[method+" "]
+}
+
+// devices returns the device list of a kind.
+func (f *FakeAudio) devices(kind string) (*[]handlers.AudioInfo, error) {
+	switch kind {
+	case "sink":
+		return &f.Sinks, nil
+	case "source":
+		return &f.Sources, nil
+	}
+	return nil, fmt.Errorf("invalid device kind %q", kind)
+}
+
+// streams returns the stream list of a kind.
+func (f *FakeAudio) streams(kind string) (*[]handlers.AudioStream, error) {
+	switch kind {
+	case handlers.StreamSinkInput:
+		return &f.SinkInputs, nil
+	case handlers.StreamSourceOutput:
+		return &f.SourceOutputs, nil
+	}
+	return nil, fmt.Errorf("invalid stream kind %q", kind)
+}
+
+// device looks up a device by name, index or @DEFAULT_SINK@ and @DEFAULT_SOURCE@.
+func (f *FakeAudio) device(kind, target string) (*handlers.AudioInfo, error) {
+	devices, err := f.devices(kind)
+	if err != nil {
+		return nil, err
+	}
+	for i := range *devices {
+		device := &(*devices)[i]
+		if device.Name == target || strconv.FormatUint(uint64(device.Index), 10) == target ||
+			(device.Default && target == "@DEFAULT_"+strings.ToUpper(kind)+"@") {
+			return device, nil
+		}
+	}
+	return nil, fmt.Errorf("no such %s %s", kind, target)
+}
+
+// stream looks up a stream by index.
+func (f *FakeAudio) stream(kind, target string) (*handlers.AudioStream, error) {
+	streams, err := f.streams(kind)
+	if err != nil {
+		return nil, err
+	}
+	for i := range *streams {
+		if strconv.FormatUint(uint64((*streams)[i].Index), 10) == target {
+			return &(*streams)[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no such %s %s", kind, target)
+}
+
+// volume returns the mute state and channels of a device or stream.
+func (f *FakeAudio) volume(kind, target string) (*bool, []handlers.ChannelVolume, func(), error) {
+	if kind == handlers.StreamSinkInput || kind == handlers.StreamSourceOutput {
+		stream, err := f.stream(kind, target)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return &stream.Mute, stream.Channels, func() { stream.Volume = averagePercent(stream.Channels) }, nil
+	}
+	device, err := f.device(kind, target)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return &device.Mute, device.Channels, func() {
+		device.Volume = averagePercent(device.Channels)
+		device.Balance = balance(device.Channels)
+	}, nil
+}
+
+// Devices returns a copy of the sinks or sources.
+func (f *FakeAudio) Devices(kind string) ([]handlers.AudioInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	devices, err := f.devices(kind)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.failure("Devices", kind); err != nil {
+		return nil, err
+	}
+	out := make([]handlers.AudioInfo, len(*devices))
+	for i, device := range *devices {
+		device.Channels = append([]handlers.ChannelVolume(nil), device.Channels...)
+		device.Ports = append([]handlers.AudioPort(nil), device.Ports...)
+		out[i] = device
+	}
+	return out, nil
+}
+
+// Streams returns a copy of the sink-inputs or source-outputs.
+func (f *FakeAudio) Streams(kind string) ([]handlers.AudioStream, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	streams, err := f.streams(kind)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]handlers.AudioStream, len(*streams))
+	for i, stream := range *streams {
+		stream.Channels = append([]handlers.ChannelVolume(nil), stream.Channels...)
+		out[i] = stream
+	}
+	return out, nil
+}
+
+// Cards returns a copy of the sound cards.
+func (f *FakeAudio) Cards() ([]handlers.AudioCard, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]handlers.AudioCard(nil), f.SoundCards...), nil
+}
+
+// SetMute sets or toggles the mute state of a device or stream.
+func (f *FakeAudio) SetMute(kind, target string, mute handlers.MuteValue) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	value, _ := mute.MarshalJSON()
+	if err := f.record("SetMute", target, kind, string(value)); err != nil {
+		return err
+	}
+	muted, _, _, err := f.volume(kind, target)
+	if err != nil {
+		return err
+	}
+	if mute.Toggle {
+		*muted = !*muted
+	} else {
+		*muted = mute.Muted
+	}
+	f.notify(kind)
+	return nil
+}
+
+// SetVolume sets all channels of a device or stream to a volume, or shifts them.
+func (f *FakeAudio) SetVolume(kind, target string, volume handlers.VolumeValue) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	value, _ := volume.MarshalJSON()
+	if err := f.record("SetVolume", target, kind, strings.Trim(string(value), `"`)); err != nil {
+		return err
+	}
+	_, channels, update, err := f.volume(kind, target)
+	if err != nil {
+		return err
+	}
+	raw := int64(volume.Percent) * volumeNorm / 100
+	for i := range channels {
+		if volume.Relative {
+			setChannel(&channels[i], max(channels[i].Value+raw, 0))
+		} else {
+			setChannel(&channels[i], raw)
+		}
+	}
+	update()
+	f.notify(kind)
+	return nil
+}
+
+// SetChannelVolumes sets the raw volume of each channel of a device or stream.
+func (f *FakeAudio) SetChannelVolumes(kind, target string, values []int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	args := []string{kind}
+	for _, value := range values {
+		args = append(args, strconv.FormatInt(value, 10))
+	}
+	if err := f.record("SetChannelVolumes", target, args...); err != nil {
+		return err
+	}
+	_, channels, update, err := f.volume(kind, target)
+	if err != nil {
+		return err
+	}
+	if len(values) != len(channels) {
+		return fmt.Errorf("%s %s has %d channels, got %d volumes", kind, target, len(channels), len(values))
+	}
+	for i, value := range values {
+		setChannel(&channels[i], value)
+	}
+	update()
+	f.notify(kind)
+	return nil
+}
+
+// SetPort switches the active port of a device.
+func (f *FakeAudio) SetPort(kind, target, port string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("SetPort", target, kind, port); err != nil {
+		return err
+	}
+	device, err := f.device(kind, target)
+	if err != nil {
+		return err
+	}
+	for _, candidate := range device.Ports {
+		if candidate.Name == port {
+			device.ActivePort = port
+			f.notify(kind)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s %s has no port %s", kind, target, port)
+}
+
+// SetDefault makes a device the default one of its kind.
+func (f *FakeAudio) SetDefault(kind, target string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("SetDefault", target, kind); err != nil {
+		return err
+	}
+	device, err := f.device(kind, target)
+	if err != nil {
+		return err
+	}
+	name := device.Name
+	devices, _ := f.devices(kind)
+	for i := range *devices {
+		(*devices)[i].Default = (*devices)[i].Name == name
+	}
+	f.notify("server")
+	return nil
+}
+
+// MoveStream attaches a stream to another device.
+func (f *FakeAudio) MoveStream(kind, target, deviceName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("MoveStream", target, kind, deviceName); err != nil {
+		return err
+	}
+	stream, err := f.stream(kind, target)
+	if err != nil {
+		return err
+	}
+	deviceKind := "sink"
+	if kind == handlers.StreamSourceOutput {
+		deviceKind = "source"
+	}
+	device, err := f.device(deviceKind, deviceName)
+	if err != nil {
+		return err
+	}
+	stream.Device = device.Name
+	stream.DeviceIndex = device.Index
+	f.notify(kind)
+	return nil
+}
+
+// SetCardProfile switches the active profile of a card.
+func (f *FakeAudio) SetCardProfile(card, profile string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.record("SetCardProfile", card, profile); err != nil {
+		return err
+	}
+	for i := range f.SoundCards {
+		if f.SoundCards[i].Name != card {
+			continue
+		}
+		for _, candidate := range f.SoundCards[i].Profiles {
+			if candidate.Name == profile {
+				f.SoundCards[i].ActiveProfile = profile
+				f.notify("card")
+				return nil
+			}
+		}
+		return fmt.Errorf("card %s has no profile %s", card, profile)
+	}
+	return fmt.Errorf("no such card %s", card)
+}
+
+// Subscribe reports the kind of every change until ctx is cancelled.
+func (f *FakeAudio) Subscribe(ctx context.Context, changed func(kind string)) error {
+	kinds := make(chan string, 64)
+	f.mu.Lock()
+	if f.subscribers == nil {
+		f.subscribers = make(map[chan string]struct{})
+	}
+	f.subscribers[kinds] = struct{}{}
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		delete(f.subscribers, kinds)
+		f.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case kind := <-kinds:
+			changed(kind)
+		}
+	}
+}
+
+// Device returns a sink or source with the given name and channel volumes in
+// percent, e.g. Device("speakers", 50, 50) for a stereo device at 50%.
+func Device(name string, percents ...int) handlers.AudioInfo {
+	channels := make([]handlers.ChannelVolume, len(percents))
+	for i, percent := range percents {
+		channels[i].Channel = channelName(i, len(percents))
+		setChannel(&channels[i], int64(percent)*volumeNorm/100)
+	}
+	return handlers.AudioInfo{
+		Name:        name,
+		Description: name,
+		Volume:      averagePercent(channels),
+		Channels:    channels,
+		Balance:     balance(channels),
+	}
+}
+
+// Stream returns a stream of a kind attached to a device, with the given channel
+// volumes in percent.
+func Stream(kind string, index uint32, device handlers.AudioInfo, percents ...int) handlers.AudioStream {
+	info := Device("", percents...)
+	return handlers.AudioStream{
+		Index:       index,
+		Type:        kind,
+		Volume:      info.Volume,
+		Channels:    info.Channels,
+		Device:      device.Name,
+		DeviceIndex: device.Index,
+	}
+}
+
+// channelName names channel i of a mono or stereo device.
+func channelName(i, count int) string {
+	switch {
+	case count == 1:
+		return "mono"
+	case i == 0:
+		return "front-left"
+	case i == 1:
+		return "front-right"
+	}
+	return "aux" + strconv.Itoa(i-2)
+}
+
+// setChannel sets the raw volume of a channel and the values derived from it.
+func setChannel(channel *handlers.ChannelVolume, value int64) {
+	channel.Value = value
+	channel.Percent = int((value*100 + volumeNorm/2) / volumeNorm)
+	channel.DB = "-inf dB"
+	if value > 0 {
+		channel.DB = fmt.Sprintf("%0.2f dB", 60*math.Log10(float64(value)/volumeNorm))
+	}
+}
+
+// averagePercent returns the average volume of channels in percent.
+func averagePercent(channels []handlers.ChannelVolume) int {
+	if len(channels) == 0 {
+		return 0
+	}
+	total := 0
+	for _, channel := range channels {
+		total += channel.Percent
+	}
+	return total / len(channels)
+}
+
+// balance returns the balance of the front channels, -1 (left) to 1 (right).
+func balance(channels []handlers.ChannelVolume) float64 {
+	if len(channels) < 2 || channels[0].Value == channels[1].Value {
+		return 0
+	}
+	left, right := float64(channels[0].Value), float64(channels[1].Value)
+	if left > right {
+		return -1 + right/left
+	}
+	return 1 - left/right
+}
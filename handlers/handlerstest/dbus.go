@@ -0,0 +1,995 @@
+package handlerstest
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+const (
+	upowerService        = "org.freedesktop.UPower"
+	upowerPath           = "/org/freedesktop/UPower"
+	upowerDevice         = "org.freedesktop.UPower.Device"
+	ppdService           = "net.hadess.PowerProfiles"
+	ppdPath              = "/net/hadess/PowerProfiles"
+	nmService            = "org.freedesktop.NetworkManager"
+	nmPath               = "/org/freedesktop/NetworkManager"
+	nmDevice             = "org.freedesktop.NetworkManager.Device"
+	nmWireless           = "org.freedesktop.NetworkManager.Device.Wireless"
+	nmWired              = "org.freedesktop.NetworkManager.Device.Wired"
+	nmAccessPoint        = "org.freedesktop.NetworkManager.AccessPoint"
+	nmSettings           = "org.freedesktop.NetworkManager.Settings"
+	nmSettingsPath       = "/org/freedesktop/NetworkManager/Settings"
+	nmConnection         = "org.freedesktop.NetworkManager.Settings.Connection"
+	nmActiveConnection   = "org.freedesktop.NetworkManager.Connection.Active"
+	nmDeviceTypeEthernet = 1
+	nmDeviceTypeWifi     = 2
+	bluezService         = "org.bluez"
+	bluezAdapter         = "org.bluez.Adapter1"
+	bluezDevice          = "org.bluez.Device1"
+	bluezBattery         = "org.bluez.Battery1"
+)
+
+// busConfig lets every client own any name and talk to every other one.
+const busConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// Bus is a private dbus-daemon, stopped when the test ends.
+type Bus struct {
+	Address string
+}
+
+// StartBus starts a private dbus-daemon, skipping the test when dbus-daemon is
+// not installed.
+func StartBus(t testing.TB) *Bus {
+	t.Helper()
+
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not found")
+	}
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	if err := os.WriteFile(config, fmt.Appendf(nil, busConfig, filepath.Join(dir, "bus")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read dbus-daemon address: %v", err)
+	}
+	return &Bus{Address: strings.TrimSpace(address)}
+}
+
+// Conn opens a connection to the bus, closed when the test ends.
+func (b *Bus) Conn(t testing.TB) *dbus.Conn {
+	t.Helper()
+
+	conn, err := dbus.Connect(b.Address)
+	if err != nil {
+		t.Fatalf("failed to connect to %s: %v", b.Address, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// UPowerDevice is a device exported by the mock UPower service.
+type UPowerDevice struct {
+	Type        uint32 // 1 for line power, 2 for a battery, 5 for a mouse...
+	NativePath  string
+	Model       string
+	Vendor      string
+	PowerSupply bool
+	IsPresent   bool
+	Online      bool
+	Percentage  float64
+	State       uint32 // 1 charging, 2 discharging, 4 fully charged...
+
+	TimeToEmpty      int64 // seconds
+	TimeToFull       int64
+	EnergyRate       float64 // W
+	Energy           float64 // Wh
+	EnergyFull       float64
+	EnergyFullDesign float64
+	Voltage          float64
+	Temperature      float64
+	ChargeCycles     int32 // -1 when unknown
+	Capacity         float64
+
+	ChargeThresholdSupported bool
+	ChargeThresholdEnabled   bool
+	ChargeStartThreshold     uint32
+	ChargeEndThreshold       uint32
+
+	History    map[string][]UPowerHistoryItem    // by kind, "charge" or "rate"; GetHistory fails for missing kinds
+	Statistics map[string][]UPowerStatisticsItem // by kind, "charging" or "discharging"
+}
+
+// UPowerHistoryItem is a point returned by the GetHistory method of a device.
+type UPowerHistoryItem struct {
+	Time  uint32 // unix time
+	Value float64
+	State uint32
+}
+
+// UPowerStatisticsItem is a point returned by the GetStatistics method of a device.
+type UPowerStatisticsItem struct {
+	Value    float64
+	Accuracy float64
+}
+
+// UPower is a mock UPower service.
+type UPower struct {
+	display *prop.Properties
+	devices []*prop.Properties
+}
+
+// ExportUPower claims the UPower name on conn and exports devices, at
+// /org/freedesktop/UPower/devices/device0 and so on, and the display device
+// unless display is nil, as with UPower versions before 0.99.
+func ExportUPower(t testing.TB, conn *dbus.Conn, display *UPowerDevice, devices ...UPowerDevice) *UPower {
+	t.Helper()
+
+	requestName(t, conn, upowerService)
+
+	u := &UPower{}
+	var paths []dbus.ObjectPath
+	for i, device := range devices {
+		path := dbus.ObjectPath(fmt.Sprintf("%s/devices/device%d", upowerPath, i))
+		u.devices = append(u.devices, exportUPowerDevice(t, conn, path, device))
+		paths = append(paths, path)
+	}
+
+	methods := map[string]any{
+		"EnumerateDevices": func() ([]dbus.ObjectPath, *dbus.Error) { return paths, nil },
+	}
+	if display != nil {
+		path := dbus.ObjectPath(upowerPath + "/devices/DisplayDevice")
+		u.display = exportUPowerDevice(t, conn, path, *display)
+		methods["GetDisplayDevice"] = func() (dbus.ObjectPath, *dbus.Error) { return path, nil }
+	}
+	exportMethods(t, conn, upowerPath, upowerService, methods)
+	return u
+}
+
+// exportUPowerDevice exports the properties and methods of a UPower device.
+func exportUPowerDevice(t testing.TB, conn *dbus.Conn, path dbus.ObjectPath, device UPowerDevice) *prop.Properties {
+	var props *prop.Properties
+	exportMethods(t, conn, string(path), upowerDevice, map[string]any{
+		"EnableChargeThreshold": func(enabled bool) *dbus.Error {
+			if !device.ChargeThresholdSupported {
+				return dbus.MakeFailedError(fmt.Errorf("charge threshold not supported"))
+			}
+			props.SetMust(upowerDevice, "ChargeThresholdEnabled", enabled)
+			return nil
+		},
+		"GetHistory": func(kind string, timespan, resolution uint32) ([]UPowerHistoryItem, *dbus.Error) {
+			items, ok := device.History[kind]
+			if !ok {
+				return nil, dbus.MakeFailedError(fmt.Errorf("no %s history", kind))
+			}
+			return items, nil
+		},
+		"GetStatistics": func(kind string) ([]UPowerStatisticsItem, *dbus.Error) {
+			return device.Statistics[kind], nil
+		},
+	})
+
+	props = exportProperties(t, conn, path, map[string]map[string]*prop.Prop{
+		upowerDevice: {
+			"Type":        property(device.Type),
+			"NativePath":  property(device.NativePath),
+			"Model":       property(device.Model),
+			"Vendor":      property(device.Vendor),
+			"Serial":      property(""),
+			"PowerSupply": property(device.PowerSupply),
+			"IsPresent":   property(device.IsPresent),
+			"Online":      property(device.Online),
+			"Percentage":  property(device.Percentage),
+			"State":       property(device.State),
+
+			"TimeToEmpty":      property(device.TimeToEmpty),
+			"TimeToFull":       property(device.TimeToFull),
+			"EnergyRate":       property(device.EnergyRate),
+			"Energy":           property(device.Energy),
+			"EnergyFull":       property(device.EnergyFull),
+			"EnergyFullDesign": property(device.EnergyFullDesign),
+			"Voltage":          property(device.Voltage),
+			"Temperature":      property(device.Temperature),
+			"ChargeCycles":     property(device.ChargeCycles),
+			"Capacity":         property(device.Capacity),
+			"HasHistory":       property(device.History != nil),
+			"HasStatistics":    property(device.Statistics != nil),
+
+			"ChargeThresholdSupported": property(device.ChargeThresholdSupported),
+			"ChargeThresholdEnabled":   property(device.ChargeThresholdEnabled),
+			"ChargeStartThreshold":     property(device.ChargeStartThreshold),
+			"ChargeEndThreshold":       property(device.ChargeEndThreshold),
+		},
+	})
+	return props
+}
+
+// Set changes a property of device i, emitting PropertiesChanged.
+func (u *UPower) Set(i int, name string, value any) {
+	u.devices[i].SetMust(upowerDevice, name, value)
+}
+
+// SetDisplay changes a property of the display device, emitting PropertiesChanged.
+func (u *UPower) SetDisplay(name string, value any) {
+	u.display.SetMust(upowerDevice, name, value)
+}
+
+// PowerProfiles is a mock power-profiles-daemon service.
+type PowerProfiles struct {
+	props *prop.Properties
+}
+
+// ExportPowerProfiles claims the power-profiles-daemon name on conn and exports
+// profiles implemented by driver, with active selected.
+func ExportPowerProfiles(t testing.TB, conn *dbus.Conn, driver, active string, profiles ...string) *PowerProfiles {
+	t.Helper()
+
+	requestName(t, conn, ppdService)
+
+	list := make([]map[string]dbus.Variant, len(profiles))
+	for i, profile := range profiles {
+		list[i] = map[string]dbus.Variant{"Profile": dbus.MakeVariant(profile), "Driver": dbus.MakeVariant(driver)}
+	}
+	props := exportProperties(t, conn, ppdPath, map[string]map[string]*prop.Prop{
+		ppdService: {
+			"ActiveProfile":       {Value: active, Writable: true, Emit: prop.EmitTrue},
+			"Profiles":            property(list),
+			"PerformanceDegraded": property(""),
+		},
+	})
+	return &PowerProfiles{props: props}
+}
+
+// Active returns the active profile.
+func (p *PowerProfiles) Active() string {
+	return p.props.GetMust(ppdService, "ActiveProfile").(string)
+}
+
+// NetworkDevice is a device exported by the mock NetworkManager service.
+type NetworkDevice struct {
+	Interface  string
+	DeviceType uint32 // 1 for ethernet, 2 for Wi-Fi
+	Address    string // IPv4 address in a /24 when IP4 is nil, none if empty
+	SSID       string // active access point of a Wi-Fi device, none if empty
+	Strength   uint8
+	HwAddress  string
+	Mtu        uint32
+	Speed      uint32 // Mb/s
+
+	State           uint32 // 30 disconnected, 100 activated...
+	StateReason     uint32 // 39 user requested, 40 carrier changed...
+	IP4Connectivity uint32 // 4 for full
+
+	IP4 *IPConfig
+	IP6 *IPConfig
+
+	AccessPoints []AccessPoint // visible by a Wi-Fi device besides the active one
+}
+
+// IPConfig is an IP configuration exported by the mock NetworkManager service.
+type IPConfig struct {
+	Addresses   []string // with prefix, e.g. "10.0.0.5/24"
+	Gateway     string
+	Nameservers []string
+	Domains     []string
+	DHCP        map[string]string // DHCP options, no lease if nil
+}
+
+// AccessPoint is an access point exported by the mock NetworkManager service.
+type AccessPoint struct {
+	SSID      string
+	BSSID     string
+	Frequency uint32 // MHz
+	Strength  uint8
+	Flags     uint32 // 1 if it requires privacy
+	WpaFlags  uint32 // 0x100 for PSK, 0x200 for 802.1X, 0x400 for SAE...
+	RsnFlags  uint32
+}
+
+// Connection is a connection profile saved in the mock NetworkManager service.
+type Connection struct {
+	Path string // set by the mock
+	ID   string
+	UUID string
+	Type string // "802-11-wireless", "802-3-ethernet"...
+
+	// Settings of Wi-Fi connections.
+	SSID    string
+	Hidden  bool
+	KeyMgmt string // "wpa-psk", "sae"... none if empty
+	PSK     string
+
+	VPNService string // plugin of a "vpn" connection, e.g. "org.freedesktop.NetworkManager.openvpn"
+}
+
+// Activation is a connection activated through the mock NetworkManager service.
+type Activation struct {
+	Connection     dbus.ObjectPath
+	Device         dbus.ObjectPath
+	SpecificObject dbus.ObjectPath // access point of a Wi-Fi connection
+}
+
+// stateReason is the StateReason property of a device, a (uu) structure.
+type stateReason struct {
+	State  uint32
+	Reason uint32
+}
+
+// NetworkManager is a mock NetworkManager service, connected with full
+// connectivity unless changed with SetGlobal.
+type NetworkManager struct {
+	conn         *dbus.Conn
+	manager      *prop.Properties
+	devices      []*prop.Properties
+	devicePaths  []dbus.ObjectPath
+	accessPoints int
+
+	mu           sync.Mutex
+	connections  []Connection
+	saved        int // connections saved so far, numbering their paths
+	activations  []Activation
+	active       []dbus.ObjectPath // active connections
+	disconnected []dbus.ObjectPath
+	scans        int
+}
+
+// ExportNetworkManager claims the NetworkManager name on conn and exports devices,
+// at /org/freedesktop/NetworkManager/Devices/0 and so on, with their IPv4
+// configurations and access points, and the connection profile settings.
+func ExportNetworkManager(t testing.TB, conn *dbus.Conn, devices ...NetworkDevice) *NetworkManager {
+	t.Helper()
+
+	requestName(t, conn, nmService)
+
+	nm := &NetworkManager{conn: conn}
+	for i, device := range devices {
+		path := dbus.ObjectPath(fmt.Sprintf("%s/Devices/%d", nmPath, i))
+
+		ip4 := device.IP4
+		if ip4 == nil && device.Address != "" {
+			ip4 = &IPConfig{Addresses: []string{device.Address + "/24"}}
+		}
+		ip4Config, dhcp4Config := exportIPConfig(t, conn, fmt.Sprintf("%d", i), ip4, false)
+		ip6Config, dhcp6Config := exportIPConfig(t, conn, fmt.Sprintf("%d", i), device.IP6, true)
+
+		props := map[string]map[string]*prop.Prop{
+			nmDevice: {
+				"Interface":        property(device.Interface),
+				"DeviceType":       property(device.DeviceType),
+				"State":            property(device.State),
+				"StateReason":      property(stateReason{device.State, device.StateReason}),
+				"Ip4Connectivity":  property(device.IP4Connectivity),
+				"ActiveConnection": property(dbus.ObjectPath("/")),
+				"HwAddress":        property(device.HwAddress),
+				"Mtu":              property(device.Mtu),
+				"Ip4Config":        property(ip4Config),
+				"Ip6Config":        property(ip6Config),
+				"Dhcp4Config":      property(dhcp4Config),
+				"Dhcp6Config":      property(dhcp6Config),
+			},
+		}
+		if device.DeviceType == nmDeviceTypeEthernet {
+			props[nmWired] = map[string]*prop.Prop{"Speed": property(device.Speed)}
+		}
+		if device.DeviceType == nmDeviceTypeWifi {
+			props[nmWireless] = nm.exportWireless(t, i, path, device)
+		}
+
+		exportMethods(t, conn, string(path), nmDevice, map[string]any{
+			"Disconnect": func() *dbus.Error {
+				nm.mu.Lock()
+				defer nm.mu.Unlock()
+				nm.disconnected = append(nm.disconnected, path)
+				return nil
+			},
+		})
+		nm.devices = append(nm.devices, exportProperties(t, conn, path, props))
+		nm.devicePaths = append(nm.devicePaths, path)
+	}
+
+	nm.manager = exportProperties(t, conn, nmPath, map[string]map[string]*prop.Prop{
+		nmService: {
+			"State":             property(uint32(70)),
+			"Connectivity":      property(uint32(4)),
+			"PrimaryConnection": property(dbus.ObjectPath("/")),
+			"ActiveConnections": property([]dbus.ObjectPath{}),
+
+			"NetworkingEnabled":       property(true),
+			"WirelessEnabled":         {Value: true, Writable: true, Emit: prop.EmitTrue},
+			"WirelessHardwareEnabled": property(true),
+			"WwanEnabled":             {Value: true, Writable: true, Emit: prop.EmitTrue},
+			"WwanHardwareEnabled":     property(true),
+		},
+	})
+	exportMethods(t, conn, nmPath, nmService, map[string]any{
+		"GetDevices": func() ([]dbus.ObjectPath, *dbus.Error) { return nm.devicePaths, nil },
+		"Enable": func(enable bool) *dbus.Error {
+			if nm.manager.GetMust(nmService, "NetworkingEnabled") == enable {
+				return dbus.MakeFailedError(fmt.Errorf("already %s", map[bool]string{true: "enabled", false: "disabled"}[enable]))
+			}
+			nm.manager.SetMust(nmService, "NetworkingEnabled", enable)
+			return nil
+		},
+		"ActivateConnection": func(connection, device, specificObject dbus.ObjectPath) (dbus.ObjectPath, *dbus.Error) {
+			nm.mu.Lock()
+			defer nm.mu.Unlock()
+			if !slices.ContainsFunc(nm.connections, func(c Connection) bool { return c.Path == string(connection) }) {
+				return "", dbus.MakeFailedError(fmt.Errorf("unknown connection %s", connection))
+			}
+			active, err := nm.activate(Activation{connection, device, specificObject})
+			if err != nil {
+				return "", dbus.MakeFailedError(err)
+			}
+			return active, nil
+		},
+		"DeactivateConnection": func(active dbus.ObjectPath) *dbus.Error {
+			nm.mu.Lock()
+			defer nm.mu.Unlock()
+			if err := nm.deactivate(active); err != nil {
+				return dbus.MakeFailedError(err)
+			}
+			return nil
+		},
+		"AddAndActivateConnection": func(settings map[string]map[string]dbus.Variant, device, specificObject dbus.ObjectPath) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+			nm.mu.Lock()
+			defer nm.mu.Unlock()
+			path, err := nm.save(connectionFromSettings(settings))
+			if err != nil {
+				return "", "", dbus.MakeFailedError(err)
+			}
+			active, err := nm.activate(Activation{path, device, specificObject})
+			if err != nil {
+				return "", "", dbus.MakeFailedError(err)
+			}
+			return path, active, nil
+		},
+	})
+	exportMethods(t, conn, nmSettingsPath, nmSettings, map[string]any{
+		"ListConnections": func() ([]dbus.ObjectPath, *dbus.Error) {
+			nm.mu.Lock()
+			defer nm.mu.Unlock()
+			paths := make([]dbus.ObjectPath, len(nm.connections))
+			for i, connection := range nm.connections {
+				paths[i] = dbus.ObjectPath(connection.Path)
+			}
+			return paths, nil
+		},
+	})
+	return nm
+}
+
+// exportWireless exports the access points of Wi-Fi device i and the methods of
+// its Wireless interface, returning the properties of that interface.
+func (nm *NetworkManager) exportWireless(t testing.TB, i int, path dbus.ObjectPath, device NetworkDevice) map[string]*prop.Prop {
+	t.Helper()
+
+	active := dbus.ObjectPath("/")
+	var accessPoints []dbus.ObjectPath
+	if device.SSID != "" {
+		active = nm.exportAccessPoint(t, AccessPoint{SSID: device.SSID, Strength: device.Strength})
+		accessPoints = append(accessPoints, active)
+	}
+	for _, accessPoint := range device.AccessPoints {
+		accessPoints = append(accessPoints, nm.exportAccessPoint(t, accessPoint))
+	}
+
+	var lastScan int64
+	exportMethods(t, nm.conn, string(path), nmWireless, map[string]any{
+		"GetAllAccessPoints": func() ([]dbus.ObjectPath, *dbus.Error) { return accessPoints, nil },
+		"RequestScan": func(options map[string]dbus.Variant) *dbus.Error {
+			nm.mu.Lock()
+			defer nm.mu.Unlock()
+			nm.scans++
+			lastScan++
+			nm.devices[i].SetMust(nmWireless, "LastScan", lastScan)
+			return nil
+		},
+	})
+	return map[string]*prop.Prop{
+		"ActiveAccessPoint": property(active),
+		"LastScan":          property(lastScan),
+		"Bitrate":           property(device.Speed * 1000),
+	}
+}
+
+// exportIPConfig exports an IPv4 or IPv6 configuration and its DHCP lease at
+// IP4Config/id, DHCP4Config/id and so on, returning their paths or "/" for none.
+func exportIPConfig(t testing.TB, conn *dbus.Conn, id string, config *IPConfig, ipv6 bool) (dbus.ObjectPath, dbus.ObjectPath) {
+	t.Helper()
+
+	version, configPath, dhcpPath := "4", dbus.ObjectPath("/"), dbus.ObjectPath("/")
+	if ipv6 {
+		version = "6"
+	}
+	if config == nil {
+		return configPath, dhcpPath
+	}
+
+	addresses := []map[string]dbus.Variant{}
+	for _, address := range config.Addresses {
+		prefix, err := netip.ParsePrefix(address)
+		if err != nil {
+			t.Fatalf("invalid address %s: %v", address, err)
+		}
+		addresses = append(addresses, map[string]dbus.Variant{
+			"address": dbus.MakeVariant(prefix.Addr().String()),
+			"prefix":  dbus.MakeVariant(uint32(prefix.Bits())),
+		})
+	}
+	props := map[string]*prop.Prop{
+		"AddressData": property(addresses),
+		"Gateway":     property(config.Gateway),
+		"Domains":     property(append([]string{}, config.Domains...)),
+		"Searches":    property([]string{}),
+	}
+	if ipv6 {
+		nameservers := [][]byte{}
+		for _, nameserver := range config.Nameservers {
+			nameservers = append(nameservers, netip.MustParseAddr(nameserver).AsSlice())
+		}
+		props["Nameservers"] = property(nameservers)
+	} else {
+		// NetworkManager reports IPv4 nameservers twice, as NameserverData and
+		// as deprecated integers in network byte order.
+		data, nameservers := []map[string]dbus.Variant{}, []uint32{}
+		for _, nameserver := range config.Nameservers {
+			ip := netip.MustParseAddr(nameserver).As4()
+			data = append(data, map[string]dbus.Variant{"address": dbus.MakeVariant(nameserver)})
+			nameservers = append(nameservers, uint32(ip[0])|uint32(ip[1])<<8|uint32(ip[2])<<16|uint32(ip[3])<<24)
+		}
+		props["NameserverData"] = property(data)
+		props["Nameservers"] = property(nameservers)
+	}
+	configPath = dbus.ObjectPath(fmt.Sprintf("%s/IP%sConfig/%s", nmPath, version, id))
+	exportProperties(t, conn, configPath, map[string]map[string]*prop.Prop{nmService + ".IP" + version + "Config": props})
+
+	if config.DHCP != nil {
+		options := make(map[string]dbus.Variant, len(config.DHCP))
+		for key, value := range config.DHCP {
+			options[key] = dbus.MakeVariant(value)
+		}
+		dhcpPath = dbus.ObjectPath(fmt.Sprintf("%s/DHCP%sConfig/%s", nmPath, version, id))
+		exportProperties(t, conn, dhcpPath, map[string]map[string]*prop.Prop{
+			nmService + ".DHCP" + version + "Config": {"Options": property(options)},
+		})
+	}
+	return configPath, dhcpPath
+}
+
+// exportAccessPoint exports an access point at the next AccessPoint/N path.
+func (nm *NetworkManager) exportAccessPoint(t testing.TB, accessPoint AccessPoint) dbus.ObjectPath {
+	t.Helper()
+
+	path := dbus.ObjectPath(fmt.Sprintf("%s/AccessPoint/%d", nmPath, nm.accessPoints))
+	nm.accessPoints++
+	exportProperties(t, nm.conn, path, map[string]map[string]*prop.Prop{
+		nmAccessPoint: {
+			"Ssid":       property([]byte(accessPoint.SSID)),
+			"HwAddress":  property(accessPoint.BSSID),
+			"Frequency":  property(accessPoint.Frequency),
+			"MaxBitrate": property(uint32(0)),
+			"Strength":   property(accessPoint.Strength),
+			"Flags":      property(accessPoint.Flags),
+			"WpaFlags":   property(accessPoint.WpaFlags),
+			"RsnFlags":   property(accessPoint.RsnFlags),
+		},
+	})
+	return path
+}
+
+// AddConnection saves a connection profile, at
+// /org/freedesktop/NetworkManager/Settings/0 and so on.
+func (nm *NetworkManager) AddConnection(t testing.TB, connection Connection) {
+	t.Helper()
+
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	if _, err := nm.save(connection); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Connections returns the saved connection profiles.
+func (nm *NetworkManager) Connections() []Connection {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	return append([]Connection(nil), nm.connections...)
+}
+
+// Activations returns the connections activated so far.
+func (nm *NetworkManager) Activations() []Activation {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	return append([]Activation(nil), nm.activations...)
+}
+
+// Disconnected returns the paths of the devices disconnected so far.
+func (nm *NetworkManager) Disconnected() []dbus.ObjectPath {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	return append([]dbus.ObjectPath(nil), nm.disconnected...)
+}
+
+// save exports a connection profile and its methods. It must be called with nm.mu held.
+func (nm *NetworkManager) save(connection Connection) (dbus.ObjectPath, error) {
+	path := dbus.ObjectPath(fmt.Sprintf("%s/%d", nmSettingsPath, nm.saved))
+	connection.Path = string(path)
+	if connection.UUID == "" {
+		connection.UUID = fmt.Sprintf("00000000-0000-4000-8000-%012d", nm.saved)
+	}
+	settings := connectionSettings(connection)
+
+	err := nm.conn.ExportMethodTable(map[string]any{
+		"GetSettings": func() (map[string]map[string]dbus.Variant, *dbus.Error) { return settings, nil },
+		"Delete": func() *dbus.Error {
+			nm.mu.Lock()
+			defer nm.mu.Unlock()
+			nm.connections = slices.DeleteFunc(nm.connections, func(c Connection) bool { return c.Path == string(path) })
+			nm.conn.Export(nil, path, nmConnection)
+			return nil
+		},
+	}, path, nmConnection)
+	if err != nil {
+		return "", fmt.Errorf("failed to export connection %s: %w", path, err)
+	}
+
+	nm.saved++
+	nm.connections = append(nm.connections, connection)
+	return path, nil
+}
+
+// activate exports an active connection, at ActiveConnection/0 and so on, as
+// the active connection of its device and, unless it is a VPN, the primary
+// connection, and returns its path. It must be called with nm.mu held.
+func (nm *NetworkManager) activate(activation Activation) (dbus.ObjectPath, error) {
+	index := slices.IndexFunc(nm.connections, func(c Connection) bool { return c.Path == string(activation.Connection) })
+	connection := nm.connections[index]
+	path := dbus.ObjectPath(fmt.Sprintf("%s/ActiveConnection/%d", nmPath, len(nm.activations)))
+
+	devices := []dbus.ObjectPath{}
+	if activation.Device != "/" {
+		devices = append(devices, activation.Device)
+	}
+	_, err := prop.Export(nm.conn, path, map[string]map[string]*prop.Prop{
+		nmActiveConnection: {
+			"Id":             property(connection.ID),
+			"Uuid":           property(connection.UUID),
+			"Type":           property(connection.Type),
+			"State":          property(uint32(2)), // activated
+			"Connection":     property(activation.Connection),
+			"SpecificObject": property(activation.SpecificObject),
+			"Devices":        property(devices),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to export active connection %s: %w", path, err)
+	}
+
+	nm.activations = append(nm.activations, activation)
+	nm.active = append(nm.active, path)
+	nm.manager.SetMust(nmService, "ActiveConnections", slices.Clone(nm.active))
+	if connection.Type != "vpn" && connection.Type != "wireguard" {
+		nm.manager.SetMust(nmService, "PrimaryConnection", path)
+	}
+	if i := slices.Index(nm.devicePaths, activation.Device); i >= 0 {
+		nm.devices[i].SetMust(nmDevice, "ActiveConnection", path)
+	}
+	return path, nil
+}
+
+// deactivate removes an active connection from NetworkManager and its device. It
+// must be called with nm.mu held.
+func (nm *NetworkManager) deactivate(active dbus.ObjectPath) error {
+	if !slices.Contains(nm.active, active) {
+		return fmt.Errorf("connection %s is not active", active)
+	}
+	nm.active = slices.DeleteFunc(nm.active, func(path dbus.ObjectPath) bool { return path == active })
+	nm.manager.SetMust(nmService, "ActiveConnections", slices.Clone(nm.active))
+	if nm.manager.GetMust(nmService, "PrimaryConnection") == active {
+		nm.manager.SetMust(nmService, "PrimaryConnection", dbus.ObjectPath("/"))
+	}
+	for _, device := range nm.devices {
+		if device.GetMust(nmDevice, "ActiveConnection") == active {
+			device.SetMust(nmDevice, "ActiveConnection", dbus.ObjectPath("/"))
+		}
+	}
+	return nil
+}
+
+// connectionSettings returns the settings of a connection profile as returned by GetSettings.
+func connectionSettings(connection Connection) map[string]map[string]dbus.Variant {
+	settings := map[string]map[string]dbus.Variant{
+		"connection": {
+			"id":   dbus.MakeVariant(connection.ID),
+			"uuid": dbus.MakeVariant(connection.UUID),
+			"type": dbus.MakeVariant(connection.Type),
+		},
+	}
+	if connection.SSID != "" {
+		settings["802-11-wireless"] = map[string]dbus.Variant{
+			"ssid":   dbus.MakeVariant([]byte(connection.SSID)),
+			"hidden": dbus.MakeVariant(connection.Hidden),
+		}
+	}
+	if connection.VPNService != "" {
+		settings["vpn"] = map[string]dbus.Variant{"service-type": dbus.MakeVariant(connection.VPNService)}
+	}
+	if connection.KeyMgmt != "" {
+		// NetworkManager never returns secrets like the PSK with the settings.
+		settings["802-11-wireless-security"] = map[string]dbus.Variant{"key-mgmt": dbus.MakeVariant(connection.KeyMgmt)}
+	}
+	return settings
+}
+
+// connectionFromSettings reads a connection profile from settings passed to
+// AddAndActivateConnection.
+func connectionFromSettings(settings map[string]map[string]dbus.Variant) Connection {
+	value := func(setting, key string) any { return settings[setting][key].Value() }
+	connection := Connection{}
+	connection.ID, _ = value("connection", "id").(string)
+	connection.UUID, _ = value("connection", "uuid").(string)
+	connection.Type, _ = value("connection", "type").(string)
+	ssid, _ := value("802-11-wireless", "ssid").([]byte)
+	connection.SSID = string(ssid)
+	connection.Hidden, _ = value("802-11-wireless", "hidden").(bool)
+	connection.KeyMgmt, _ = value("802-11-wireless-security", "key-mgmt").(string)
+	connection.PSK, _ = value("802-11-wireless-security", "psk").(string)
+	return connection
+}
+
+// Scans returns how many scans the Wi-Fi devices were asked for.
+func (nm *NetworkManager) Scans() int {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	return nm.scans
+}
+
+// SetGlobal changes a property of NetworkManager itself, e.g. "Connectivity" or
+// "WirelessHardwareEnabled", emitting PropertiesChanged.
+func (nm *NetworkManager) SetGlobal(name string, value any) {
+	nm.manager.SetMust(nmService, name, value)
+}
+
+// Set changes a property of the Device interface of device i, emitting PropertiesChanged.
+func (nm *NetworkManager) Set(i int, name string, value any) {
+	nm.devices[i].SetMust(nmDevice, name, value)
+}
+
+// BluetoothAdapter describes an adapter exported by ExportBlueZ, at
+// /org/bluez/<Name>.
+type BluetoothAdapter struct {
+	Name    string // e.g. "hci0"
+	Address string
+	Alias   string
+	Powered bool
+}
+
+// BluetoothDevice describes a device exported by ExportBlueZ under its adapter.
+type BluetoothDevice struct {
+	Adapter   string // name of the adapter, e.g. "hci0"
+	Address   string
+	Alias     string
+	Icon      string
+	Paired    bool
+	Connected bool
+	RSSI      int16 // not exported if 0
+	Battery   uint8 // percentage, without a Battery1 interface if 0
+}
+
+// BlueZ is a mock BlueZ service. Pairing always succeeds, as if the user
+// accepted it on both sides.
+type BlueZ struct {
+	mu      sync.Mutex
+	objects map[dbus.ObjectPath]*prop.Properties
+	removed []dbus.ObjectPath
+}
+
+// ExportBlueZ claims the BlueZ name on conn and exports adapters and devices with
+// an object manager at /.
+func ExportBlueZ(t testing.TB, conn *dbus.Conn, adapters []BluetoothAdapter, devices ...BluetoothDevice) *BlueZ {
+	t.Helper()
+
+	requestName(t, conn, bluezService)
+
+	bluez := &BlueZ{objects: map[dbus.ObjectPath]*prop.Properties{}}
+	for _, adapter := range adapters {
+		path := dbus.ObjectPath("/org/bluez/" + adapter.Name)
+		props := exportProperties(t, conn, path, map[string]map[string]*prop.Prop{
+			bluezAdapter: {
+				"Address":      property(adapter.Address),
+				"Alias":        property(adapter.Alias),
+				"Powered":      {Value: adapter.Powered, Writable: true, Emit: prop.EmitTrue},
+				"Discoverable": property(false),
+				"Pairable":     property(true),
+				"Discovering":  property(false),
+			},
+		})
+		exportMethods(t, conn, string(path), bluezAdapter, map[string]any{
+			"StartDiscovery": func() *dbus.Error {
+				if !props.GetMust(bluezAdapter, "Powered").(bool) {
+					return dbus.NewError("org.bluez.Error.NotReady", []any{"Resource Not Ready"})
+				}
+				if props.GetMust(bluezAdapter, "Discovering").(bool) {
+					return dbus.NewError("org.bluez.Error.InProgress", []any{"Operation already in progress"})
+				}
+				props.SetMust(bluezAdapter, "Discovering", true)
+				return nil
+			},
+			"StopDiscovery": func() *dbus.Error {
+				if !props.GetMust(bluezAdapter, "Discovering").(bool) {
+					return dbus.NewError("org.bluez.Error.Failed", []any{"No discovery started"})
+				}
+				props.SetMust(bluezAdapter, "Discovering", false)
+				return nil
+			},
+			"RemoveDevice": func(device dbus.ObjectPath) *dbus.Error {
+				bluez.mu.Lock()
+				defer bluez.mu.Unlock()
+				if _, ok := bluez.objects[device]; !ok || !strings.HasPrefix(string(device), string(path)+"/") {
+					return dbus.NewError("org.bluez.Error.DoesNotExist", []any{"Does Not Exist"})
+				}
+				delete(bluez.objects, device)
+				bluez.removed = append(bluez.removed, device)
+				return nil
+			},
+		})
+		bluez.objects[path] = props
+	}
+
+	for _, device := range devices {
+		adapter := dbus.ObjectPath("/org/bluez/" + device.Adapter)
+		path := adapter + dbus.ObjectPath("/dev_"+strings.ReplaceAll(device.Address, ":", "_"))
+		interfaces := map[string]map[string]*prop.Prop{
+			bluezDevice: {
+				"Address":   property(device.Address),
+				"Alias":     property(device.Alias),
+				"Icon":      property(device.Icon),
+				"Adapter":   property(adapter),
+				"Paired":    property(device.Paired),
+				"Trusted":   {Value: device.Paired, Writable: true, Emit: prop.EmitTrue},
+				"Connected": property(device.Connected),
+				"Blocked":   property(false),
+			},
+		}
+		if device.RSSI != 0 {
+			interfaces[bluezDevice]["RSSI"] = property(device.RSSI)
+		}
+		if device.Battery != 0 {
+			interfaces[bluezBattery] = map[string]*prop.Prop{"Percentage": property(device.Battery)}
+		}
+		props := exportProperties(t, conn, path, interfaces)
+		exportMethods(t, conn, string(path), bluezDevice, map[string]any{
+			"Connect": func() *dbus.Error {
+				props.SetMust(bluezDevice, "Connected", true)
+				return nil
+			},
+			"Disconnect": func() *dbus.Error {
+				props.SetMust(bluezDevice, "Connected", false)
+				return nil
+			},
+			"Pair": func() *dbus.Error {
+				if props.GetMust(bluezDevice, "Paired").(bool) {
+					return dbus.NewError("org.bluez.Error.AlreadyExists", []any{"Already Exists"})
+				}
+				props.SetMust(bluezDevice, "Paired", true)
+				return nil
+			},
+		})
+		bluez.objects[path] = props
+	}
+
+	exportMethods(t, conn, "/", "org.freedesktop.DBus.ObjectManager", map[string]any{
+		"GetManagedObjects": func() (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, *dbus.Error) {
+			bluez.mu.Lock()
+			defer bluez.mu.Unlock()
+			objects := map[dbus.ObjectPath]map[string]map[string]dbus.Variant{}
+			for path, props := range bluez.objects {
+				objects[path] = map[string]map[string]dbus.Variant{}
+				for _, iface := range []string{bluezAdapter, bluezDevice, bluezBattery} {
+					if values, err := props.GetAll(iface); err == nil {
+						objects[path][iface] = values
+					}
+				}
+			}
+			return objects, nil
+		},
+	})
+	return bluez
+}
+
+// Get returns a property of the adapter or device at path, e.g. "Powered" or "Trusted".
+func (b *BlueZ) Get(path, name string) any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	iface := bluezDevice
+	if strings.Count(path, "/") == 3 {
+		iface = bluezAdapter
+	}
+	return b.objects[dbus.ObjectPath(path)].GetMust(iface, name)
+}
+
+// Removed returns the paths of the devices removed so far.
+func (b *BlueZ) Removed() []dbus.ObjectPath {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]dbus.ObjectPath(nil), b.removed...)
+}
+
+// property returns a read-only property emitting PropertiesChanged with its value.
+func property(value any) *prop.Prop {
+	return &prop.Prop{Value: value, Emit: prop.EmitTrue}
+}
+
+// requestName claims a well-known name on conn.
+func requestName(t testing.TB, conn *dbus.Conn, name string) {
+	t.Helper()
+
+	reply, err := conn.RequestName(name, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		t.Fatalf("failed to request %s: %v", name, err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("%s is already owned", name)
+	}
+}
+
+// exportProperties exports the properties of an object.
+func exportProperties(t testing.TB, conn *dbus.Conn, path dbus.ObjectPath, props map[string]map[string]*prop.Prop) *prop.Properties {
+	t.Helper()
+
+	properties, err := prop.Export(conn, path, props)
+	if err != nil {
+		t.Fatalf("failed to export properties of %s: %v", path, err)
+	}
+	return properties
+}
+
+// exportMethods exports methods of an object on an interface.
+func exportMethods(t testing.TB, conn *dbus.Conn, path, iface string, methods map[string]any) {
+	t.Helper()
+
+	if err := conn.ExportMethodTable(methods, dbus.ObjectPath(path), iface); err != nil {
+		t.Fatalf("failed to export %s on %s: %v", iface, path, err)
+	}
+}
@@ -0,0 +1,218 @@
+package handlerstest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/giftpilz0/sysutil/handlers"
+)
+
+// FakeNetwork is an in-memory handlers.NetworkBackend.
+type FakeNetwork struct {
+	mu           sync.Mutex
+	devices      []handlers.NetworkDevice
+	status       handlers.NetworkStatus
+	accessPoints []handlers.AccessPoint
+	connections  []handlers.ConnectionProfile
+	active       []handlers.ActiveConnection
+	radios       handlers.NetworkRadios
+	scans        int
+	calls        []string
+	err          error
+	changes      chan struct{}
+}
+
+// NewFakeNetwork creates a network backend reporting devices.
+func NewFakeNetwork(devices ...handlers.NetworkDevice) *FakeNetwork {
+	radios := handlers.NetworkRadios{Networking: true, Wireless: true, WirelessHardware: true, Wwan: true, WwanHardware: true}
+	return &FakeNetwork{devices: devices, radios: radios, changes: make(chan struct{}, 1)}
+}
+
+// Set changes the reported devices and error, and notifies the subscriber.
+func (f *FakeNetwork) Set(devices []handlers.NetworkDevice, err error) {
+	f.mu.Lock()
+	f.devices, f.err = devices, err
+	f.mu.Unlock()
+	notify(f.changes)
+}
+
+// Devices returns the devices passed to NewFakeNetwork or Set.
+func (f *FakeNetwork) Devices() ([]handlers.NetworkDevice, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]handlers.NetworkDevice(nil), f.devices...), f.err
+}
+
+// SetStatus changes the status returned by Status.
+func (f *FakeNetwork) SetStatus(status handlers.NetworkStatus) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+}
+
+// Status returns the status passed to SetStatus.
+func (f *FakeNetwork) Status() (handlers.NetworkStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.status, f.err
+}
+
+// SetAccessPoints changes the access points returned by ScanWifi.
+func (f *FakeNetwork) SetAccessPoints(accessPoints ...handlers.AccessPoint) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.accessPoints = accessPoints
+}
+
+// ScanWifi returns the access points passed to SetAccessPoints, counting rescans.
+func (f *FakeNetwork) ScanWifi(rescan bool) ([]handlers.AccessPoint, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if rescan {
+		f.scans++
+	}
+	return append([]handlers.AccessPoint{}, f.accessPoints...), f.err
+}
+
+// Scans returns how many times ScanWifi was asked to rescan.
+func (f *FakeNetwork) Scans() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.scans
+}
+
+// SetConnections changes the profiles returned by Connections.
+func (f *FakeNetwork) SetConnections(connections ...handlers.ConnectionProfile) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connections = connections
+}
+
+// Connections returns the profiles passed to SetConnections or added since.
+func (f *FakeNetwork) Connections() ([]handlers.ConnectionProfile, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]handlers.ConnectionProfile{}, f.connections...), f.err
+}
+
+// ActivateConnection records the activation and marks the profile activated.
+func (f *FakeNetwork) ActivateConnection(connection, device string) error {
+	if err := f.record("ActivateConnection", connection, device); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	active := handlers.ActiveConnection{
+		Path:       fmt.Sprintf("/fake/ActiveConnection/%d", len(f.calls)),
+		Connection: connection,
+		State:      "activated",
+		Devices:    []string{},
+	}
+	if device != "/" {
+		active.Devices = append(active.Devices, device)
+	}
+	f.active = append(f.active, active)
+	return nil
+}
+
+// ActiveConnections returns the connections activated and not deactivated since.
+func (f *FakeNetwork) ActiveConnections() ([]handlers.ActiveConnection, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]handlers.ActiveConnection{}, f.active...), f.err
+}
+
+// DeactivateConnection records the deactivation and forgets the active connection.
+func (f *FakeNetwork) DeactivateConnection(active string) error {
+	if err := f.record("DeactivateConnection", active); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.active = slices.DeleteFunc(f.active, func(a handlers.ActiveConnection) bool { return a.Path == active })
+	return nil
+}
+
+// AddWifiConnection adds a profile for the network and records the activation.
+func (f *FakeNetwork) AddWifiConnection(device, accessPoint string, wifi handlers.WifiNetwork) error {
+	if err := f.record("AddWifiConnection", device, accessPoint, wifi.SSID, wifi.KeyMgmt, wifi.PSK); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connections = append(f.connections, handlers.ConnectionProfile{
+		Path: fmt.Sprintf("/fake/Settings/%d", len(f.connections)),
+		ID:   wifi.SSID,
+		UUID: fmt.Sprintf("fake-uuid-%d", len(f.connections)),
+		Type: "802-11-wireless",
+		SSID: wifi.SSID,
+	})
+	return nil
+}
+
+// DisconnectDevice records the disconnection.
+func (f *FakeNetwork) DisconnectDevice(device string) error {
+	return f.record("DisconnectDevice", device)
+}
+
+// DeleteConnection removes the profile with the given path.
+func (f *FakeNetwork) DeleteConnection(connection string) error {
+	if err := f.record("DeleteConnection", connection); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connections = slices.DeleteFunc(f.connections, func(p handlers.ConnectionProfile) bool { return p.Path == connection })
+	return nil
+}
+
+// Radios returns the radio switches, all enabled until EnableRadio is called.
+func (f *FakeNetwork) Radios() (handlers.NetworkRadios, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.radios, f.err
+}
+
+// EnableRadio records the change and flips the radio switch.
+func (f *FakeNetwork) EnableRadio(radio string, enabled bool) error {
+	if err := f.record("EnableRadio", radio, strconv.FormatBool(enabled)); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch radio {
+	case handlers.RadioNetworking:
+		f.radios.Networking = enabled
+	case handlers.RadioWireless:
+		f.radios.Wireless = enabled
+	case handlers.RadioWwan:
+		f.radios.Wwan = enabled
+	default:
+		return fmt.Errorf("no such radio %s", radio)
+	}
+	return nil
+}
+
+// Calls returns the changes made so far, e.g. "DisconnectDevice /fake/Devices/0".
+func (f *FakeNetwork) Calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// record logs a call and returns the error passed to Set.
+func (f *FakeNetwork) record(method string, args ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, strings.Join(append([]string{method}, args...), " "))
+	return f.err
+}
+
+// Subscribe calls changed after every Set until ctx is cancelled.
+func (f *FakeNetwork) Subscribe(ctx context.Context, changed func()) error {
+	return subscribe(ctx, f.changes, changed)
+}
@@ -0,0 +1,126 @@
+package handlerstest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/giftpilz0/sysutil/handlers"
+)
+
+// FakePower is an in-memory handlers.PowerBackend.
+type FakePower struct {
+	mu       sync.Mutex
+	battery  handlers.Battery
+	history  []handlers.PowerDeviceHistory
+	profiles handlers.PowerProfiles
+	err      error
+	changes  chan struct{}
+}
+
+// NewFakePower creates a power backend reporting battery.
+func NewFakePower(battery handlers.Battery) *FakePower {
+	return &FakePower{battery: battery, changes: make(chan struct{}, 1)}
+}
+
+// Set changes the reported battery and error, and notifies the subscriber.
+func (f *FakePower) Set(battery handlers.Battery, err error) {
+	f.mu.Lock()
+	f.battery, f.err = battery, err
+	f.mu.Unlock()
+	notify(f.changes)
+}
+
+// Battery returns the battery passed to NewFakePower or Set.
+func (f *FakePower) Battery() (handlers.Battery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	battery := f.battery
+	battery.Devices = append([]handlers.PowerDevice(nil), battery.Devices...)
+	return battery, f.err
+}
+
+// SetHistory changes the UPower history returned by History.
+func (f *FakePower) SetHistory(history []handlers.PowerDeviceHistory) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.history = history
+}
+
+// History returns the history passed to SetHistory, whatever the timespan.
+func (f *FakePower) History(timespan time.Duration, resolution uint32) ([]handlers.PowerDeviceHistory, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]handlers.PowerDeviceHistory{}, f.history...), f.err
+}
+
+// SetProfiles changes the power profiles returned by PowerProfiles.
+func (f *FakePower) SetProfiles(profiles handlers.PowerProfiles) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.profiles = profiles
+}
+
+// PowerProfiles returns the profiles passed to SetProfiles.
+func (f *FakePower) PowerProfiles() (handlers.PowerProfiles, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	profiles := f.profiles
+	profiles.Profiles = append([]handlers.PowerProfile{}, profiles.Profiles...)
+	return profiles, f.err
+}
+
+// SetPowerProfile changes the active profile.
+func (f *FakePower) SetPowerProfile(profile string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.profiles.Active = profile
+	return nil
+}
+
+// SetChargeThreshold enables or disables the charge thresholds of the device
+// with the given path.
+func (f *FakePower) SetChargeThreshold(device string, enabled bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	for i := range f.battery.Devices {
+		if f.battery.Devices[i].Path == device {
+			f.battery.Devices[i].ChargeThresholdEnabled = enabled
+			notify(f.changes)
+			return nil
+		}
+	}
+	return fmt.Errorf("no such device %s", device)
+}
+
+// Subscribe calls changed after every Set until ctx is cancelled.
+func (f *FakePower) Subscribe(ctx context.Context, changed func()) error {
+	return subscribe(ctx, f.changes, changed)
+}
+
+// notify signals a change without blocking, coalescing pending ones.
+func notify(changes chan struct{}) {
+	select {
+	case changes <- struct{}{}:
+	default:
+	}
+}
+
+// subscribe calls changed for every change until ctx is cancelled.
+func subscribe(ctx context.Context, changes <-chan struct{}, changed func()) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes:
+			changed()
+		}
+	}
+}
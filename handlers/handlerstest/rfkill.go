@@ -0,0 +1,48 @@
+package handlerstest
+
+import (
+	"sync"
+
+	"github.com/giftpilz0/sysutil/handlers"
+)
+
+// FakeRfkill is an in-memory handlers.RfkillBackend.
+type FakeRfkill struct {
+	mu      sync.Mutex
+	devices []handlers.RfkillDevice
+	err     error
+}
+
+// NewFakeRfkill creates an rfkill backend reporting devices.
+func NewFakeRfkill(devices ...handlers.RfkillDevice) *FakeRfkill {
+	return &FakeRfkill{devices: devices}
+}
+
+// SetError makes every call fail with err, or succeed again when err is nil.
+func (f *FakeRfkill) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// Devices returns the devices passed to NewFakeRfkill, as blocked since.
+func (f *FakeRfkill) Devices() ([]handlers.RfkillDevice, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]handlers.RfkillDevice{}, f.devices...), f.err
+}
+
+// SetBlocked soft blocks or unblocks the devices of a type, or all devices.
+func (f *FakeRfkill) SetBlocked(rfkillType string, blocked bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	for i := range f.devices {
+		if rfkillType == "" || f.devices[i].Type == rfkillType {
+			f.devices[i].Soft = blocked
+		}
+	}
+	return nil
+}
@@ -2,18 +2,23 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-// networkHandler handles GET requests and returns network devices info.
-func NetworkHandler(w http.ResponseWriter, r *http.Request) {
+// networkHandler handles GET requests and returns network devices info. The response
+// stays a plain list of devices; the overall connectivity is served by NetworkStatusHandler.
+func (s *Server) NetworkHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	devices, err := GetNetworkDevices()
+	devices, err := s.GetNetworkDevices()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -23,14 +28,262 @@ func NetworkHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(devices)
 }
 
+// NetworkStatusHandler handles GET requests and returns the overall network state.
+func (s *Server) NetworkStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	status, err := s.GetNetworkStatus()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// RadioHandler handles GET requests and returns the radio switches.
+func (s *Server) RadioHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state, err := s.GetRadioState()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// EnableRadioHandler handles POST requests with a RadioRequest enabling or disabling radios.
+func (s *Server) EnableRadioHandler(w http.ResponseWriter, r *http.Request) {
+	var request RadioRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	writeStatus(w, s.SetRadios(request))
+}
+
+// AirplaneModeHandler handles POST requests with an AirplaneModeRequest.
+func (s *Server) AirplaneModeHandler(w http.ResponseWriter, r *http.Request) {
+	var request AirplaneModeRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	writeStatus(w, s.SetAirplaneMode(request.Enabled))
+}
+
+// BluetoothHandler handles GET requests and returns the Bluetooth adapters and devices.
+func (s *Server) BluetoothHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state, err := s.GetBluetooth()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// BluetoothPowerHandler handles POST requests with a BluetoothPowerRequest.
+func (s *Server) BluetoothPowerHandler(w http.ResponseWriter, r *http.Request) {
+	var request BluetoothPowerRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	writeStatus(w, s.SetBluetoothPowered(request))
+}
+
+// BluetoothDiscoveryHandler handles POST requests with a BluetoothDiscoveryRequest.
+func (s *Server) BluetoothDiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	var request BluetoothDiscoveryRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	writeStatus(w, s.SetBluetoothDiscovery(request))
+}
+
+// BluetoothConnectHandler handles POST requests with a BluetoothDeviceRequest connecting a device.
+func (s *Server) BluetoothConnectHandler(w http.ResponseWriter, r *http.Request) {
+	var request BluetoothDeviceRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	writeStatus(w, s.ConnectBluetoothDevice(request.Device))
+}
+
+// BluetoothDisconnectHandler handles POST requests with a BluetoothDeviceRequest disconnecting a device.
+func (s *Server) BluetoothDisconnectHandler(w http.ResponseWriter, r *http.Request) {
+	var request BluetoothDeviceRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	writeStatus(w, s.DisconnectBluetoothDevice(request.Device))
+}
+
+// BluetoothPairHandler handles POST requests with a BluetoothDeviceRequest pairing a device.
+func (s *Server) BluetoothPairHandler(w http.ResponseWriter, r *http.Request) {
+	var request BluetoothDeviceRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	writeStatus(w, s.PairBluetoothDevice(request.Device))
+}
+
+// BluetoothRemoveHandler handles POST requests with a BluetoothDeviceRequest removing a device.
+func (s *Server) BluetoothRemoveHandler(w http.ResponseWriter, r *http.Request) {
+	var request BluetoothDeviceRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	writeStatus(w, s.RemoveBluetoothDevice(request.Device))
+}
+
+// VPNHandler handles GET requests and returns the VPN and WireGuard connections.
+func (s *Server) VPNHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	connections, err := s.GetVPNConnections()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(connections)
+}
+
+// VPNUpHandler handles POST requests with a VPNRequest activating a VPN connection.
+func (s *Server) VPNUpHandler(w http.ResponseWriter, r *http.Request) {
+	var request VPNRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	writeStatus(w, s.VPNUp(request.Connection))
+}
+
+// VPNDownHandler handles POST requests with a VPNRequest deactivating a VPN connection.
+func (s *Server) VPNDownHandler(w http.ResponseWriter, r *http.Request) {
+	var request VPNRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	writeStatus(w, s.VPNDown(request.Connection))
+}
+
+// WifiScanHandler handles GET requests and returns the visible access points,
+// scanning for Wi-Fi networks first with ?rescan=true. Scanning takes up to
+// 10 seconds, so only write clients may ask for it.
+func (s *Server) WifiScanHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rescan := false
+	if param := r.URL.Query().Get("rescan"); param != "" {
+		value, err := strconv.ParseBool(param)
+		if err != nil {
+			http.Error(w, "invalid rescan parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		rescan = value
+	}
+	if rescan && ScopeFromContext(r.Context()) < ScopeWrite {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	accessPoints, err := s.ScanWifi(rescan)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(accessPoints)
+}
+
+// ConnectionsHandler handles GET requests and returns the saved connection profiles.
+func (s *Server) ConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	profiles, err := s.GetConnections()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profiles)
+}
+
+// ActivateConnectionHandler handles POST requests with an ActivateConnectionRequest
+// activating a saved connection profile.
+func (s *Server) ActivateConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	var request ActivateConnectionRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	writeStatus(w, s.ActivateConnection(request.Connection, request.Device))
+}
+
+// DeleteConnectionHandler handles POST requests with a DeleteConnectionRequest
+// deleting a saved connection profile.
+func (s *Server) DeleteConnectionHandler(w http.ResponseWriter, r *http.Request) {
+	var request DeleteConnectionRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	writeStatus(w, s.DeleteConnection(request.Connection))
+}
+
+// WifiConnectHandler handles POST requests with a WifiConnectRequest adding and
+// activating a connection to a Wi-Fi network.
+func (s *Server) WifiConnectHandler(w http.ResponseWriter, r *http.Request) {
+	var request WifiConnectRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	writeStatus(w, s.ConnectWifi(request))
+}
+
+// DisconnectDeviceHandler handles POST requests with a DisconnectDeviceRequest
+// disconnecting a network device.
+func (s *Server) DisconnectDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	var request DisconnectDeviceRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	writeStatus(w, s.DisconnectDevice(request.Device))
+}
+
 // batteryHandler handles GET requests and returns battery status.
-func BatteryHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) BatteryHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	battery, err := GetBatteryStatus()
+	battery, err := s.GetBatteryStatus()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -40,14 +293,127 @@ func BatteryHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(battery)
 }
 
+// BatteryHistoryHandler handles GET requests and returns the battery history since
+// ?since=, a time or a duration before now, averaged over ?step= if set.
+func (s *Server) BatteryHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	since, err := parseHistorySince(r.URL.Query().Get("since"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var step time.Duration
+	if param := r.URL.Query().Get("step"); param != "" {
+		step, err = time.ParseDuration(param)
+		if err != nil || step <= 0 {
+			http.Error(w, "invalid step parameter, expected a duration like 5m", http.StatusBadRequest)
+			return
+		}
+	}
+
+	history := s.GetBatteryHistory(since, step)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// PowerProfilesHandler handles GET requests and returns the power profiles.
+func (s *Server) PowerProfilesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	profiles, err := s.GetPowerProfiles()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profiles)
+}
+
+// PowerProfileHandler handles POST requests with a PowerProfileRequest selecting
+// the active power profile.
+func (s *Server) PowerProfileHandler(w http.ResponseWriter, r *http.Request) {
+	var request PowerProfileRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	writeStatus(w, s.SetPowerProfile(request.Profile))
+}
+
+// ChargeThresholdHandler handles POST requests with a ChargeThresholdRequest
+// enabling or disabling the charge thresholds of a battery.
+func (s *Server) ChargeThresholdHandler(w http.ResponseWriter, r *http.Request) {
+	var request ChargeThresholdRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+	writeStatus(w, s.SetChargeThreshold(request.Device, request.Enabled))
+}
+
+// decodeRequest decodes the JSON body of a POST request, answering with an error
+// and returning false if the method or the body is invalid.
+func decodeRequest(w http.ResponseWriter, r *http.Request, request any) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	defer r.Body.Close()
+	if !requireJSON(w, r) {
+		return false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// requireJSON rejects request bodies not sent as application/json. Browsers only
+// send those cross-site after a CORS preflight, so a web page cannot forge a
+// change request to a server granting anonymous clients write access.
+func requireJSON(w http.ResponseWriter, r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return false
+	}
+	return true
+}
+
+// writeStatus answers a change request with a StatusResponse, or with the error
+// that prevented the change: 400 for invalid requests and 500 otherwise.
+func writeStatus(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidPowerRequest), errors.Is(err, ErrInvalidNetworkRequest),
+		errors.Is(err, ErrInvalidBluetoothRequest):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StatusResponse{Status: ActionsStatusSuccess})
+}
+
 // audioOutputsHandler handles GET requests and returns audio output devices info (sinks).
-func AudioOutputsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) AudioOutputsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	outputs, err := GetVolumeInfo()
+	outputs, err := s.GetVolumeInfo()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -58,13 +424,13 @@ func AudioOutputsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // audioInputsHandler handles GET requests and returns audio input devices info (sources).
-func AudioInputsHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) AudioInputsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	inputs, err := GetInputInfo()
+	inputs, err := s.GetInputInfo()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -75,13 +441,87 @@ func AudioInputsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // audioActionsHandler handles POST requests with JSON instructions for audio volume/mute actions.
-func AudioActionsHandler(w http.ResponseWriter, r *http.Request) {
+// The optional "atomic" query parameter rolls back the whole batch when one action fails.
+func (s *Server) AudioActionsHandler(w http.ResponseWriter, r *http.Request) {
+	serveActions(w, r, s.ProcessAudioActions)
+}
+
+// AudioStreamsHandler handles GET requests and returns the application streams,
+// optionally filtered by the "type" query parameter.
+func (s *Server) AudioStreamsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	kind := r.URL.Query().Get("type")
+	if kind != "" && kind != StreamSinkInput && kind != StreamSourceOutput {
+		http.Error(w, "invalid type parameter: "+kind, http.StatusBadRequest)
+		return
+	}
+
+	streams, err := s.GetAudioStreams(kind)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(streams)
+}
+
+// AudioStreamActionsHandler handles POST requests with JSON instructions for
+// application stream volume/mute/move actions, with the same "atomic" parameter
+// as AudioActionsHandler.
+func (s *Server) AudioStreamActionsHandler(w http.ResponseWriter, r *http.Request) {
+	serveActions(w, r, s.ProcessStreamActions)
+}
+
+// AudioCardsHandler handles GET requests and returns the sound cards with their profiles and ports.
+func (s *Server) AudioCardsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cards, err := s.GetAudioCards()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cards)
+}
+
+// AudioCardActionsHandler handles POST requests with JSON instructions switching card
+// profiles, with the same "atomic" parameter as AudioActionsHandler.
+func (s *Server) AudioCardActionsHandler(w http.ResponseWriter, r *http.Request) {
+	serveActions(w, r, s.ProcessCardActions)
+}
+
+// serveActions reads a batch of actions from a POST request, processes it and
+// reports the outcome of each action.
+func serveActions(w http.ResponseWriter, r *http.Request, process func([]byte, bool) ([]ActionResult, error)) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	atomic := false
+	if param := r.URL.Query().Get("atomic"); param != "" {
+		value, err := strconv.ParseBool(param)
+		if err != nil {
+			http.Error(w, "invalid atomic parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		atomic = value
+	}
+
 	// Read the JSON body.
+	if !requireJSON(w, r) {
+		return
+	}
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -89,13 +529,24 @@ func AudioActionsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	// Process the audio actions.
-	if err := ProcessAudioActions(body); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Respond with a success message.
+	response, code := actionsResponse(process, body, atomic)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(response)
+}
+
+// actionsResponse processes a batch of actions and builds the response shared by
+// the HTTP and WebSocket endpoints, together with its HTTP status code.
+func actionsResponse(process func([]byte, bool) ([]ActionResult, error), actionsJSON []byte, atomic bool) (ActionsResponse, int) {
+	results, err := process(actionsJSON, atomic)
+	status, code := ActionsStatus(results, err)
+
+	response := ActionsResponse{Status: status, Results: results}
+	if response.Results == nil {
+		response.Results = []ActionResult{}
+	}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	return response, code
 }
@@ -1,6 +1,12 @@
 package handlers
 
-import "github.com/godbus/dbus/v5"
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
 
 // getProperty is a helper function to retrieve a DBus property for a given interface and property name.
 func GetProperty(obj dbus.BusObject, iface, prop string) (dbus.Variant, error) {
@@ -14,3 +20,98 @@ func GetProperty(obj dbus.BusObject, iface, prop string) (dbus.Variant, error) {
 	}
 	return v, nil
 }
+
+// busConn returns conn, or the shared system bus connection when conn is nil.
+func busConn(conn *dbus.Conn) (*dbus.Conn, error) {
+	if conn != nil {
+		return conn, nil
+	}
+	return dbus.SystemBus()
+}
+
+// watchSignals calls changed for every signal sent by service from an object under
+// path, until ctx is cancelled or the connection is closed. A nil conn is replaced
+// by a private system bus connection, so that the shared one is not flooded.
+func watchSignals(ctx context.Context, conn *dbus.Conn, service, path string, changed func()) error {
+	if conn == nil {
+		private, err := dbus.ConnectSystemBus()
+		if err != nil {
+			return fmt.Errorf("failed to connect to system DBus: %w", err)
+		}
+		defer private.Close()
+		conn = private
+	}
+
+	options := []dbus.MatchOption{dbus.WithMatchSender(service), dbus.WithMatchPathNamespace(dbus.ObjectPath(path))}
+	if err := conn.AddMatchSignal(options...); err != nil {
+		return fmt.Errorf("failed to subscribe to %s signals: %w", service, err)
+	}
+	defer conn.RemoveMatchSignal(options...)
+
+	signals := make(chan *dbus.Signal, 64)
+	conn.Signal(signals)
+	defer conn.RemoveSignal(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case signal, ok := <-signals:
+			if !ok {
+				return fmt.Errorf("DBus connection closed")
+			}
+			if strings.HasPrefix(string(signal.Path), path) {
+				changed()
+			}
+		}
+	}
+}
+
+// GetAllProperties retrieves every DBus property of an interface.
+func GetAllProperties(obj dbus.BusObject, iface string) (map[string]dbus.Variant, error) {
+	var props map[string]dbus.Variant
+	if err := obj.Call("org.freedesktop.DBus.Properties.GetAll", 0, iface).Store(&props); err != nil {
+		return nil, err
+	}
+	return props, nil
+}
+
+// stringProperty returns a string property, or "" if it is missing or has another type.
+func stringProperty(props map[string]dbus.Variant, name string) string {
+	value, _ := props[name].Value().(string)
+	return value
+}
+
+// boolProperty returns a boolean property, or false if it is missing or has another type.
+func boolProperty(props map[string]dbus.Variant, name string) bool {
+	value, _ := props[name].Value().(bool)
+	return value
+}
+
+// floatProperty returns a floating point property, or 0 if it is missing or has another type.
+func floatProperty(props map[string]dbus.Variant, name string) float64 {
+	value, _ := props[name].Value().(float64)
+	return value
+}
+
+// intProperty returns an integer property of any width, or 0 if it is missing
+// or not an integer.
+func intProperty(props map[string]dbus.Variant, name string) int64 {
+	switch value := props[name].Value().(type) {
+	case uint8:
+		return int64(value)
+	case int16:
+		return int64(value)
+	case uint16:
+		return int64(value)
+	case int32:
+		return int64(value)
+	case uint32:
+		return int64(value)
+	case int64:
+		return value
+	case uint64:
+		return int64(value)
+	}
+	return 0
+}
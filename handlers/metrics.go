@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	metricsNamespace   = "deviceapi"
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// batteryStates lists every state reported by BatteryStateToString, used for the
+// battery state metric so that each state is always present with 0 or 1.
+var batteryStates = []string{"Unknown", "Charging", "Discharging", "Empty", "Fully charged", "Pending", "Not charging"}
+
+// metricsWriter renders metrics in the Prometheus text exposition format.
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+// family writes the HELP and TYPE lines of a metric family.
+func (m *metricsWriter) family(name, help, metricType string) {
+	m.buf.WriteString("# HELP " + metricsNamespace + "_" + name + " " + help + "\n")
+	m.buf.WriteString("# TYPE " + metricsNamespace + "_" + name + " " + metricType + "\n")
+}
+
+// sample writes a single sample; labels are given as alternating names and values.
+func (m *metricsWriter) sample(name string, value float64, labels ...string) {
+	m.buf.WriteString(metricsNamespace + "_" + name)
+	if len(labels) > 0 {
+		m.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.buf.WriteByte(',')
+			}
+			m.buf.WriteString(labels[i] + `="` + escapeLabelValue(labels[i+1]) + `"`)
+		}
+		m.buf.WriteByte('}')
+	}
+	m.buf.WriteString(" " + strconv.FormatFloat(value, 'g', -1, 64) + "\n")
+}
+
+// escapeLabelValue escapes backslashes, quotes and newlines in a label value.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// boolValue converts a boolean into a metric value.
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writeBatteryMetrics writes battery charge and state metrics.
+func (s *Server) writeBatteryMetrics(m *metricsWriter) bool {
+	battery, err := s.GetBatteryStatus()
+	if err != nil {
+		return false
+	}
+	if battery.State != "" {
+		m.family("battery_percentage", "Battery charge in percent.", "gauge")
+		m.sample("battery_percentage", battery.Percentage)
+
+		m.family("battery_state", "Battery state, 1 for the current state and 0 for all others.", "gauge")
+		for _, state := range batteryStates {
+			m.sample("battery_state", boolValue(battery.State == state), "state", state)
+		}
+
+		m.family("battery_time_to_empty_seconds", "Estimated time until the battery is empty, 0 when not discharging.", "gauge")
+		m.sample("battery_time_to_empty_seconds", float64(battery.Display.TimeToEmpty))
+		m.family("battery_time_to_full_seconds", "Estimated time until the battery is full, 0 when not charging.", "gauge")
+		m.sample("battery_time_to_full_seconds", float64(battery.Display.TimeToFull))
+		m.family("battery_energy_rate_watts", "Power drawn from or charged into the battery.", "gauge")
+		m.sample("battery_energy_rate_watts", battery.Display.EnergyRate)
+	}
+
+	// Line power has no charge.
+	var batteries []PowerDevice
+	for _, device := range battery.Devices {
+		if device.Type != "line-power" && device.Present {
+			batteries = append(batteries, device)
+		}
+	}
+	if len(batteries) == 0 {
+		return true
+	}
+
+	m.family("power_device_percentage", "Charge in percent of each battery, including peripherals.", "gauge")
+	for _, device := range batteries {
+		m.sample("power_device_percentage", device.Percentage, "type", device.Type, "model", device.Model, "native_path", device.NativePath)
+	}
+
+	m.family("power_device_capacity_percent", "Battery health, the full energy in percent of the design energy.", "gauge")
+	for _, device := range batteries {
+		if device.Capacity > 0 {
+			m.sample("power_device_capacity_percent", device.Capacity, "type", device.Type, "model", device.Model, "native_path", device.NativePath)
+		}
+	}
+
+	m.family("power_device_charge_cycles", "Charge cycles of each battery reporting them.", "gauge")
+	for _, device := range batteries {
+		if device.ChargeCycles > 0 {
+			m.sample("power_device_charge_cycles", float64(device.ChargeCycles), "type", device.Type, "model", device.Model, "native_path", device.NativePath)
+		}
+	}
+	return true
+}
+
+// writeAudioMetrics writes volume, mute and default metrics for all sinks and sources.
+func (s *Server) writeAudioMetrics(m *metricsWriter) bool {
+	sinks, sinkErr := s.GetVolumeInfo()
+	sources, sourceErr := s.GetInputInfo()
+	if sinkErr != nil && sourceErr != nil {
+		return false
+	}
+
+	type device struct {
+		kind string
+		info AudioInfo
+	}
+	var devices []device
+	for _, info := range sinks {
+		devices = append(devices, device{"sink", info})
+	}
+	for _, info := range sources {
+		devices = append(devices, device{"source", info})
+	}
+
+	m.family("audio_volume_percent", "Aggregated volume of an audio device in percent.", "gauge")
+	for _, d := range devices {
+		m.sample("audio_volume_percent", float64(d.info.Volume), "type", d.kind, "device", d.info.Name, "description", d.info.Description)
+	}
+
+	m.family("audio_muted", "Whether an audio device is muted.", "gauge")
+	for _, d := range devices {
+		m.sample("audio_muted", boolValue(d.info.Mute), "type", d.kind, "device", d.info.Name)
+	}
+
+	m.family("audio_default", "Whether an audio device is the default sink or source.", "gauge")
+	for _, d := range devices {
+		m.sample("audio_default", boolValue(d.info.Default), "type", d.kind, "device", d.info.Name)
+	}
+
+	return sinkErr == nil && sourceErr == nil
+}
+
+// writeNetworkMetrics writes link state and Wi-Fi strength metrics per interface.
+func (s *Server) writeNetworkMetrics(m *metricsWriter) bool {
+	devices, err := s.GetNetworkDevices()
+	if err != nil {
+		return false
+	}
+
+	m.family("network_link_up", "Whether NetworkManager has activated a connection on a network interface.", "gauge")
+	for _, dev := range devices {
+		m.sample("network_link_up", boolValue(dev.State == "activated"), "interface", dev.Interface, "device_type", dev.Type)
+	}
+
+	m.family("network_wifi_strength_percent", "Signal strength of the active Wi-Fi access point in percent.", "gauge")
+	for _, dev := range devices {
+		if dev.DeviceType == deviceTypeWifi && dev.WifiSSID != "" {
+			m.sample("network_wifi_strength_percent", float64(dev.WifiStrength), "interface", dev.Interface, "ssid", dev.WifiSSID)
+		}
+	}
+
+	return true
+}
+
+// MetricsHandler handles GET requests and returns device metrics in Prometheus text format.
+func (s *Server) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var m metricsWriter
+	collectors := []struct {
+		name    string
+		collect func(*metricsWriter) bool
+	}{
+		{"battery", s.writeBatteryMetrics},
+		{"audio", s.writeAudioMetrics},
+		{"network", s.writeNetworkMetrics},
+	}
+
+	success := make([]bool, len(collectors))
+	for i, collector := range collectors {
+		success[i] = collector.collect(&m)
+	}
+
+	m.family("scrape_collector_success", "Whether a collector succeeded.", "gauge")
+	for i, collector := range collectors {
+		m.sample("scrape_collector_success", boolValue(success[i]), "collector", collector.name)
+	}
+
+	w.Header().Set("Content-Type", metricsContentType)
+	w.Write(m.buf.Bytes())
+}
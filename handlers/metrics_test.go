@@ -0,0 +1,84 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/giftpilz0/sysutil/handlers"
+	"github.com/giftpilz0/sysutil/handlers/handlerstest"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	power := handlerstest.NewFakePower(handlers.Battery{
+		Percentage: 81,
+		State:      "Discharging",
+		Display:    &handlers.PowerDevice{TimeToEmpty: 5400, EnergyRate: 7.5},
+		Devices: []handlers.PowerDevice{
+			{NativePath: "AC", Type: "line-power", Present: true},
+			{NativePath: "BAT0", Type: "battery", Model: "5B10W13930", Present: true, Percentage: 81, Capacity: 92.5, ChargeCycles: 212},
+			{NativePath: "hidpp_battery_0", Type: "mouse", Model: "MX Master 3", Present: true, Percentage: 55},
+		},
+	})
+	network := handlerstest.NewFakeNetwork(
+		handlers.NetworkDevice{Interface: "eth0", DeviceType: 1, Type: "ethernet", State: "unavailable"},
+		handlers.NetworkDevice{Interface: "wlan0", DeviceType: 2, Type: "wifi", State: "activated", WifiSSID: "home", WifiStrength: 72},
+	)
+	c := newClient(t, handlers.ScopeRead, handlers.Backends{Audio: useFakeAudio(t), Power: power, Network: network})
+
+	metrics, err := c.Metrics(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# HELP deviceapi_battery_percentage Battery charge in percent.",
+		"# TYPE deviceapi_battery_percentage gauge",
+		"deviceapi_battery_percentage 81",
+		`deviceapi_battery_state{state="Discharging"} 1`,
+		`deviceapi_battery_state{state="Charging"} 0`,
+		"deviceapi_battery_time_to_empty_seconds 5400",
+		"deviceapi_battery_energy_rate_watts 7.5",
+		`deviceapi_power_device_percentage{type="battery",model="5B10W13930",native_path="BAT0"} 81`,
+		`deviceapi_power_device_percentage{type="mouse",model="MX Master 3",native_path="hidpp_battery_0"} 55`,
+		`deviceapi_power_device_capacity_percent{type="battery",model="5B10W13930",native_path="BAT0"} 92.5`,
+		`deviceapi_power_device_charge_cycles{type="battery",model="5B10W13930",native_path="BAT0"} 212`,
+		`deviceapi_audio_volume_percent{type="sink",device="hdmi",description="hdmi"} 100`,
+		`deviceapi_audio_muted{type="source",device="mic"} 0`,
+		`deviceapi_audio_default{type="sink",device="speakers"} 1`,
+		`deviceapi_audio_default{type="sink",device="hdmi"} 0`,
+		`deviceapi_network_link_up{interface="eth0",device_type="ethernet"} 0`,
+		`deviceapi_network_link_up{interface="wlan0",device_type="wifi"} 1`,
+		`deviceapi_network_wifi_strength_percent{interface="wlan0",ssid="home"} 72`,
+		`deviceapi_scrape_collector_success{collector="battery"} 1`,
+		`deviceapi_scrape_collector_success{collector="audio"} 1`,
+		`deviceapi_scrape_collector_success{collector="network"} 1`,
+	} {
+		if !strings.Contains(metrics, want+"\n") {
+			t.Errorf("got metrics without %q:\n%s", want, metrics)
+		}
+	}
+	if strings.Contains(metrics, `native_path="AC"`) {
+		t.Errorf("got metrics for the line power supply:\n%s", metrics)
+	}
+
+	// A failing backend only fails its own collector.
+	power.Set(handlers.Battery{}, errors.New("UPower is not running"))
+	metrics, err = c.Metrics(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(metrics, "deviceapi_battery_percentage") {
+		t.Errorf("got battery metrics from a failing backend:\n%s", metrics)
+	}
+	for _, want := range []string{
+		`deviceapi_scrape_collector_success{collector="battery"} 0`,
+		`deviceapi_scrape_collector_success{collector="audio"} 1`,
+	} {
+		if !strings.Contains(metrics, want+"\n") {
+			t.Errorf("got metrics without %q:\n%s", want, metrics)
+		}
+	}
+}
@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/godbus/dbus/v5"
 )
@@ -11,25 +16,111 @@ const (
 	nmPath            = "/org/freedesktop/NetworkManager"
 	deviceInterface   = "org.freedesktop.NetworkManager.Device"
 	wirelessInterface = "org.freedesktop.NetworkManager.Device.Wireless"
+	wiredInterface    = "org.freedesktop.NetworkManager.Device.Wired"
 	apInterface       = "org.freedesktop.NetworkManager.AccessPoint"
 
-	// NetworkManager uses 2 for Wi-Fi devices.
-	deviceTypeWifi = 2
+	ip4ConfigInterface   = "org.freedesktop.NetworkManager.IP4Config"
+	ip6ConfigInterface   = "org.freedesktop.NetworkManager.IP6Config"
+	dhcp4ConfigInterface = "org.freedesktop.NetworkManager.DHCP4Config"
+	dhcp6ConfigInterface = "org.freedesktop.NetworkManager.DHCP6Config"
+
+	// NetworkManager uses 1 for ethernet and 2 for Wi-Fi devices.
+	deviceTypeEthernet = 1
+	deviceTypeWifi     = 2
 )
 
 // NetworkDevice represents a network device with detailed properties.
 type NetworkDevice struct {
-	DeviceName   string `json:"deviceName"`
-	Interface    string `json:"interface"`
-	IpAddress    string `json:"ipAddress,omitempty"`
-	WifiSSID     string `json:"wifiSSID,omitempty"`
-	DeviceType   uint32 `json:"deviceType"`
-	WifiStrength uint8  `json:"wifiStrength,omitempty"`
+	DeviceName      string    `json:"deviceName"`
+	Interface       string    `json:"interface"`
+	IpAddress       string    `json:"ipAddress,omitempty"` // first IPv4 address
+	WifiSSID        string    `json:"wifiSSID,omitempty"`
+	DeviceType      uint32    `json:"deviceType"`
+	WifiStrength    uint8     `json:"wifiStrength,omitempty"`
+	Type            string    `json:"type"`                      // e.g. "ethernet", "wifi", "bridge", "wireguard" or "loopback"
+	State           string    `json:"state"`                     // e.g. "activated", "disconnected" or "unavailable"
+	StateReason     string    `json:"stateReason"`               // why the device entered State, e.g. "carrier" or "user-requested"
+	IP4Connectivity string    `json:"ip4Connectivity,omitempty"` // "none", "portal", "limited" or "full"; the overall connectivity is in NetworkStatus
+	Connection      string    `json:"connection,omitempty"`      // name of the active connection
+	ConnectionUUID  string    `json:"connectionUuid,omitempty"`
+	HwAddress       string    `json:"hwAddress,omitempty"` // MAC address
+	Mtu             uint32    `json:"mtu,omitempty"`
+	Speed           uint32    `json:"speed,omitempty"` // link speed in Mb/s
+	IPv4            *IPConfig `json:"ipv4,omitempty"`
+	IPv6            *IPConfig `json:"ipv6,omitempty"`
+}
+
+// IPConfig is the IPv4 or IPv6 configuration of a connected device.
+type IPConfig struct {
+	Addresses   []IPAddress `json:"addresses"`
+	Gateway     string      `json:"gateway,omitempty"`
+	Nameservers []string    `json:"nameservers"`
+	Domains     []string    `json:"domains"` // search domains
+	DHCP        *DHCPLease  `json:"dhcp,omitempty"`
+}
+
+// IPAddress is an address of a device with the prefix length of its network.
+type IPAddress struct {
+	Address string `json:"address"`
+	Prefix  uint32 `json:"prefix"`
+}
+
+// DHCPLease is the lease a device obtained from a DHCP server.
+type DHCPLease struct {
+	Server    string            `json:"server,omitempty"`
+	LeaseTime uint32            `json:"leaseTime,omitempty"` // seconds
+	Expiry    *time.Time        `json:"expiry,omitempty"`
+	Options   map[string]string `json:"options"` // every option received, e.g. "domain_name_servers"
+}
+
+// NetworkBackend reads and changes the network devices and connection profiles,
+// through NetworkManager by default.
+type NetworkBackend interface {
+	Devices() ([]NetworkDevice, error)
+	// Status returns the overall state and connectivity of the network.
+	Status() (NetworkStatus, error)
+	// ScanWifi lists the access points visible from the wireless devices, after
+	// asking them to scan when rescan is set.
+	ScanWifi(rescan bool) ([]AccessPoint, error)
+	Connections() ([]ConnectionProfile, error)
+	// ActivateConnection activates a profile on a device, both given by object
+	// path; device is "/" to let the backend choose.
+	ActivateConnection(connection, device string) error
+	// AddWifiConnection saves a profile for a Wi-Fi network and activates it on a
+	// device, on the access point with the given path unless it is "/".
+	AddWifiConnection(device, accessPoint string, wifi WifiNetwork) error
+	DisconnectDevice(device string) error
+	DeleteConnection(connection string) error
+	ActiveConnections() ([]ActiveConnection, error)
+	// DeactivateConnection deactivates an active connection given by object path.
+	DeactivateConnection(active string) error
+	Radios() (NetworkRadios, error)
+	// EnableRadio enables or disables RadioNetworking, RadioWireless or RadioWwan.
+	EnableRadio(radio string, enabled bool) error
+	// Subscribe calls changed whenever the network state may have changed, until
+	// ctx is cancelled or the connection fails.
+	Subscribe(ctx context.Context, changed func()) error
+}
+
+// networkManagerBackend queries NetworkManager over DBus.
+type networkManagerBackend struct {
+	conn *dbus.Conn
+}
+
+// NewNetworkManagerBackend creates a network backend talking to NetworkManager on
+// conn, or on the shared system bus connection when conn is nil.
+func NewNetworkManagerBackend(conn *dbus.Conn) NetworkBackend {
+	return networkManagerBackend{conn: conn}
+}
+
+// GetNetworkDevices retrieves the network devices from the network backend.
+func (s *Server) GetNetworkDevices() ([]NetworkDevice, error) {
+	return s.Network.Devices()
 }
 
-// GetNetworkDevices connects to DBus and retrieves detailed network information using NetworkManager.
-func GetNetworkDevices() ([]NetworkDevice, error) {
-	conn, err := dbus.SystemBus()
+// Devices connects to DBus and retrieves detailed network information using NetworkManager.
+func (b networkManagerBackend) Devices() ([]NetworkDevice, error) {
+	conn, err := busConn(b.conn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to system DBus: %w", err)
 	}
@@ -45,79 +136,151 @@ func GetNetworkDevices() ([]NetworkDevice, error) {
 	var devices []NetworkDevice
 	for _, path := range devicePaths {
 		devObj := conn.Object(nmService, path)
-		deviceName := string(path)
+		// Devices vanish while they are enumerated.
+		props, err := GetAllProperties(devObj, deviceInterface)
+		if err != nil {
+			continue
+		}
 
-		// Retrieve the interface name.
-		ifaceStr := ""
-		if ifaceVar, err := GetProperty(devObj, deviceInterface, "Interface"); err == nil {
-			if str, ok := ifaceVar.Value().(string); ok {
-				ifaceStr = str
-			}
+		device := NetworkDevice{
+			DeviceName: string(path),
+			Interface:  stringProperty(props, "Interface"),
+			DeviceType: uint32(intProperty(props, "DeviceType")),
+			State:      NetworkDeviceStateToString(uint32(intProperty(props, "State"))),
+			HwAddress:  stringProperty(props, "HwAddress"),
+			Mtu:        uint32(intProperty(props, "Mtu")),
+		}
+		device.Type = NetworkDeviceTypeToString(device.DeviceType)
+		// StateReason holds the state and the reason for entering it.
+		if reason, ok := props["StateReason"].Value().([]any); ok && len(reason) == 2 {
+			code, _ := reason[1].(uint32)
+			device.StateReason = NetworkDeviceStateReasonToString(code)
+		}
+		// Ip4Connectivity is only reported since NetworkManager 1.16.
+		if _, ok := props["Ip4Connectivity"]; ok {
+			device.IP4Connectivity = ConnectivityToString(uint32(intProperty(props, "Ip4Connectivity")))
+		}
+		if active, ok := props["ActiveConnection"].Value().(dbus.ObjectPath); ok {
+			device.Connection, device.ConnectionUUID = activeConnection(conn, active)
+		}
+		device.IPv4 = ipConfig(conn, props, "Ip4Config", ip4ConfigInterface, "Dhcp4Config", dhcp4ConfigInterface)
+		device.IPv6 = ipConfig(conn, props, "Ip6Config", ip6ConfigInterface, "Dhcp6Config", dhcp6ConfigInterface)
+		if device.IPv4 != nil && len(device.IPv4.Addresses) > 0 {
+			device.IpAddress = device.IPv4.Addresses[0].Address
 		}
 
-		// Retrieve the IPv4 address from AddressData instead of Ip4Address.
-		ipStr := ""
-		if ip4ConfigVar, err := GetProperty(devObj, "org.freedesktop.NetworkManager.Device", "Ip4Config"); err == nil {
-			if ip4ConfigPath, ok := ip4ConfigVar.Value().(dbus.ObjectPath); ok && ip4ConfigPath != "/" && string(ip4ConfigPath) != "" {
-				ip4ConfigObj := conn.Object("org.freedesktop.NetworkManager", ip4ConfigPath)
-				// Get the AddressData property from the IP4Config object.
-				addrDataVar, err := GetProperty(ip4ConfigObj, "org.freedesktop.NetworkManager.IP4Config", "AddressData")
-				if err == nil {
-					// The AddressData property is expected to be a slice of dictionaries.
-					if addrData, ok := addrDataVar.Value().([]map[string]dbus.Variant); ok && len(addrData) > 0 {
-						if addrVar, exists := addrData[0]["address"]; exists {
-							if addr, ok := addrVar.Value().(string); ok {
-								ipStr = addr
-							}
-						}
+		switch device.DeviceType {
+		case deviceTypeEthernet:
+			if speed, err := GetProperty(devObj, wiredInterface, "Speed"); err == nil {
+				device.Speed, _ = speed.Value().(uint32)
+			}
+		case deviceTypeWifi:
+			// The bitrate of Wi-Fi devices is in kbit/s.
+			if bitrate, err := GetProperty(devObj, wirelessInterface, "Bitrate"); err == nil {
+				kbits, _ := bitrate.Value().(uint32)
+				device.Speed = kbits / 1000
+			}
+			if apVar, err := GetProperty(devObj, wirelessInterface, "ActiveAccessPoint"); err == nil {
+				if apPath, ok := apVar.Value().(dbus.ObjectPath); ok && apPath != "/" && string(apPath) != "" {
+					if apProps, err := GetAllProperties(conn.Object(nmService, apPath), apInterface); err == nil {
+						ssid, _ := apProps["Ssid"].Value().([]byte)
+						device.WifiSSID = string(ssid)
+						device.WifiStrength = uint8(intProperty(apProps, "Strength"))
 					}
 				}
 			}
 		}
 
-		// Retrieve the device type.
-		var deviceType uint32
-		if typeVar, err := GetProperty(devObj, deviceInterface, "DeviceType"); err == nil {
-			if dt, ok := typeVar.Value().(uint32); ok {
-				deviceType = dt
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
+
+// ipConfig reads the IP configuration a device property points to, with the
+// DHCP lease another one points to, or returns nil when the device has none.
+func ipConfig(conn *dbus.Conn, device map[string]dbus.Variant, configProperty, configInterface, dhcpProperty, dhcpInterface string) *IPConfig {
+	path, _ := device[configProperty].Value().(dbus.ObjectPath)
+	if path == "/" || path == "" {
+		return nil
+	}
+	props, err := GetAllProperties(conn.Object(nmService, path), configInterface)
+	if err != nil {
+		return nil
+	}
+
+	config := &IPConfig{
+		Addresses:   []IPAddress{},
+		Gateway:     stringProperty(props, "Gateway"),
+		Nameservers: []string{},
+		Domains:     []string{},
+	}
+	addressData, _ := props["AddressData"].Value().([]map[string]dbus.Variant)
+	for _, address := range addressData {
+		config.Addresses = append(config.Addresses, IPAddress{
+			Address: stringProperty(address, "address"),
+			Prefix:  uint32(intProperty(address, "prefix")),
+		})
+	}
+
+	// NameserverData replaces the IPv4 Nameservers since NetworkManager 1.14.
+	if data, ok := props["NameserverData"].Value().([]map[string]dbus.Variant); ok {
+		for _, nameserver := range data {
+			config.Nameservers = append(config.Nameservers, stringProperty(nameserver, "address"))
+		}
+	} else {
+		switch nameservers := props["Nameservers"].Value().(type) {
+		case [][]byte:
+			for _, ip := range nameservers {
+				config.Nameservers = append(config.Nameservers, net.IP(ip).String())
+			}
+		case []uint32:
+			for _, ip := range nameservers {
+				// IPv4 addresses are in network byte order.
+				config.Nameservers = append(config.Nameservers, net.IPv4(byte(ip), byte(ip>>8), byte(ip>>16), byte(ip>>24)).String())
 			}
 		}
+	}
 
-		// If this is a Wi-Fi device, retrieve additional wireless properties.
-		wifiSSID := ""
-		wifiStrength := uint8(0)
-		if deviceType == deviceTypeWifi {
-			if apVar, err := GetProperty(devObj, wirelessInterface, "ActiveAccessPoint"); err == nil {
-				if apPath, ok := apVar.Value().(dbus.ObjectPath); ok && apPath != "/" && string(apPath) != "" {
-					apObj := conn.Object(nmService, apPath)
-					// Retrieve the Wi-Fi SSID.
-					if ssidVar, err := GetProperty(apObj, apInterface, "Ssid"); err == nil {
-						if ssidBytes, ok := ssidVar.Value().([]byte); ok {
-							wifiSSID = string(ssidBytes)
-						}
-					}
-					// Retrieve the Wi-Fi signal strength.
-					if strengthVar, err := GetProperty(apObj, apInterface, "Strength"); err == nil {
-						switch v := strengthVar.Value().(type) {
-						case uint8:
-							wifiStrength = v
-						case uint32:
-							wifiStrength = uint8(v)
-						}
-					}
-				}
+	for _, key := range []string{"Domains", "Searches"} {
+		domains, _ := props[key].Value().([]string)
+		for _, domain := range domains {
+			if !slices.Contains(config.Domains, domain) {
+				config.Domains = append(config.Domains, domain)
 			}
 		}
+	}
 
-		devices = append(devices, NetworkDevice{
-			DeviceName:   deviceName,
-			Interface:    ifaceStr,
-			IpAddress:    ipStr,
-			WifiSSID:     wifiSSID,
-			DeviceType:   deviceType,
-			WifiStrength: wifiStrength,
-		})
+	if dhcpPath, _ := device[dhcpProperty].Value().(dbus.ObjectPath); dhcpPath != "/" && dhcpPath != "" {
+		if options, err := GetProperty(conn.Object(nmService, dhcpPath), dhcpInterface, "Options"); err == nil {
+			values, _ := options.Value().(map[string]dbus.Variant)
+			config.DHCP = dhcpLease(values)
+		}
+	}
+	return config
+}
+
+// dhcpLease converts the options of a DHCP configuration, which NetworkManager
+// reports as strings.
+func dhcpLease(values map[string]dbus.Variant) *DHCPLease {
+	lease := &DHCPLease{Options: make(map[string]string, len(values))}
+	for key, value := range values {
+		lease.Options[key] = fmt.Sprint(value.Value())
 	}
 
-	return devices, nil
+	lease.Server = lease.Options["dhcp_server_identifier"]
+	if seconds, err := strconv.ParseUint(lease.Options["dhcp_lease_time"], 10, 32); err == nil {
+		lease.LeaseTime = uint32(seconds)
+	}
+	if expiry, err := strconv.ParseInt(lease.Options["expiry"], 10, 64); err == nil {
+		t := time.Unix(expiry, 0).UTC()
+		lease.Expiry = &t
+	}
+	return lease
+}
+
+// Subscribe listens for signals from NetworkManager, mostly PropertiesChanged on
+// the devices and access points.
+func (b networkManagerBackend) Subscribe(ctx context.Context, changed func()) error {
+	return watchSignals(ctx, b.conn, nmService, nmPath, changed)
 }
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	nmWirelessSecuritySettingName = "802-11-wireless-security"
+
+	// Key management of Wi-Fi connection profiles.
+	wifiKeyMgmtPSK = "wpa-psk"
+	wifiKeyMgmtSAE = "sae"
+	wifiKeyMgmtOWE = "owe"
+)
+
+// ErrInvalidNetworkRequest is returned when a network change names an unknown
+// device, connection or network, or is missing what the network requires.
+var ErrInvalidNetworkRequest = errors.New("invalid network request")
+
+// ConnectionProfile is a connection profile saved in NetworkManager.
+type ConnectionProfile struct {
+	Path string `json:"path"`
+	ID   string `json:"id"`
+	UUID string `json:"uuid"`
+	Type string `json:"type"`           // e.g. "802-11-wireless", "802-3-ethernet", "vpn" or "wireguard"
+	SSID string `json:"ssid,omitempty"` // of Wi-Fi profiles
+
+	// VPNService is the VPN plugin of VPN profiles, e.g. "org.freedesktop.NetworkManager.openvpn".
+	VPNService string `json:"vpnService,omitempty"`
+}
+
+// ActivateConnectionRequest activates a saved connection profile.
+type ActivateConnectionRequest struct {
+	Connection string `json:"connection"`       // UUID or name of the profile
+	Device     string `json:"device,omitempty"` // interface to activate it on, chosen by NetworkManager if empty
+}
+
+// DeleteConnectionRequest deletes a saved connection profile.
+type DeleteConnectionRequest struct {
+	Connection string `json:"connection"` // UUID or name of the profile
+}
+
+// WifiConnectRequest adds a connection profile for a Wi-Fi network and activates it.
+type WifiConnectRequest struct {
+	SSID     string `json:"ssid"`
+	Password string `json:"password,omitempty"` // pre-shared key, empty for open networks
+	Device   string `json:"device,omitempty"`   // wireless interface, the first one if empty
+	Hidden   bool   `json:"hidden,omitempty"`   // the network does not broadcast its SSID
+}
+
+// DisconnectDeviceRequest disconnects a network device.
+type DisconnectDeviceRequest struct {
+	Device string `json:"device"` // interface, e.g. "wlan0"
+}
+
+// WifiNetwork describes the Wi-Fi network of a new connection profile.
+type WifiNetwork struct {
+	SSID    string
+	KeyMgmt string // "wpa-psk", "sae", "owe" or empty for open networks
+	PSK     string
+	Hidden  bool
+}
+
+// GetConnections retrieves the saved connection profiles from the network backend.
+func (s *Server) GetConnections() ([]ConnectionProfile, error) {
+	return s.Network.Connections()
+}
+
+// ActivateConnection activates a saved connection profile, on a device if set.
+func (s *Server) ActivateConnection(connection, device string) error {
+	profile, err := s.findConnection(connection)
+	if err != nil {
+		return err
+	}
+	devicePath := "/"
+	if device != "" {
+		dev, err := s.findNetworkDevice(device)
+		if err != nil {
+			return err
+		}
+		devicePath = dev.DeviceName
+	}
+
+	if err := s.Network.ActivateConnection(profile.Path, devicePath); err != nil {
+		return fmt.Errorf("failed to activate connection %s: %w", connection, err)
+	}
+	return nil
+}
+
+// DeleteConnection deletes a saved connection profile.
+func (s *Server) DeleteConnection(connection string) error {
+	profile, err := s.findConnection(connection)
+	if err != nil {
+		return err
+	}
+	if err := s.Network.DeleteConnection(profile.Path); err != nil {
+		return fmt.Errorf("failed to delete connection %s: %w", connection, err)
+	}
+	return nil
+}
+
+// DisconnectDevice disconnects a network device, which stays disconnected until
+// a connection is activated on it.
+func (s *Server) DisconnectDevice(device string) error {
+	dev, err := s.findNetworkDevice(device)
+	if err != nil {
+		return err
+	}
+	if err := s.Network.DisconnectDevice(dev.DeviceName); err != nil {
+		return fmt.Errorf("failed to disconnect %s: %w", device, err)
+	}
+	return nil
+}
+
+// ConnectWifi adds a connection profile for a Wi-Fi network and activates it.
+// The key management follows the security of the strongest access point of the
+// network; enterprise and WEP networks are not supported.
+func (s *Server) ConnectWifi(request WifiConnectRequest) error {
+	if request.SSID == "" {
+		return fmt.Errorf("%w: missing ssid", ErrInvalidNetworkRequest)
+	}
+
+	devices, err := s.Network.Devices()
+	if err != nil {
+		return err
+	}
+	index := slices.IndexFunc(devices, func(d NetworkDevice) bool {
+		return d.DeviceType == deviceTypeWifi && (request.Device == "" || d.Interface == request.Device)
+	})
+	if index < 0 {
+		if request.Device != "" {
+			return fmt.Errorf("%w: %s is not a wireless device", ErrInvalidNetworkRequest, request.Device)
+		}
+		return fmt.Errorf("%w: no wireless device", ErrInvalidNetworkRequest)
+	}
+	device := devices[index]
+
+	accessPoints, err := s.ScanWifi(false)
+	if err != nil {
+		return err
+	}
+	wifi := WifiNetwork{SSID: request.SSID, Hidden: request.Hidden}
+	accessPoint := "/"
+	index = slices.IndexFunc(accessPoints, func(ap AccessPoint) bool {
+		return ap.Device == device.Interface && ap.SSID == request.SSID
+	})
+	switch {
+	case index >= 0:
+		accessPoint = accessPoints[index].Path
+		if wifi.KeyMgmt, err = wifiKeyMgmt(accessPoints[index].Security); err != nil {
+			return err
+		}
+	case request.Hidden:
+		if request.Password != "" {
+			wifi.KeyMgmt = wifiKeyMgmtPSK
+		}
+	default:
+		return fmt.Errorf("%w: network %q is not in range of %s, set hidden to connect to a hidden network", ErrInvalidNetworkRequest, request.SSID, device.Interface)
+	}
+
+	if wifi.KeyMgmt == wifiKeyMgmtPSK || wifi.KeyMgmt == wifiKeyMgmtSAE {
+		if err := validatePassword(wifi.KeyMgmt, request.Password); err != nil {
+			return err
+		}
+		wifi.PSK = request.Password
+	}
+
+	if err := s.Network.AddWifiConnection(device.DeviceName, accessPoint, wifi); err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", request.SSID, err)
+	}
+	return nil
+}
+
+// wifiKeyMgmt returns the key management of a profile for an access point with
+// a security, preferring WPA2 over WPA3 for networks offering both.
+func wifiKeyMgmt(security []string) (string, error) {
+	switch {
+	case slices.Contains(security, "802.1X"):
+		return "", fmt.Errorf("%w: enterprise networks are not supported", ErrInvalidNetworkRequest)
+	case slices.Contains(security, "WEP"):
+		return "", fmt.Errorf("%w: WEP networks are not supported", ErrInvalidNetworkRequest)
+	case slices.Contains(security, "WPA2") || slices.Contains(security, "WPA"):
+		return wifiKeyMgmtPSK, nil
+	case slices.Contains(security, "WPA3"):
+		return wifiKeyMgmtSAE, nil
+	case slices.Contains(security, "OWE"):
+		return wifiKeyMgmtOWE, nil
+	}
+	return "", nil
+}
+
+// validatePassword checks a pre-shared key: WPA takes 8 to 63 characters or 64
+// hexadecimal digits, WPA3 any non-empty password.
+func validatePassword(keyMgmt, password string) error {
+	if password == "" {
+		return fmt.Errorf("%w: the network requires a password", ErrInvalidNetworkRequest)
+	}
+	if keyMgmt != wifiKeyMgmtPSK || (len(password) >= 8 && len(password) <= 63) || isHexKey(password) {
+		return nil
+	}
+	return fmt.Errorf("%w: the password must have 8 to 63 characters or 64 hexadecimal digits", ErrInvalidNetworkRequest)
+}
+
+// isHexKey reports whether a password is a raw 256-bit key in hexadecimal.
+func isHexKey(password string) bool {
+	if len(password) != 64 {
+		return false
+	}
+	for _, c := range password {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// findConnection returns the saved profile with a UUID or, failing that, a unique name.
+func (s *Server) findConnection(connection string) (ConnectionProfile, error) {
+	profiles, err := s.Network.Connections()
+	if err != nil {
+		return ConnectionProfile{}, err
+	}
+	if index := slices.IndexFunc(profiles, func(p ConnectionProfile) bool { return p.UUID == connection }); index >= 0 {
+		return profiles[index], nil
+	}
+
+	var found []ConnectionProfile
+	for _, profile := range profiles {
+		if profile.ID == connection {
+			found = append(found, profile)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return ConnectionProfile{}, fmt.Errorf("%w: unknown connection %q", ErrInvalidNetworkRequest, connection)
+	case 1:
+		return found[0], nil
+	}
+	return ConnectionProfile{}, fmt.Errorf("%w: %d connections are named %q, use the UUID", ErrInvalidNetworkRequest, len(found), connection)
+}
+
+// findNetworkDevice returns the network device with an interface name.
+func (s *Server) findNetworkDevice(device string) (NetworkDevice, error) {
+	devices, err := s.Network.Devices()
+	if err != nil {
+		return NetworkDevice{}, err
+	}
+	index := slices.IndexFunc(devices, func(d NetworkDevice) bool { return d.Interface == device })
+	if index < 0 {
+		return NetworkDevice{}, fmt.Errorf("%w: unknown network device %q", ErrInvalidNetworkRequest, device)
+	}
+	return devices[index], nil
+}
+
+// Connections lists the connection profiles of NetworkManager via DBus.
+func (b networkManagerBackend) Connections() ([]ConnectionProfile, error) {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to system DBus: %w", err)
+	}
+
+	var paths []dbus.ObjectPath
+	if err := conn.Object(nmService, nmSettingsPath).Call(nmSettingsInterface+".ListConnections", 0).Store(&paths); err != nil {
+		return nil, fmt.Errorf("failed to list connection profiles: %w", err)
+	}
+
+	profiles := []ConnectionProfile{}
+	for _, path := range paths {
+		var settings map[string]map[string]dbus.Variant
+		// Profiles vanish while they are enumerated.
+		if err := conn.Object(nmService, path).Call(nmConnectionInterface+".GetSettings", 0).Store(&settings); err != nil {
+			continue
+		}
+		ssid, _ := settings[nmWirelessSettingName]["ssid"].Value().([]byte)
+		profiles = append(profiles, ConnectionProfile{
+			Path:       string(path),
+			ID:         stringProperty(settings[nmConnectionSettingName], "id"),
+			UUID:       stringProperty(settings[nmConnectionSettingName], "uuid"),
+			Type:       stringProperty(settings[nmConnectionSettingName], "type"),
+			SSID:       string(ssid),
+			VPNService: stringProperty(settings[nmVPNSettingName], "service-type"),
+		})
+	}
+	return profiles, nil
+}
+
+// ActivateConnection calls ActivateConnection on NetworkManager via DBus.
+func (b networkManagerBackend) ActivateConnection(connection, device string) error {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to system DBus: %w", err)
+	}
+	return conn.Object(nmService, nmPath).Call(nmService+".ActivateConnection", 0,
+		dbus.ObjectPath(connection), dbus.ObjectPath(device), dbus.ObjectPath("/")).Err
+}
+
+// AddWifiConnection calls AddAndActivateConnection on NetworkManager via DBus,
+// with the settings of a Wi-Fi network.
+func (b networkManagerBackend) AddWifiConnection(device, accessPoint string, wifi WifiNetwork) error {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to system DBus: %w", err)
+	}
+
+	settings := map[string]map[string]dbus.Variant{
+		nmConnectionSettingName: {
+			"id":   dbus.MakeVariant(wifi.SSID),
+			"type": dbus.MakeVariant(nmWirelessConnectionType),
+		},
+		nmWirelessSettingName: {
+			"ssid":   dbus.MakeVariant([]byte(wifi.SSID)),
+			"mode":   dbus.MakeVariant("infrastructure"),
+			"hidden": dbus.MakeVariant(wifi.Hidden),
+		},
+	}
+	if wifi.KeyMgmt != "" {
+		settings[nmWirelessSecuritySettingName] = map[string]dbus.Variant{"key-mgmt": dbus.MakeVariant(wifi.KeyMgmt)}
+	}
+	if wifi.PSK != "" {
+		settings[nmWirelessSecuritySettingName]["psk"] = dbus.MakeVariant(wifi.PSK)
+	}
+	return conn.Object(nmService, nmPath).Call(nmService+".AddAndActivateConnection", 0,
+		settings, dbus.ObjectPath(device), dbus.ObjectPath(accessPoint)).Err
+}
+
+// DisconnectDevice calls Disconnect on a NetworkManager device via DBus.
+func (b networkManagerBackend) DisconnectDevice(device string) error {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to system DBus: %w", err)
+	}
+	return conn.Object(nmService, dbus.ObjectPath(device)).Call(deviceInterface+".Disconnect", 0).Err
+}
+
+// DeleteConnection calls Delete on a NetworkManager connection profile via DBus.
+func (b networkManagerBackend) DeleteConnection(connection string) error {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to system DBus: %w", err)
+	}
+	return conn.Object(nmService, dbus.ObjectPath(connection)).Call(nmConnectionInterface+".Delete", 0).Err
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Radios of NetworkManager enabled and disabled by EnableRadio.
+const (
+	RadioNetworking = "networking"
+	RadioWireless   = "wireless"
+	RadioWwan       = "wwan"
+)
+
+// rfkillTypeBluetooth is the rfkill type of Bluetooth adapters.
+const rfkillTypeBluetooth = "bluetooth"
+
+// NetworkRadios holds the software and hardware switches of NetworkManager.
+type NetworkRadios struct {
+	Networking       bool `json:"networking"`       // all networking, including wired
+	Wireless         bool `json:"wireless"`         // Wi-Fi
+	WirelessHardware bool `json:"wirelessHardware"` // false when a hardware switch disables Wi-Fi
+	Wwan             bool `json:"wwan"`             // mobile broadband
+	WwanHardware     bool `json:"wwanHardware"`
+}
+
+// RfkillDevice is a radio transmitter that rfkill can block.
+type RfkillDevice struct {
+	Index uint32 `json:"index"`
+	Name  string `json:"name"` // e.g. "phy0" or "hci0"
+	Type  string `json:"type"` // "wlan", "bluetooth", "wwan", "uwb", "wimax", "gps", "fm" or "nfc"
+	Soft  bool   `json:"soft"` // blocked in software
+	Hard  bool   `json:"hard"` // blocked by a hardware switch
+}
+
+// RadioState holds the NetworkManager switches, the rfkill devices and whether
+// airplane mode is on, i.e. every radio is disabled.
+type RadioState struct {
+	NetworkRadios
+	AirplaneMode bool           `json:"airplaneMode"`
+	Rfkill       []RfkillDevice `json:"rfkill"`
+}
+
+// RadioRequest enables or disables radios; unset fields are left unchanged.
+type RadioRequest struct {
+	Networking *bool `json:"networking,omitempty"`
+	Wireless   *bool `json:"wireless,omitempty"`
+	Wwan       *bool `json:"wwan,omitempty"`
+	Bluetooth  *bool `json:"bluetooth,omitempty"` // through rfkill
+}
+
+// AirplaneModeRequest turns airplane mode on or off.
+type AirplaneModeRequest struct {
+	Enabled bool `json:"enabled"`
+}
+
+// RfkillBackend reads and blocks radio transmitters, through /sys/class/rfkill
+// and /dev/rfkill on Linux by default.
+type RfkillBackend interface {
+	Devices() ([]RfkillDevice, error)
+	// SetBlocked soft blocks or unblocks every device of an rfkill type, or
+	// every device when rfkillType is empty.
+	SetBlocked(rfkillType string, blocked bool) error
+}
+
+// GetRadioState retrieves the radio switches from the network and rfkill backends.
+func (s *Server) GetRadioState() (RadioState, error) {
+	radios, err := s.Network.Radios()
+	if err != nil {
+		return RadioState{}, err
+	}
+	devices, err := s.Rfkill.Devices()
+	if err != nil {
+		return RadioState{}, err
+	}
+
+	state := RadioState{NetworkRadios: radios, Rfkill: devices}
+	state.AirplaneMode = !radios.Wireless && !radios.Wwan
+	for _, device := range devices {
+		state.AirplaneMode = state.AirplaneMode && (device.Soft || device.Hard)
+	}
+	return state, nil
+}
+
+// SetRadios enables or disables the radios set in a request.
+func (s *Server) SetRadios(request RadioRequest) error {
+	for _, radio := range []struct {
+		name    string
+		enabled *bool
+	}{
+		{RadioNetworking, request.Networking},
+		{RadioWireless, request.Wireless},
+		{RadioWwan, request.Wwan},
+	} {
+		if radio.enabled == nil {
+			continue
+		}
+		if err := s.Network.EnableRadio(radio.name, *radio.enabled); err != nil {
+			return fmt.Errorf("failed to set %s: %w", radio.name, err)
+		}
+	}
+
+	if request.Bluetooth != nil {
+		if err := s.Rfkill.SetBlocked(rfkillTypeBluetooth, !*request.Bluetooth); err != nil {
+			return fmt.Errorf("failed to set bluetooth: %w", err)
+		}
+	}
+	return nil
+}
+
+// SetAirplaneMode disables Wi-Fi and mobile broadband in NetworkManager and soft
+// blocks every rfkill device, or reverts that. Wired networking is left alone.
+// Every switch is tried even when one fails.
+func (s *Server) SetAirplaneMode(enabled bool) error {
+	var errs []error
+	if err := s.Rfkill.SetBlocked("", enabled); err != nil {
+		errs = append(errs, fmt.Errorf("failed to set rfkill: %w", err))
+	}
+	for _, radio := range []string{RadioWireless, RadioWwan} {
+		if err := s.Network.EnableRadio(radio, !enabled); err != nil {
+			errs = append(errs, fmt.Errorf("failed to set %s: %w", radio, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Radios reads the radio switches of NetworkManager via DBus.
+func (b networkManagerBackend) Radios() (NetworkRadios, error) {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return NetworkRadios{}, fmt.Errorf("failed to connect to system DBus: %w", err)
+	}
+
+	props, err := GetAllProperties(conn.Object(nmService, nmPath), nmService)
+	if err != nil {
+		return NetworkRadios{}, fmt.Errorf("failed to get radio switches: %w", err)
+	}
+	return NetworkRadios{
+		Networking:       boolProperty(props, "NetworkingEnabled"),
+		Wireless:         boolProperty(props, "WirelessEnabled"),
+		WirelessHardware: boolProperty(props, "WirelessHardwareEnabled"),
+		Wwan:             boolProperty(props, "WwanEnabled"),
+		WwanHardware:     boolProperty(props, "WwanHardwareEnabled"),
+	}, nil
+}
+
+// EnableRadio sets WirelessEnabled or WwanEnabled, or calls Enable for networking,
+// on NetworkManager via DBus.
+func (b networkManagerBackend) EnableRadio(radio string, enabled bool) error {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to system DBus: %w", err)
+	}
+
+	nm := conn.Object(nmService, nmPath)
+	switch radio {
+	case RadioNetworking:
+		// NetworkingEnabled is read-only, and Enable fails when nothing changes.
+		current, err := GetProperty(nm, nmService, "NetworkingEnabled")
+		if err == nil && current.Value() == enabled {
+			return nil
+		}
+		return nm.Call(nmService+".Enable", 0, enabled).Err
+	case RadioWireless:
+		return nm.SetProperty(nmService+".WirelessEnabled", dbus.MakeVariant(enabled))
+	case RadioWwan:
+		return nm.SetProperty(nmService+".WwanEnabled", dbus.MakeVariant(enabled))
+	}
+	return fmt.Errorf("%w: unknown radio %q", ErrInvalidNetworkRequest, radio)
+}
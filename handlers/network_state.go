@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const activeConnectionInterface = "org.freedesktop.NetworkManager.Connection.Active"
+
+// networkDeviceTypes are the names of the NetworkManager device types, indexed by type.
+var networkDeviceTypes = []string{
+	"unknown", "ethernet", "wifi", "unused1", "unused2", "bluetooth", "olpc-mesh", "wimax", "modem",
+	"infiniband", "bond", "vlan", "adsl", "bridge", "generic", "team", "tun", "ip-tunnel", "macvlan",
+	"vxlan", "veth", "macsec", "dummy", "ppp", "ovs-interface", "ovs-port", "ovs-bridge", "wpan",
+	"6lowpan", "wireguard", "wifi-p2p", "vrf", "loopback", "hsr", "ipvlan",
+}
+
+// deviceStateReasons are the names of the reasons for device state changes,
+// indexed by reason.
+var deviceStateReasons = []string{
+	"none", "unknown", "now-managed", "now-unmanaged", "config-failed", "ip-config-unavailable",
+	"ip-config-expired", "no-secrets", "supplicant-disconnect", "supplicant-config-failed",
+	"supplicant-failed", "supplicant-timeout", "ppp-start-failed", "ppp-disconnect", "ppp-failed",
+	"dhcp-start-failed", "dhcp-error", "dhcp-failed", "shared-start-failed", "shared-failed",
+	"autoip-start-failed", "autoip-error", "autoip-failed", "modem-busy", "modem-no-dial-tone",
+	"modem-no-carrier", "modem-dial-timeout", "modem-dial-failed", "modem-init-failed",
+	"gsm-apn-failed", "gsm-registration-not-searching", "gsm-registration-denied",
+	"gsm-registration-timeout", "gsm-registration-failed", "gsm-pin-check-failed", "firmware-missing",
+	"removed", "sleeping", "connection-removed", "user-requested", "carrier", "connection-assumed",
+	"supplicant-available", "modem-not-found", "bt-failed", "gsm-sim-not-inserted",
+	"gsm-sim-pin-required", "gsm-sim-puk-required", "gsm-sim-wrong", "infiniband-mode",
+	"dependency-failed", "br2684-failed", "modem-manager-unavailable", "ssid-not-found",
+	"secondary-connection-failed", "dcb-fcoe-failed", "teamd-control-failed", "modem-failed",
+	"modem-available", "sim-pin-incorrect", "new-activation", "parent-changed",
+	"parent-managed-changed", "ovsdb-failed", "ip-address-duplicate", "ip-method-unsupported",
+	"sriov-configuration-failed", "peer-not-found",
+}
+
+// NetworkStatus is the overall state of NetworkManager.
+type NetworkStatus struct {
+	State             string `json:"state"`        // e.g. "connected-global" or "disconnected"
+	Connectivity      string `json:"connectivity"` // "unknown", "none", "portal", "limited" or "full"
+	PrimaryConnection string `json:"primaryConnection,omitempty"`
+}
+
+// NetworkDeviceTypeToString converts a NetworkManager device type into its name.
+func NetworkDeviceTypeToString(deviceType uint32) string {
+	if int(deviceType) < len(networkDeviceTypes) {
+		return networkDeviceTypes[deviceType]
+	}
+	return "unknown"
+}
+
+// NetworkDeviceStateToString converts a NetworkManager device state into its name.
+func NetworkDeviceStateToString(state uint32) string {
+	switch state {
+	case 10:
+		return "unmanaged"
+	case 20:
+		return "unavailable"
+	case 30:
+		return "disconnected"
+	case 40:
+		return "prepare"
+	case 50:
+		return "config"
+	case 60:
+		return "need-auth"
+	case 70:
+		return "ip-config"
+	case 80:
+		return "ip-check"
+	case 90:
+		return "secondaries"
+	case 100:
+		return "activated"
+	case 110:
+		return "deactivating"
+	case 120:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// NetworkDeviceStateReasonToString converts the reason of a device state change into its name.
+func NetworkDeviceStateReasonToString(reason uint32) string {
+	if int(reason) < len(deviceStateReasons) {
+		return deviceStateReasons[reason]
+	}
+	return fmt.Sprintf("unknown (%d)", reason)
+}
+
+// NetworkStateToString converts the overall NetworkManager state into its name.
+func NetworkStateToString(state uint32) string {
+	switch state {
+	case 10:
+		return "asleep"
+	case 20:
+		return "disconnected"
+	case 30:
+		return "disconnecting"
+	case 40:
+		return "connecting"
+	case 50:
+		return "connected-local"
+	case 60:
+		return "connected-site"
+	case 70:
+		return "connected-global"
+	default:
+		return "unknown"
+	}
+}
+
+// ConnectivityToString converts a NetworkManager connectivity state into its name.
+func ConnectivityToString(connectivity uint32) string {
+	switch connectivity {
+	case 1:
+		return "none"
+	case 2:
+		return "portal"
+	case 3:
+		return "limited"
+	case 4:
+		return "full"
+	default:
+		return "unknown"
+	}
+}
+
+// GetNetworkStatus retrieves the overall network state from the network backend.
+func (s *Server) GetNetworkStatus() (NetworkStatus, error) {
+	return s.Network.Status()
+}
+
+// Status reads the state, connectivity and primary connection of NetworkManager via DBus.
+func (b networkManagerBackend) Status() (NetworkStatus, error) {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return NetworkStatus{}, fmt.Errorf("failed to connect to system DBus: %w", err)
+	}
+
+	props, err := GetAllProperties(conn.Object(nmService, nmPath), nmService)
+	if err != nil {
+		return NetworkStatus{}, fmt.Errorf("failed to get network status: %w", err)
+	}
+
+	status := NetworkStatus{
+		State:        NetworkStateToString(uint32(intProperty(props, "State"))),
+		Connectivity: ConnectivityToString(uint32(intProperty(props, "Connectivity"))),
+	}
+	if primary, ok := props["PrimaryConnection"].Value().(dbus.ObjectPath); ok {
+		status.PrimaryConnection, _ = activeConnection(conn, primary)
+	}
+	return status, nil
+}
+
+// activeConnection returns the name and UUID of an active connection, or empty
+// strings for "/".
+func activeConnection(conn *dbus.Conn, path dbus.ObjectPath) (string, string) {
+	if path == "/" || path == "" {
+		return "", ""
+	}
+	props, err := GetAllProperties(conn.Object(nmService, path), activeConnectionInterface)
+	if err != nil {
+		return "", ""
+	}
+	return stringProperty(props, "Id"), stringProperty(props, "Uuid")
+}
@@ -0,0 +1,150 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/giftpilz0/sysutil/client"
+	"github.com/giftpilz0/sysutil/handlers"
+	"github.com/giftpilz0/sysutil/handlers/handlerstest"
+)
+
+// useFakeNetwork creates a network backend with a wired and a wireless device
+// and the access points of three Wi-Fi networks in range of the latter.
+func useFakeNetwork(t *testing.T) *handlerstest.FakeNetwork {
+	t.Helper()
+
+	fake := handlerstest.NewFakeNetwork(
+		handlers.NetworkDevice{DeviceName: "/fake/Devices/0", Interface: "eth0", DeviceType: 1},
+		handlers.NetworkDevice{DeviceName: "/fake/Devices/1", Interface: "wlan0", DeviceType: 2},
+	)
+	fake.SetAccessPoints(
+		handlers.AccessPoint{Device: "wlan0", Path: "/fake/AccessPoint/0", SSID: "cafe", Strength: 40},
+		handlers.AccessPoint{Device: "wlan0", Path: "/fake/AccessPoint/1", SSID: "home", Strength: 80, Security: []string{"WPA2"}},
+		handlers.AccessPoint{Device: "wlan0", Path: "/fake/AccessPoint/2", SSID: "office", Strength: 60, Security: []string{"WPA2", "802.1X"}},
+	)
+	return fake
+}
+
+func TestWifiConnect(t *testing.T) {
+	t.Parallel()
+
+	fake := useFakeNetwork(t)
+	c := newClient(t, handlers.ScopeWrite, handlers.Backends{Network: fake})
+	ctx := context.Background()
+
+	accessPoints, err := c.ScanWifi(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accessPoints) != 3 || accessPoints[0].SSID != "home" || accessPoints[2].SSID != "cafe" {
+		t.Errorf("got access points %+v, want home, office and cafe", accessPoints)
+	}
+
+	if err := c.ConnectWifi(ctx, handlers.WifiConnectRequest{SSID: "home", Password: "correct horse"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ConnectWifi(ctx, handlers.WifiConnectRequest{SSID: "cafe", Device: "wlan0"}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"AddWifiConnection /fake/Devices/1 /fake/AccessPoint/1 home wpa-psk correct horse",
+		"AddWifiConnection /fake/Devices/1 /fake/AccessPoint/0 cafe  ",
+	}
+	if calls := fake.Calls(); !slices.Equal(calls, want) {
+		t.Errorf("got calls %q, want %q", calls, want)
+	}
+
+	for _, request := range []handlers.WifiConnectRequest{
+		{SSID: "home", Password: "short"},
+		{SSID: "office", Password: "correct horse"},
+		{SSID: "elsewhere", Password: "correct horse"},
+		{SSID: "home", Password: "correct horse", Device: "eth0"},
+	} {
+		err := c.ConnectWifi(ctx, request)
+		var apiErr *client.Error
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+			t.Errorf("got error %v connecting to %+v, want 400", err, request)
+		}
+	}
+	if calls := fake.Calls(); len(calls) != len(want) {
+		t.Errorf("got calls %q after invalid requests, want %q", calls, want)
+	}
+
+	profiles, err := c.Connections(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(profiles) != 2 || profiles[0].SSID != "home" || profiles[1].SSID != "cafe" {
+		t.Errorf("got profiles %+v, want home and cafe", profiles)
+	}
+}
+
+func TestWifiScan(t *testing.T) {
+	t.Parallel()
+
+	fake := useFakeNetwork(t)
+	ctx := context.Background()
+
+	// Read clients list the last results but may not make the devices scan.
+	reader := newClient(t, handlers.ScopeRead, handlers.Backends{Network: fake})
+	if accessPoints, err := reader.ScanWifi(ctx, false); err != nil || len(accessPoints) != 3 {
+		t.Fatalf("got access points %+v and error %v, want 3", accessPoints, err)
+	}
+	_, err := reader.ScanWifi(ctx, true)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Errorf("got error %v rescanning as a read client, want 403", err)
+	}
+	if fake.Scans() != 0 {
+		t.Errorf("got %d scans, want none", fake.Scans())
+	}
+
+	writer := newClient(t, handlers.ScopeWrite, handlers.Backends{Network: fake})
+	if _, err := writer.ScanWifi(ctx, true); err != nil {
+		t.Fatal(err)
+	}
+	if fake.Scans() != 1 {
+		t.Errorf("got %d scans, want 1", fake.Scans())
+	}
+}
+
+func TestVPN(t *testing.T) {
+	t.Parallel()
+
+	fake := useFakeNetwork(t)
+	fake.SetConnections(
+		handlers.ConnectionProfile{Path: "/fake/Settings/0", ID: "Wired", UUID: "2d2f7a3c-wired", Type: "802-3-ethernet"},
+		handlers.ConnectionProfile{Path: "/fake/Settings/1", ID: "corp", UUID: "5b7e9f1a-corp", Type: "vpn", VPNService: "org.freedesktop.NetworkManager.openvpn"},
+		handlers.ConnectionProfile{Path: "/fake/Settings/2", ID: "wg0", UUID: "c3d4e5f6-wg0", Type: "wireguard"},
+	)
+	c := newClient(t, handlers.ScopeWrite, handlers.Backends{Network: fake})
+	ctx := context.Background()
+
+	if err := c.VPNUp(ctx, "corp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VPNUp(ctx, "c3d4e5f6-wg0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VPNDown(ctx, "wg0"); err != nil {
+		t.Fatal(err)
+	}
+
+	vpns, err := c.VPN(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vpns) != 2 || !vpns[0].Active || vpns[0].ID != "corp" || vpns[1].Active || vpns[1].State != "deactivated" {
+		t.Errorf("got VPNs %+v, want corp up and wg0 down", vpns)
+	}
+
+	err = c.VPNUp(ctx, "Wired")
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("got error %v bringing up a wired profile, want 400", err)
+	}
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	nmVPNSettingName = "vpn"
+
+	// Connection types of VPN profiles.
+	vpnConnectionType       = "vpn"
+	wireguardConnectionType = "wireguard"
+)
+
+// ActiveConnection is a connection NetworkManager activated.
+type ActiveConnection struct {
+	Path       string   `json:"path"`
+	Connection string   `json:"connection"` // path of the connection profile
+	ID         string   `json:"id"`
+	UUID       string   `json:"uuid"`
+	Type       string   `json:"type"`
+	State      string   `json:"state"`   // "activating", "activated", "deactivating" or "deactivated"
+	Devices    []string `json:"devices"` // paths of the devices it is active on
+}
+
+// VPNConnection is a VPN or WireGuard connection profile and its state.
+type VPNConnection struct {
+	ID         string `json:"id"`
+	UUID       string `json:"uuid"`
+	Type       string `json:"type"`                 // "vpn" or "wireguard"
+	VPNService string `json:"vpnService,omitempty"` // e.g. "org.freedesktop.NetworkManager.openvpn"
+	Active     bool   `json:"active"`
+	State      string `json:"state"` // "activating", "activated", "deactivating" or "deactivated"
+}
+
+// VPNRequest brings a VPN or WireGuard connection up or down.
+type VPNRequest struct {
+	Connection string `json:"connection"` // UUID or name of the profile
+}
+
+// ActiveConnectionStateToString converts the state of an active connection into its name.
+func ActiveConnectionStateToString(state uint32) string {
+	switch state {
+	case 1:
+		return "activating"
+	case 2:
+		return "activated"
+	case 3:
+		return "deactivating"
+	case 4:
+		return "deactivated"
+	default:
+		return "unknown"
+	}
+}
+
+// GetVPNConnections lists the VPN and WireGuard profiles with their state.
+func (s *Server) GetVPNConnections() ([]VPNConnection, error) {
+	profiles, err := s.Network.Connections()
+	if err != nil {
+		return nil, err
+	}
+	active, err := s.Network.ActiveConnections()
+	if err != nil {
+		return nil, err
+	}
+
+	connections := []VPNConnection{}
+	for _, profile := range profiles {
+		if !isVPN(profile) {
+			continue
+		}
+		connection := VPNConnection{
+			ID:         profile.ID,
+			UUID:       profile.UUID,
+			Type:       profile.Type,
+			VPNService: profile.VPNService,
+			State:      "deactivated",
+		}
+		if index := slices.IndexFunc(active, func(a ActiveConnection) bool { return a.Connection == profile.Path }); index >= 0 {
+			connection.State = active[index].State
+			connection.Active = connection.State == "activated"
+		}
+		connections = append(connections, connection)
+	}
+	return connections, nil
+}
+
+// VPNUp activates a VPN or WireGuard connection.
+func (s *Server) VPNUp(connection string) error {
+	profile, err := s.findVPN(connection)
+	if err != nil {
+		return err
+	}
+	if err := s.Network.ActivateConnection(profile.Path, "/"); err != nil {
+		return fmt.Errorf("failed to activate VPN %s: %w", connection, err)
+	}
+	return nil
+}
+
+// VPNDown deactivates a VPN or WireGuard connection. Inactive connections are
+// left alone.
+func (s *Server) VPNDown(connection string) error {
+	profile, err := s.findVPN(connection)
+	if err != nil {
+		return err
+	}
+	active, err := s.Network.ActiveConnections()
+	if err != nil {
+		return err
+	}
+
+	for _, a := range active {
+		if a.Connection != profile.Path {
+			continue
+		}
+		if err := s.Network.DeactivateConnection(a.Path); err != nil {
+			return fmt.Errorf("failed to deactivate VPN %s: %w", connection, err)
+		}
+	}
+	return nil
+}
+
+// findVPN returns the VPN or WireGuard profile with a UUID or name.
+func (s *Server) findVPN(connection string) (ConnectionProfile, error) {
+	profile, err := s.findConnection(connection)
+	if err != nil {
+		return ConnectionProfile{}, err
+	}
+	if !isVPN(profile) {
+		return ConnectionProfile{}, fmt.Errorf("%w: %s is a %s connection, not a VPN", ErrInvalidNetworkRequest, connection, profile.Type)
+	}
+	return profile, nil
+}
+
+// isVPN reports whether a profile is a VPN or WireGuard connection.
+func isVPN(profile ConnectionProfile) bool {
+	return profile.Type == vpnConnectionType || profile.Type == wireguardConnectionType
+}
+
+// ActiveConnections lists the active connections of NetworkManager via DBus.
+func (b networkManagerBackend) ActiveConnections() ([]ActiveConnection, error) {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to system DBus: %w", err)
+	}
+
+	pathsVar, err := GetProperty(conn.Object(nmService, nmPath), nmService, "ActiveConnections")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active connections: %w", err)
+	}
+	paths, _ := pathsVar.Value().([]dbus.ObjectPath)
+
+	connections := []ActiveConnection{}
+	for _, path := range paths {
+		// Connections vanish while they are enumerated.
+		props, err := GetAllProperties(conn.Object(nmService, path), activeConnectionInterface)
+		if err != nil {
+			continue
+		}
+		profile, _ := props["Connection"].Value().(dbus.ObjectPath)
+		devicePaths, _ := props["Devices"].Value().([]dbus.ObjectPath)
+		devices := make([]string, len(devicePaths))
+		for i, device := range devicePaths {
+			devices[i] = string(device)
+		}
+		connections = append(connections, ActiveConnection{
+			Path:       string(path),
+			Connection: string(profile),
+			ID:         stringProperty(props, "Id"),
+			UUID:       stringProperty(props, "Uuid"),
+			Type:       stringProperty(props, "Type"),
+			State:      ActiveConnectionStateToString(uint32(intProperty(props, "State"))),
+			Devices:    devices,
+		})
+	}
+	return connections, nil
+}
+
+// DeactivateConnection calls DeactivateConnection on NetworkManager via DBus.
+func (b networkManagerBackend) DeactivateConnection(active string) error {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to system DBus: %w", err)
+	}
+	return conn.Object(nmService, nmPath).Call(nmService+".DeactivateConnection", 0, dbus.ObjectPath(active)).Err
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	nmSettingsPath            = "/org/freedesktop/NetworkManager/Settings"
+	nmSettingsInterface       = "org.freedesktop.NetworkManager.Settings"
+	nmConnectionInterface     = "org.freedesktop.NetworkManager.Settings.Connection"
+	nmWirelessConnectionType  = "802-11-wireless"
+	nmWirelessSettingName     = "802-11-wireless"
+	nmConnectionSettingName   = "connection"
+	nmAccessPointPrivacy      = 0x1
+	nmAccessPointKeyMgmtPSK   = 0x100
+	nmAccessPointKeyMgmt8021X = 0x200
+	nmAccessPointKeyMgmtSAE   = 0x400
+	nmAccessPointKeyMgmtOWE   = 0x800
+
+	// wifiScanTimeout bounds how long a scan waits for the devices to report new results.
+	wifiScanTimeout = 10 * time.Second
+
+	// wifiScanPoll is how often LastScan is checked while waiting for a scan.
+	wifiScanPoll = 250 * time.Millisecond
+)
+
+// AccessPoint is a Wi-Fi access point visible from a wireless device.
+type AccessPoint struct {
+	Device          string   `json:"device"` // interface of the wireless device seeing it
+	Path            string   `json:"path"`   // NetworkManager object path
+	SSID            string   `json:"ssid"`
+	BSSID           string   `json:"bssid"`
+	Frequency       uint32   `json:"frequency"` // MHz
+	Band            string   `json:"band"`      // "2.4GHz", "5GHz" or "6GHz"
+	Channel         uint32   `json:"channel"`
+	Strength        uint8    `json:"strength"`   // percent
+	MaxBitrate      uint32   `json:"maxBitrate"` // kbit/s
+	Security        []string `json:"security"`   // "WEP", "WPA", "WPA2", "WPA3", "OWE" and "802.1X" for enterprise; empty if open
+	Active          bool     `json:"active"`     // the device is connected to it
+	Saved           bool     `json:"saved"`      // a connection profile exists for its SSID
+	SavedConnection string   `json:"savedConnection,omitempty"`
+}
+
+// ScanWifi lists the access points visible from every wireless device, strongest
+// first. With rescan, the devices scan first and the results are returned once
+// they have reported new ones.
+func (s *Server) ScanWifi(rescan bool) ([]AccessPoint, error) {
+	accessPoints, err := s.Network.ScanWifi(rescan)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(accessPoints, func(a, b AccessPoint) int {
+		return cmp.Compare(b.Strength, a.Strength)
+	})
+	return accessPoints, nil
+}
+
+// ScanWifi requests a scan from every NetworkManager wireless device and reads
+// their access points via DBus.
+func (b networkManagerBackend) ScanWifi(rescan bool) ([]AccessPoint, error) {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to system DBus: %w", err)
+	}
+
+	var devicePaths []dbus.ObjectPath
+	if err := conn.Object(nmService, nmPath).Call(nmService+".GetDevices", 0).Store(&devicePaths); err != nil {
+		return nil, fmt.Errorf("failed to get network devices: %w", err)
+	}
+
+	var wireless []dbus.BusObject
+	for _, path := range devicePaths {
+		devObj := conn.Object(nmService, path)
+		if typeVar, err := GetProperty(devObj, deviceInterface, "DeviceType"); err == nil && typeVar.Value() == uint32(deviceTypeWifi) {
+			wireless = append(wireless, devObj)
+		}
+	}
+
+	if rescan {
+		requestWifiScans(wireless)
+	}
+
+	profiles, err := b.Connections()
+	if err != nil {
+		return nil, err
+	}
+	// Map the SSIDs of the saved Wi-Fi profiles to their UUIDs.
+	saved := make(map[string]string)
+	for _, profile := range profiles {
+		if profile.Type == nmWirelessConnectionType {
+			saved[profile.SSID] = profile.UUID
+		}
+	}
+
+	accessPoints := []AccessPoint{}
+	for _, devObj := range wireless {
+		iface := ""
+		if ifaceVar, err := GetProperty(devObj, deviceInterface, "Interface"); err == nil {
+			iface, _ = ifaceVar.Value().(string)
+		}
+		var active dbus.ObjectPath
+		if apVar, err := GetProperty(devObj, wirelessInterface, "ActiveAccessPoint"); err == nil {
+			active, _ = apVar.Value().(dbus.ObjectPath)
+		}
+
+		var apPaths []dbus.ObjectPath
+		if err := devObj.Call(wirelessInterface+".GetAllAccessPoints", 0).Store(&apPaths); err != nil {
+			return nil, fmt.Errorf("failed to get access points of %s: %w", iface, err)
+		}
+		for _, apPath := range apPaths {
+			// Access points vanish while they are enumerated.
+			props, err := GetAllProperties(conn.Object(nmService, apPath), apInterface)
+			if err != nil {
+				continue
+			}
+			ap := accessPoint(props)
+			ap.Device = iface
+			ap.Path = string(apPath)
+			ap.Active = apPath == active
+			ap.SavedConnection, ap.Saved = saved[ap.SSID]
+			accessPoints = append(accessPoints, ap)
+		}
+	}
+	return accessPoints, nil
+}
+
+// requestWifiScans asks wireless devices to scan and waits until each of them
+// updated LastScan, or until wifiScanTimeout. Devices refusing to scan, e.g.
+// because they scanned moments ago, keep their previous results.
+func requestWifiScans(devices []dbus.BusObject) {
+	pending := make(map[dbus.BusObject]int64)
+	for _, devObj := range devices {
+		lastScan, err := GetProperty(devObj, wirelessInterface, "LastScan")
+		if err != nil {
+			// NetworkManager before 1.12 does not report LastScan.
+			lastScan = dbus.MakeVariant(int64(0))
+		}
+		if devObj.Call(wirelessInterface+".RequestScan", 0, map[string]dbus.Variant{}).Err == nil {
+			pending[devObj], _ = lastScan.Value().(int64)
+		}
+	}
+
+	deadline := time.Now().Add(wifiScanTimeout)
+	for len(pending) > 0 && time.Now().Before(deadline) {
+		time.Sleep(wifiScanPoll)
+		for devObj, previous := range pending {
+			lastScan, err := GetProperty(devObj, wirelessInterface, "LastScan")
+			if err != nil || lastScan.Value() != previous {
+				delete(pending, devObj)
+			}
+		}
+	}
+}
+
+// accessPoint converts the properties of a NetworkManager access point.
+func accessPoint(props map[string]dbus.Variant) AccessPoint {
+	ssid, _ := props["Ssid"].Value().([]byte)
+	frequency := uint32(intProperty(props, "Frequency"))
+	band, channel := wifiChannel(frequency)
+
+	return AccessPoint{
+		SSID:       string(bytes.TrimRight(ssid, "\x00")),
+		BSSID:      strings.ToUpper(stringProperty(props, "HwAddress")),
+		Frequency:  frequency,
+		Band:       band,
+		Channel:    channel,
+		Strength:   uint8(intProperty(props, "Strength")),
+		MaxBitrate: uint32(intProperty(props, "MaxBitrate")),
+		Security: wifiSecurity(
+			uint32(intProperty(props, "Flags")),
+			uint32(intProperty(props, "WpaFlags")),
+			uint32(intProperty(props, "RsnFlags")),
+		),
+	}
+}
+
+// wifiChannel returns the band and channel number of a frequency in MHz.
+func wifiChannel(frequency uint32) (string, uint32) {
+	switch {
+	case frequency == 2484:
+		return "2.4GHz", 14
+	case frequency >= 2412 && frequency < 2484:
+		return "2.4GHz", (frequency - 2407) / 5
+	case frequency >= 5955 && frequency <= 7115:
+		return "6GHz", (frequency - 5950) / 5
+	case frequency >= 5000 && frequency < 5955:
+		return "5GHz", (frequency - 5000) / 5
+	}
+	return "", 0
+}
+
+// wifiSecurity lists the security of an access point from its privacy, WPA and
+// RSN (WPA2 and later) flags, like nmcli.
+func wifiSecurity(flags, wpaFlags, rsnFlags uint32) []string {
+	security := []string{}
+	if flags&nmAccessPointPrivacy != 0 && wpaFlags == 0 && rsnFlags == 0 {
+		security = append(security, "WEP")
+	}
+	if wpaFlags != 0 {
+		security = append(security, "WPA")
+	}
+	if rsnFlags&(nmAccessPointKeyMgmtPSK|nmAccessPointKeyMgmt8021X) != 0 {
+		security = append(security, "WPA2")
+	}
+	if rsnFlags&nmAccessPointKeyMgmtSAE != 0 {
+		security = append(security, "WPA3")
+	}
+	if rsnFlags&nmAccessPointKeyMgmtOWE != 0 {
+		security = append(security, "OWE")
+	}
+	if (wpaFlags|rsnFlags)&nmAccessPointKeyMgmt8021X != 0 {
+		security = append(security, "802.1X")
+	}
+	return security
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// APIVersion is the version of the deviceapi HTTP API reported in the OpenAPI document.
+	APIVersion = "1.0.0"
+
+	openAPISchemaPrefix = "#/components/schemas/"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// openAPISchemer is implemented by types with a custom JSON representation.
+type openAPISchemer interface {
+	OpenAPISchema() map[string]any
+}
+
+var openAPISchemerType = reflect.TypeOf((*openAPISchemer)(nil)).Elem()
+
+// openAPIGenerator builds schemas from Go types, collecting named structs as components.
+type openAPIGenerator struct {
+	schemas map[string]any
+}
+
+// OpenAPI generates the OpenAPI 3 document for the given routes from their
+// request and response types and json struct tags.
+func OpenAPI(routes []Route) map[string]any {
+	g := &openAPIGenerator{schemas: make(map[string]any)}
+
+	paths := make(map[string]any)
+	for _, route := range routes {
+		operation := map[string]any{
+			"summary":   route.Summary,
+			"x-scope":   route.Scope.String(),
+			"security":  []map[string][]string{{"bearer": {}}},
+			"responses": g.responses(route),
+		}
+
+		if len(route.Query) > 0 {
+			names := make([]string, 0, len(route.Query))
+			for name := range route.Query {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			parameters := make([]map[string]any, 0, len(names))
+			for _, name := range names {
+				parameters = append(parameters, map[string]any{
+					"name":        name,
+					"in":          "query",
+					"description": route.Query[name],
+					"schema":      map[string]any{"type": "string"},
+				})
+			}
+			operation["parameters"] = parameters
+		}
+
+		if route.Request != nil && route.ContentType != "websocket" {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(route.Request))},
+				},
+			}
+		}
+
+		item, _ := paths[route.Path].(map[string]any)
+		if item == nil {
+			item = make(map[string]any)
+			paths[route.Path] = item
+		}
+		item[strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "deviceapi",
+			"description": "Get informations and control some device functions (volume, network...)",
+			"version":     APIVersion,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]any{
+				"bearer": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+	}
+}
+
+// responses describes the responses of a route.
+func (g *openAPIGenerator) responses(route Route) map[string]any {
+	responses := map[string]any{
+		"401": map[string]any{"description": "Missing or invalid credentials"},
+		"403": map[string]any{"description": "Insufficient scope"},
+	}
+
+	switch route.ContentType {
+	case "websocket":
+		description := "Switching to the WebSocket protocol"
+		if route.Request != nil && route.Response != nil {
+			description += "; clients send " + reflect.TypeOf(route.Request).Name() +
+				" and receive " + reflect.TypeOf(route.Response).Name() + " messages"
+			g.schema(reflect.TypeOf(route.Request))
+			g.schema(reflect.TypeOf(route.Response))
+		}
+		responses["101"] = map[string]any{"description": description}
+	case "":
+		responses["200"] = map[string]any{
+			"description": "Success",
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": g.schema(reflect.TypeOf(route.Response))},
+			},
+		}
+	default:
+		content := map[string]any{"schema": map[string]any{"type": "string"}}
+		if route.Response != nil {
+			content["x-item-schema"] = g.schema(reflect.TypeOf(route.Response))
+		}
+		responses["200"] = map[string]any{
+			"description": "Success",
+			"content":     map[string]any{route.ContentType: content},
+		}
+	}
+
+	return responses
+}
+
+// schema returns the JSON schema of a Go type, referencing named structs.
+func (g *openAPIGenerator) schema(t reflect.Type) map[string]any {
+	if t == nil {
+		return map[string]any{}
+	}
+
+	if t.Kind() != reflect.Pointer && t.Implements(openAPISchemerType) {
+		return reflect.Zero(t).Interface().(openAPISchemer).OpenAPISchema()
+	}
+
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := g.schema(t.Elem())
+		if _, isRef := schema["$ref"]; isRef {
+			return map[string]any{"allOf": []any{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			// Register before recursing so self-referencing types terminate.
+			g.schemas[t.Name()] = map[string]any{}
+			g.schemas[t.Name()] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": openAPISchemaPrefix + t.Name()}
+	default:
+		// Interfaces may hold any JSON value.
+		return map[string]any{}
+	}
+}
+
+// structSchema returns the object schema of a struct from its exported fields and json tags.
+func (g *openAPIGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = g.schema(field.Type)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Pointer {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// OpenAPIHandler handles GET requests and returns the OpenAPI document of deviceapi.
+func (s *Server) OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OpenAPI(s.Routes()))
+}
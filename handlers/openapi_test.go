@@ -0,0 +1,151 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/giftpilz0/sysutil/handlers"
+)
+
+// checkSchema checks that an OpenAPI schema describes values of typ, resolving
+// component references and requiring every JSON field of a struct.
+func checkSchema(t *testing.T, where string, components map[string]any, schema map[string]any, typ reflect.Type) {
+	t.Helper()
+
+	if allOf, ok := schema["allOf"].([]any); ok && len(allOf) == 1 {
+		schema, _ = allOf[0].(map[string]any)
+	}
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Slice:
+		items, _ := schema["items"].(map[string]any)
+		if schema["type"] != "array" || items == nil {
+			t.Errorf("%s: got schema %v, want an array of %s", where, schema, typ.Elem())
+			return
+		}
+		checkSchema(t, where, components, items, typ.Elem())
+	case reflect.Map:
+		if schema["type"] != "object" {
+			t.Errorf("%s: got schema %v, want an object", where, schema)
+		}
+	case reflect.Struct:
+		ref, _ := schema["$ref"].(string)
+		component, _ := components[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]any)
+		if ref != "#/components/schemas/"+typ.Name() || component == nil {
+			t.Errorf("%s: got schema %v, want a reference to the %s component", where, schema, typ.Name())
+			return
+		}
+		properties, _ := component["properties"].(map[string]any)
+		for i := range typ.NumField() {
+			field := typ.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			if _, ok := properties[name]; !ok {
+				t.Errorf("%s: got %s without property %s", where, typ.Name(), name)
+			}
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	t.Parallel()
+
+	backends := handlers.Backends{Audio: useFakeAudio(t), Network: useFakeNetwork(t)}
+	resp, err := http.Get(newServer(t, handlers.ScopeRead, backends).URL + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var document struct {
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		t.Fatal(err)
+	}
+
+	routes := handlers.NewServer(backends).Routes()
+	operations := 0
+	for _, item := range document.Paths {
+		operations += len(item)
+	}
+	if operations != len(routes) {
+		t.Errorf("got %d operations, want one for each of the %d routes", operations, len(routes))
+	}
+
+	for _, route := range routes {
+		where := route.Method + " " + route.Path
+		operation := document.Paths[route.Path][strings.ToLower(route.Method)]
+		if operation == nil {
+			t.Errorf("%s: missing from the OpenAPI document", where)
+			continue
+		}
+		if operation["x-scope"] != route.Scope.String() {
+			t.Errorf("%s: got scope %v, want %s", where, operation["x-scope"], route.Scope)
+		}
+
+		var decoded struct {
+			RequestBody struct {
+				Content map[string]struct {
+					Schema map[string]any `json:"schema"`
+				} `json:"content"`
+			} `json:"requestBody"`
+			Responses map[string]struct {
+				Content map[string]struct {
+					Schema map[string]any `json:"schema"`
+				} `json:"content"`
+			} `json:"responses"`
+		}
+		encoded, err := json.Marshal(operation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(encoded, &decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		switch {
+		case route.ContentType == "websocket":
+		case route.Request != nil:
+			request, ok := decoded.RequestBody.Content["application/json"]
+			if !ok {
+				t.Errorf("%s: got no JSON request body", where)
+				break
+			}
+			checkSchema(t, where+" request", document.Components.Schemas, request.Schema, reflect.TypeOf(route.Request))
+		case route.Method == http.MethodPost:
+			t.Errorf("%s: got no request type", where)
+		}
+
+		switch route.ContentType {
+		case "websocket":
+			if _, ok := decoded.Responses["101"]; !ok {
+				t.Errorf("%s: got no switching protocols response", where)
+			}
+		case "":
+			response, ok := decoded.Responses["200"].Content["application/json"]
+			if !ok || route.Response == nil {
+				t.Errorf("%s: got no JSON response", where)
+				break
+			}
+			checkSchema(t, where+" response", document.Components.Schemas, response.Schema, reflect.TypeOf(route.Response))
+		default:
+			if _, ok := decoded.Responses["200"].Content[route.ContentType]; !ok {
+				t.Errorf("%s: got no %s response", where, route.ContentType)
+			}
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package handlers
+
+import (
+	"fmt"
+	"net"
+)
+
+// peerUID is only implemented on Linux; unix socket clients are rejected elsewhere.
+func peerUID(conn *net.UnixConn) (uint32, error) {
+	return 0, fmt.Errorf("peer credentials are not supported on this platform")
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	ppdService   = "net.hadess.PowerProfiles"
+	ppdPath      = "/net/hadess/PowerProfiles"
+	ppdInterface = "net.hadess.PowerProfiles"
+)
+
+// ErrInvalidPowerRequest is returned when a power profile or charge threshold
+// change names an unknown profile or device, or one without threshold support.
+var ErrInvalidPowerRequest = errors.New("invalid power request")
+
+// PowerProfiles holds the power profiles offered by power-profiles-daemon.
+type PowerProfiles struct {
+	Active              string         `json:"active"` // "power-saver", "balanced" or "performance"
+	Profiles            []PowerProfile `json:"profiles"`
+	PerformanceDegraded string         `json:"performanceDegraded,omitempty"` // why performance is degraded, e.g. "lap-detected"
+}
+
+// PowerProfile is a profile and the driver implementing it.
+type PowerProfile struct {
+	Name   string `json:"name"`
+	Driver string `json:"driver"` // e.g. "platform_profile", "intel_pstate" or "placeholder"
+}
+
+// PowerProfileRequest selects the active power profile.
+type PowerProfileRequest struct {
+	Profile string `json:"profile"`
+}
+
+// ChargeThresholdRequest enables or disables the charge thresholds of a battery,
+// which stop charging between ChargeStartThreshold and ChargeEndThreshold to
+// preserve its health.
+type ChargeThresholdRequest struct {
+	Device  string `json:"device"` // native path, e.g. "BAT0", or UPower object path
+	Enabled bool   `json:"enabled"`
+}
+
+// GetPowerProfiles retrieves the power profiles from the power backend.
+func (s *Server) GetPowerProfiles() (PowerProfiles, error) {
+	return s.Power.PowerProfiles()
+}
+
+// SetPowerProfile activates one of the power profiles.
+func (s *Server) SetPowerProfile(profile string) error {
+	profiles, err := s.Power.PowerProfiles()
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(profiles.Profiles, func(p PowerProfile) bool { return p.Name == profile }) {
+		return fmt.Errorf("%w: unknown power profile %q", ErrInvalidPowerRequest, profile)
+	}
+	if err := s.Power.SetPowerProfile(profile); err != nil {
+		return fmt.Errorf("failed to set power profile %s: %w", profile, err)
+	}
+	return nil
+}
+
+// SetChargeThreshold enables or disables the charge thresholds of a battery.
+func (s *Server) SetChargeThreshold(device string, enabled bool) error {
+	battery, err := s.Power.Battery()
+	if err != nil {
+		return err
+	}
+
+	index := slices.IndexFunc(battery.Devices, func(d PowerDevice) bool { return d.NativePath == device || d.Path == device })
+	if index < 0 {
+		return fmt.Errorf("%w: unknown power device %q", ErrInvalidPowerRequest, device)
+	}
+	if !battery.Devices[index].ChargeThresholdSupported {
+		return fmt.Errorf("%w: %s does not support charge thresholds", ErrInvalidPowerRequest, device)
+	}
+
+	if err := s.Power.SetChargeThreshold(battery.Devices[index].Path, enabled); err != nil {
+		return fmt.Errorf("failed to set charge threshold of %s: %w", device, err)
+	}
+	return nil
+}
+
+// PowerProfiles reads the profiles from power-profiles-daemon via DBus.
+func (b systemPowerBackend) PowerProfiles() (PowerProfiles, error) {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return PowerProfiles{}, fmt.Errorf("failed to connect to system DBus for power profiles: %w", err)
+	}
+
+	props, err := GetAllProperties(conn.Object(ppdService, ppdPath), ppdInterface)
+	if err != nil {
+		return PowerProfiles{}, fmt.Errorf("failed to get power profiles: %w", err)
+	}
+
+	profiles := PowerProfiles{
+		Active:              stringProperty(props, "ActiveProfile"),
+		Profiles:            []PowerProfile{},
+		PerformanceDegraded: stringProperty(props, "PerformanceDegraded"),
+	}
+	available, _ := props["Profiles"].Value().([]map[string]dbus.Variant)
+	for _, profile := range available {
+		// Newer versions report CpuDriver and PlatformDriver instead of Driver.
+		drivers := []string{}
+		for _, key := range []string{"Driver", "PlatformDriver", "CpuDriver"} {
+			if driver := stringProperty(profile, key); driver != "" && !slices.Contains(drivers, driver) {
+				drivers = append(drivers, driver)
+			}
+		}
+		profiles.Profiles = append(profiles.Profiles, PowerProfile{
+			Name:   stringProperty(profile, "Profile"),
+			Driver: strings.Join(drivers, ","),
+		})
+	}
+	return profiles, nil
+}
+
+// SetPowerProfile sets the active profile of power-profiles-daemon via DBus.
+func (b systemPowerBackend) SetPowerProfile(profile string) error {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to system DBus for power profiles: %w", err)
+	}
+	return conn.Object(ppdService, ppdPath).SetProperty(ppdInterface+".ActiveProfile", dbus.MakeVariant(profile))
+}
+
+// SetChargeThreshold calls EnableChargeThreshold on a UPower device via DBus.
+func (b systemPowerBackend) SetChargeThreshold(device string, enabled bool) error {
+	conn, err := busConn(b.conn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to system DBus for charge threshold: %w", err)
+	}
+	return conn.Object(upowerService, dbus.ObjectPath(device)).Call(upowerDeviceInterface+".EnableChargeThreshold", 0, enabled).Err
+}
@@ -0,0 +1,104 @@
+//go:build linux
+
+package handlers
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// rfkillTypes are the rfkill device types, indexed by their number in the
+// kernel; 0 stands for all types.
+var rfkillTypes = []string{"all", "wlan", "bluetooth", "uwb", "wimax", "wwan", "gps", "fm", "nfc"}
+
+// rfkillOpChangeAll is the operation of an rfkill event changing every device of a type.
+const rfkillOpChangeAll = 3
+
+// sysfsRfkill reads rfkill devices from sysfs and blocks them through the rfkill
+// control device.
+type sysfsRfkill struct {
+	sysfs  string
+	device string
+}
+
+// NewSysfsRfkill creates an rfkill backend reading the devices under sysfs, like
+// /sys/class/rfkill, and writing events to device, like /dev/rfkill.
+func NewSysfsRfkill(sysfs, device string) RfkillBackend {
+	return sysfsRfkill{sysfs: sysfs, device: device}
+}
+
+// NewRfkillBackend creates the rfkill backend of the kernel devices.
+func NewRfkillBackend() RfkillBackend {
+	return NewSysfsRfkill("/sys/class/rfkill", "/dev/rfkill")
+}
+
+// Devices lists the rfkill devices, none when the kernel has no rfkill support.
+func (r sysfsRfkill) Devices() ([]RfkillDevice, error) {
+	entries, err := os.ReadDir(r.sysfs)
+	if os.IsNotExist(err) {
+		return []RfkillDevice{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rfkill devices: %w", err)
+	}
+
+	devices := []RfkillDevice{}
+	for _, entry := range entries {
+		dir := filepath.Join(r.sysfs, entry.Name())
+		read := func(name string) string {
+			value, _ := os.ReadFile(filepath.Join(dir, name))
+			return strings.TrimSpace(string(value))
+		}
+		index, err := strconv.ParseUint(read("index"), 10, 32)
+		if err != nil {
+			// Devices vanish while they are enumerated.
+			continue
+		}
+		devices = append(devices, RfkillDevice{
+			Index: uint32(index),
+			Name:  read("name"),
+			Type:  read("type"),
+			Soft:  read("soft") == "1",
+			Hard:  read("hard") == "1",
+		})
+	}
+	slices.SortFunc(devices, func(a, b RfkillDevice) int { return int(a.Index) - int(b.Index) })
+	return devices, nil
+}
+
+// SetBlocked writes an event changing every device of a type to the rfkill
+// control device, which needs write access to it.
+func (r sysfsRfkill) SetBlocked(rfkillType string, blocked bool) error {
+	kind := 0
+	if rfkillType != "" {
+		kind = slices.Index(rfkillTypes, rfkillType)
+		if kind <= 0 {
+			return fmt.Errorf("%w: unknown rfkill type %q", ErrInvalidNetworkRequest, rfkillType)
+		}
+	}
+
+	// struct rfkill_event: __u32 idx, __u8 type, op, soft and hard.
+	event := binary.NativeEndian.AppendUint32(nil, 0)
+	event = append(event, byte(kind), rfkillOpChangeAll, 0, 0)
+	if blocked {
+		event[6] = 1
+	}
+
+	file, err := os.OpenFile(r.device, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", r.device, err)
+	}
+	_, err = file.Write(event)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write rfkill event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+//go:build linux
+
+package handlers_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/giftpilz0/sysutil/handlers"
+)
+
+func TestSysfsRfkill(t *testing.T) {
+	sysfs := t.TempDir()
+	for name, files := range map[string]map[string]string{
+		"rfkill1": {"index": "1\n", "name": "hci0\n", "type": "bluetooth\n", "soft": "1\n", "hard": "0\n"},
+		"rfkill0": {"index": "0\n", "name": "phy0\n", "type": "wlan\n", "soft": "0\n", "hard": "1\n"},
+	} {
+		dir := filepath.Join(sysfs, name)
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for file, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	device := filepath.Join(t.TempDir(), "rfkill")
+	if err := os.WriteFile(device, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rfkill := handlers.NewSysfsRfkill(sysfs, device)
+
+	devices, err := rfkill.Devices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []handlers.RfkillDevice{
+		{Index: 0, Name: "phy0", Type: "wlan", Hard: true},
+		{Index: 1, Name: "hci0", Type: "bluetooth", Soft: true},
+	}
+	if !reflect.DeepEqual(devices, want) {
+		t.Errorf("got devices %+v, want %+v", devices, want)
+	}
+
+	if err := rfkill.SetBlocked("bluetooth", true); err != nil {
+		t.Fatal(err)
+	}
+	event, err := os.ReadFile(device)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Index 0, type bluetooth (2), op change all (3), soft blocked.
+	if !bytes.Equal(event[4:], []byte{2, 3, 1, 0}) || len(event) != 8 {
+		t.Errorf("got rfkill event %v, want bluetooth blocked", event)
+	}
+	if err := rfkill.SetBlocked("radio", true); err == nil {
+		t.Error("got no error for an unknown rfkill type")
+	}
+
+	if devices, err := handlers.NewSysfsRfkill(filepath.Join(sysfs, "missing"), device).Devices(); err != nil || len(devices) != 0 {
+		t.Errorf("got %v, %v without rfkill support, want no devices", devices, err)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package handlers
+
+import "fmt"
+
+// unsupportedRfkill reports no rfkill devices, as rfkill is only implemented on Linux.
+type unsupportedRfkill struct{}
+
+// NewRfkillBackend creates an rfkill backend without devices, as outside Linux.
+func NewRfkillBackend() RfkillBackend {
+	return unsupportedRfkill{}
+}
+
+// Devices returns no devices.
+func (unsupportedRfkill) Devices() ([]RfkillDevice, error) {
+	return []RfkillDevice{}, nil
+}
+
+// SetBlocked always fails.
+func (unsupportedRfkill) SetBlocked(rfkillType string, blocked bool) error {
+	return fmt.Errorf("rfkill is not supported on this platform")
+}
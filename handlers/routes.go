@@ -0,0 +1,358 @@
+package handlers
+
+import "net/http"
+
+// Route describes an HTTP endpoint and the scope a client needs to call it.
+// Request and Response hold zero values whose types describe the JSON bodies
+// in the OpenAPI document; ContentType is set for endpoints not answering JSON.
+type Route struct {
+	Method      string
+	Path        string
+	Scope       Scope
+	Summary     string
+	Query       map[string]string
+	Request     any
+	Response    any
+	ContentType string
+	Handler     http.HandlerFunc
+}
+
+// StatusResponse is returned by endpoints that only report success.
+type StatusResponse struct {
+	Status string `json:"status"`
+}
+
+// Routes returns every endpoint served by deviceapi.
+func (s *Server) Routes() []Route {
+	return []Route{
+		{
+			Method:   http.MethodGet,
+			Path:     "/network",
+			Scope:    ScopeRead,
+			Summary:  "List network devices",
+			Response: []NetworkDevice{},
+			Handler:  s.NetworkHandler,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/network/status",
+			Scope:    ScopeRead,
+			Summary:  "Get the overall network state and connectivity",
+			Response: NetworkStatus{},
+			Handler:  s.NetworkStatusHandler,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/network/wifi/scan",
+			Scope:    ScopeRead,
+			Summary:  "Scan for Wi-Fi networks and list the visible access points, strongest first",
+			Query:    map[string]string{"rescan": "Ask the wireless devices to scan before listing, needs the write scope (true/false, default false)"},
+			Response: []AccessPoint{},
+			Handler:  s.WifiScanHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/network/wifi/connect",
+			Scope:    ScopeWrite,
+			Summary:  "Add a connection profile for a Wi-Fi network and activate it",
+			Request:  WifiConnectRequest{},
+			Response: StatusResponse{},
+			Handler:  s.WifiConnectHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/network/devices/disconnect",
+			Scope:    ScopeWrite,
+			Summary:  "Disconnect a network device",
+			Request:  DisconnectDeviceRequest{},
+			Response: StatusResponse{},
+			Handler:  s.DisconnectDeviceHandler,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/network/connections",
+			Scope:    ScopeRead,
+			Summary:  "List the saved connection profiles",
+			Response: []ConnectionProfile{},
+			Handler:  s.ConnectionsHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/network/connections/activate",
+			Scope:    ScopeWrite,
+			Summary:  "Activate a saved connection profile",
+			Request:  ActivateConnectionRequest{},
+			Response: StatusResponse{},
+			Handler:  s.ActivateConnectionHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/network/connections/delete",
+			Scope:    ScopeWrite,
+			Summary:  "Delete a saved connection profile",
+			Request:  DeleteConnectionRequest{},
+			Response: StatusResponse{},
+			Handler:  s.DeleteConnectionHandler,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/network/vpn",
+			Scope:    ScopeRead,
+			Summary:  "List the VPN and WireGuard connections and whether they are active",
+			Response: []VPNConnection{},
+			Handler:  s.VPNHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/network/vpn/up",
+			Scope:    ScopeWrite,
+			Summary:  "Activate a VPN or WireGuard connection",
+			Request:  VPNRequest{},
+			Response: StatusResponse{},
+			Handler:  s.VPNUpHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/network/vpn/down",
+			Scope:    ScopeWrite,
+			Summary:  "Deactivate a VPN or WireGuard connection",
+			Request:  VPNRequest{},
+			Response: StatusResponse{},
+			Handler:  s.VPNDownHandler,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/network/radio",
+			Scope:    ScopeRead,
+			Summary:  "Get the radio switches, the rfkill devices and whether airplane mode is on",
+			Response: RadioState{},
+			Handler:  s.RadioHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/network/radio/enable",
+			Scope:    ScopeWrite,
+			Summary:  "Enable or disable networking, Wi-Fi, mobile broadband or Bluetooth",
+			Request:  RadioRequest{},
+			Response: StatusResponse{},
+			Handler:  s.EnableRadioHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/network/radio/airplane-mode",
+			Scope:    ScopeWrite,
+			Summary:  "Turn airplane mode on or off",
+			Request:  AirplaneModeRequest{},
+			Response: StatusResponse{},
+			Handler:  s.AirplaneModeHandler,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/bluetooth",
+			Scope:    ScopeRead,
+			Summary:  "List the Bluetooth adapters and devices",
+			Response: Bluetooth{},
+			Handler:  s.BluetoothHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/bluetooth/power",
+			Scope:    ScopeWrite,
+			Summary:  "Power a Bluetooth adapter on or off",
+			Request:  BluetoothPowerRequest{},
+			Response: StatusResponse{},
+			Handler:  s.BluetoothPowerHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/bluetooth/discovery",
+			Scope:    ScopeWrite,
+			Summary:  "Start or stop discovering Bluetooth devices",
+			Request:  BluetoothDiscoveryRequest{},
+			Response: StatusResponse{},
+			Handler:  s.BluetoothDiscoveryHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/bluetooth/devices/connect",
+			Scope:    ScopeWrite,
+			Summary:  "Connect a Bluetooth device",
+			Request:  BluetoothDeviceRequest{},
+			Response: StatusResponse{},
+			Handler:  s.BluetoothConnectHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/bluetooth/devices/disconnect",
+			Scope:    ScopeWrite,
+			Summary:  "Disconnect a Bluetooth device",
+			Request:  BluetoothDeviceRequest{},
+			Response: StatusResponse{},
+			Handler:  s.BluetoothDisconnectHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/bluetooth/devices/pair",
+			Scope:    ScopeWrite,
+			Summary:  "Pair with and trust a Bluetooth device",
+			Request:  BluetoothDeviceRequest{},
+			Response: StatusResponse{},
+			Handler:  s.BluetoothPairHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/bluetooth/devices/remove",
+			Scope:    ScopeWrite,
+			Summary:  "Unpair and forget a Bluetooth device",
+			Request:  BluetoothDeviceRequest{},
+			Response: StatusResponse{},
+			Handler:  s.BluetoothRemoveHandler,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/battery",
+			Scope:    ScopeRead,
+			Summary:  "Get the battery status",
+			Response: Battery{},
+			Handler:  s.BatteryHandler,
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/battery/history",
+			Scope:   ScopeRead,
+			Summary: "Get the recorded battery samples and the history and statistics kept by UPower",
+			Query: map[string]string{
+				"since": "Start of the history, a time in RFC 3339 format or a duration before now like 12h (default 24h)",
+				"step":  "Average the recorded samples over intervals of this duration, e.g. 5m",
+			},
+			Response: BatteryHistoryResponse{},
+			Handler:  s.BatteryHistoryHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/battery/charge-threshold",
+			Scope:    ScopeWrite,
+			Summary:  "Enable or disable the charge thresholds of a battery",
+			Request:  ChargeThresholdRequest{},
+			Response: StatusResponse{},
+			Handler:  s.ChargeThresholdHandler,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/power/profiles",
+			Scope:    ScopeRead,
+			Summary:  "List the power profiles and the active one",
+			Response: PowerProfiles{},
+			Handler:  s.PowerProfilesHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/power/profiles/active",
+			Scope:    ScopeWrite,
+			Summary:  "Select the active power profile",
+			Request:  PowerProfileRequest{},
+			Response: StatusResponse{},
+			Handler:  s.PowerProfileHandler,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/audio/outputs",
+			Scope:    ScopeRead,
+			Summary:  "List audio output devices (sinks)",
+			Response: []AudioInfo{},
+			Handler:  s.AudioOutputsHandler,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/audio/inputs",
+			Scope:    ScopeRead,
+			Summary:  "List audio input devices (sources)",
+			Response: []AudioInfo{},
+			Handler:  s.AudioInputsHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/audio/actions",
+			Scope:    ScopeWrite,
+			Summary:  "Change port, volume, mute and default audio devices, reporting the result of each action",
+			Query:    map[string]string{"atomic": "Roll back all applied actions when one fails (true/false)"},
+			Request:  []VolumeAction{},
+			Response: ActionsResponse{},
+			Handler:  s.AudioActionsHandler,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/audio/streams",
+			Scope:    ScopeRead,
+			Summary:  "List application playback (sink-input) and recording (source-output) streams",
+			Query:    map[string]string{"type": "Only list streams of this type: sink-input or source-output"},
+			Response: []AudioStream{},
+			Handler:  s.AudioStreamsHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/audio/streams/actions",
+			Scope:    ScopeWrite,
+			Summary:  "Change volume and mute of application streams or move them to another device",
+			Query:    map[string]string{"atomic": "Roll back all applied actions when one fails (true/false)"},
+			Request:  []StreamAction{},
+			Response: ActionsResponse{},
+			Handler:  s.AudioStreamActionsHandler,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/audio/cards",
+			Scope:    ScopeRead,
+			Summary:  "List sound cards with their profiles and ports",
+			Response: []AudioCard{},
+			Handler:  s.AudioCardsHandler,
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/audio/cards/actions",
+			Scope:    ScopeWrite,
+			Summary:  "Switch the active profile of sound cards",
+			Query:    map[string]string{"atomic": "Roll back all applied actions when one fails (true/false)"},
+			Request:  []CardAction{},
+			Response: ActionsResponse{},
+			Handler:  s.AudioCardActionsHandler,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/events",
+			Scope:       ScopeRead,
+			Summary:     "Stream device state changes as Server-Sent Events",
+			Query:       map[string]string{"types": "Comma separated event types to receive, all if empty"},
+			Response:    Event{},
+			ContentType: "text/event-stream",
+			Handler:     s.EventsHandler,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/ws",
+			Scope:       ScopeRead,
+			Summary:     "WebSocket control channel exchanging WSRequest and WSResponse messages",
+			Query:       map[string]string{"types": "Comma separated event types to receive, all if empty"},
+			Request:     WSRequest{},
+			Response:    WSResponse{},
+			ContentType: "websocket",
+			Handler:     s.WebSocketHandler,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        "/metrics",
+			Scope:       ScopeRead,
+			Summary:     "Device metrics in Prometheus text format",
+			ContentType: metricsContentType,
+			Handler:     s.MetricsHandler,
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/openapi.json",
+			Scope:    ScopeRead,
+			Summary:  "OpenAPI 3 document describing this API",
+			Response: map[string]any{},
+			Handler:  s.OpenAPIHandler,
+		},
+	}
+}
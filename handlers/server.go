@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Backends are the services the handlers read and change devices through.
+type Backends struct {
+	Audio     AudioBackend
+	Power     PowerBackend
+	Network   NetworkBackend
+	Rfkill    RfkillBackend
+	Bluetooth BluetoothBackend
+
+	// History holds the battery samples served by /battery/history, nil when
+	// none are recorded.
+	History *BatteryHistory
+}
+
+// Server serves the deviceapi endpoints on a set of backends and streams their
+// state changes to event subscribers.
+type Server struct {
+	Backends
+
+	// volumeCeiling is the highest volume in percent an action may set with AllowAbove100.
+	volumeCeiling int
+	// wsOrigins are the additional browser origins allowed to open a WebSocket.
+	wsOrigins map[string]bool
+
+	events *EventBroker
+	// eventsDebounce and eventsResync pace the refreshes of the event stream.
+	eventsDebounce time.Duration
+	eventsResync   time.Duration
+
+	// discoveryTimers stop the Bluetooth discoveries started by the server, by adapter path.
+	discoveryMu     sync.Mutex
+	discoveryTimers map[string]*time.Timer
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithVolumeCeiling sets the highest volume in percent actions may set when they
+// allow amplification above 100% (default 150).
+func WithVolumeCeiling(percent int) Option {
+	return func(s *Server) {
+		s.volumeCeiling = percent
+	}
+}
+
+// WithWebSocketOrigins sets the browser origins, besides the server's own, that
+// may open a WebSocket, e.g. "http://localhost:3000".
+func WithWebSocketOrigins(origins ...string) Option {
+	return func(s *Server) {
+		for _, origin := range origins {
+			s.wsOrigins[strings.TrimSuffix(origin, "/")] = true
+		}
+	}
+}
+
+// NewServer creates a server on backends. Backends left nil talk to the system
+// services: pactl, UPower, NetworkManager, the kernel rfkill devices and BlueZ.
+func NewServer(backends Backends, options ...Option) *Server {
+	if backends.Audio == nil {
+		backends.Audio = NewPactlBackend()
+	}
+	if backends.Power == nil {
+		backends.Power = NewSystemPowerBackend(nil)
+	}
+	if backends.Network == nil {
+		backends.Network = NewNetworkManagerBackend(nil)
+	}
+	if backends.Rfkill == nil {
+		backends.Rfkill = NewRfkillBackend()
+	}
+	if backends.Bluetooth == nil {
+		backends.Bluetooth = NewBlueZBackend(nil)
+	}
+	s := &Server{
+		Backends:        backends,
+		volumeCeiling:   defaultVolumeCeiling,
+		wsOrigins:       make(map[string]bool),
+		events:          NewEventBroker(),
+		eventsDebounce:  eventsDebounce,
+		eventsResync:    eventsResync,
+		discoveryTimers: make(map[string]*time.Timer),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
@@ -0,0 +1,50 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/giftpilz0/sysutil/client"
+	"github.com/giftpilz0/sysutil/handlers"
+)
+
+// newServer serves every route on backends as deviceapi does, granting anonymous
+// clients the given scope.
+func newServer(t *testing.T, anonymous handlers.Scope, backends handlers.Backends) *httptest.Server {
+	t.Helper()
+
+	return serve(t, anonymous, handlers.NewServer(backends))
+}
+
+// serve serves every route of deviceServer as deviceapi does, granting anonymous
+// clients the given scope.
+func serve(t *testing.T, anonymous handlers.Scope, deviceServer *handlers.Server) *httptest.Server {
+	t.Helper()
+
+	auth, err := handlers.NewAuth(handlers.AuthConfig{Anonymous: anonymous})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	for _, route := range deviceServer.Routes() {
+		mux.Handle(route.Path, auth.Require(route.Scope, route.Handler))
+	}
+
+	server := httptest.NewUnstartedServer(mux)
+	server.Config.ConnContext = handlers.ConnContext
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newClient returns a client for a server started by newServer.
+func newClient(t *testing.T, anonymous handlers.Scope, backends handlers.Backends) *client.Client {
+	t.Helper()
+
+	c, err := client.New(newServer(t, anonymous, backends).URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/giftpilz0/sysutil/internal/websocket"
+)
+
+const (
+	// WebSocket request message types.
+	WSTypeActions       = "actions"
+	WSTypeStreamActions = "streamActions"
+	WSTypeCardActions   = "cardActions"
+	WSTypeQuery         = "query"
+
+	// WebSocket response message types.
+	WSTypeResult = "result"
+	WSTypeError  = "error"
+	WSTypeEvent  = "event"
+)
+
+// WSRequest is a message sent by a WebSocket client. Actions and Atomic carry the
+// same payload and mode as POST /audio/actions, or POST /audio/streams/actions for
+// "streamActions" and POST /audio/cards/actions for "cardActions", replied with an ActionsResponse;
+// Query names an event type whose current state is wanted.
+type WSRequest struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Actions json.RawMessage `json:"actions,omitempty"`
+	Atomic  bool            `json:"atomic,omitempty"`
+	Query   string          `json:"query,omitempty"`
+}
+
+// WSResponse is a message sent to a WebSocket client: the result of a request,
+// an error, or an unsolicited state change.
+type WSResponse struct {
+	ID    string `json:"id,omitempty"`
+	Type  string `json:"type"`
+	Data  any    `json:"data,omitempty"`
+	Error string `json:"error,omitempty"`
+	Event *Event `json:"event,omitempty"`
+}
+
+// checkOrigin rejects cross-site browser connections, which would otherwise let any
+// web page the user visits control their devices. Besides the configured origins,
+// only pages served from a loopback host to the same host may connect: a page
+// rebinding its own domain to the server controls both Origin and Host.
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || s.wsOrigins[origin] {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	return err == nil && isLoopbackHost(parsed.Hostname()) && strings.EqualFold(parsed.Host, r.Host)
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback address.
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// WebSocketHandler serves a WebSocket control channel. Clients send WSRequest
+// messages and receive WSResponse replies plus an "event" message for every
+// state change, starting with the current state of every event type.
+func (s *Server) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkOrigin(r) {
+		http.Error(w, "Origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.Close(websocket.CloseNormal, "")
+
+	scope := ScopeFromContext(r.Context())
+	types := parseEventTypes(r)
+	ch, cancel := s.events.Subscribe()
+	defer cancel()
+
+	send := func(response WSResponse) error {
+		data, err := json.Marshal(response)
+		if err != nil {
+			return err
+		}
+		return conn.WriteMessage(websocket.TextMessage, data)
+	}
+
+	// Push the current state and all following changes until the connection ends.
+	go func() {
+		var lastID uint64
+		for _, event := range s.events.Snapshot() {
+			if types == nil || types[event.Type] {
+				if err := send(WSResponse{Type: WSTypeEvent, Event: &event}); err != nil {
+					return
+				}
+			}
+			lastID = event.ID
+		}
+
+		keepAlive := time.NewTicker(eventsKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				conn.Close(websocket.CloseGoingAway, "server shutting down")
+				return
+			case event, ok := <-ch:
+				if !ok {
+					conn.Close(websocket.CloseGoingAway, "client too slow")
+					return
+				}
+				if event.ID <= lastID || (types != nil && !types[event.Type]) {
+					continue
+				}
+				if err := send(WSResponse{Type: WSTypeEvent, Event: &event}); err != nil {
+					return
+				}
+			case <-keepAlive.C:
+				if err := conn.Ping(); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			if !errors.Is(err, websocket.ErrClosed) {
+				log.Printf("WebSocket read failed: %v", err)
+			}
+			return
+		}
+		if messageType != websocket.TextMessage {
+			continue
+		}
+
+		if err := send(s.handleWSRequest(message, scope)); err != nil {
+			return
+		}
+	}
+}
+
+// handleWSRequest executes a single WebSocket request and builds its reply.
+func (s *Server) handleWSRequest(message []byte, scope Scope) WSResponse {
+	var request WSRequest
+	if err := json.Unmarshal(message, &request); err != nil {
+		return WSResponse{Type: WSTypeError, Error: "invalid request: " + err.Error()}
+	}
+
+	switch request.Type {
+	case WSTypeActions, WSTypeStreamActions, WSTypeCardActions:
+		if scope < ScopeWrite {
+			return WSResponse{ID: request.ID, Type: WSTypeError, Error: "Forbidden"}
+		}
+		process := s.ProcessAudioActions
+		switch request.Type {
+		case WSTypeStreamActions:
+			process = s.ProcessStreamActions
+		case WSTypeCardActions:
+			process = s.ProcessCardActions
+		}
+		response, _ := actionsResponse(process, request.Actions, request.Atomic)
+		return WSResponse{ID: request.ID, Type: WSTypeResult, Data: response}
+
+	case WSTypeQuery:
+		source, ok := s.eventSources()[request.Query]
+		if !ok {
+			return WSResponse{ID: request.ID, Type: WSTypeError, Error: "unknown query " + request.Query}
+		}
+		state, err := source()
+		if err != nil {
+			return WSResponse{ID: request.ID, Type: WSTypeError, Error: err.Error()}
+		}
+		return WSResponse{ID: request.ID, Type: WSTypeResult, Data: state}
+
+	default:
+		return WSResponse{ID: request.ID, Type: WSTypeError, Error: "unknown request type " + request.Type}
+	}
+}
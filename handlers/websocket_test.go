@@ -0,0 +1,174 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/giftpilz0/sysutil/client"
+	"github.com/giftpilz0/sysutil/handlers"
+)
+
+// receive returns the next reply of a WebSocket, decoding its data into data.
+func receive(t *testing.T, ws *client.WebSocket, data any) handlers.WSResponse {
+	t.Helper()
+
+	response, err := ws.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != nil && response.Data != nil {
+		encoded, err := json.Marshal(response.Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(encoded, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return response
+}
+
+func TestWebSocket(t *testing.T) {
+	t.Parallel()
+
+	fake := useFakeAudio(t)
+	c := newClient(t, handlers.ScopeWrite, handlers.Backends{Audio: fake})
+	ws, err := c.WebSocket(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	if err := ws.Send(handlers.WSRequest{ID: "1", Type: handlers.WSTypeQuery, Query: handlers.EventAudioOutputs}); err != nil {
+		t.Fatal(err)
+	}
+	var outputs []handlers.AudioInfo
+	if response := receive(t, ws, &outputs); response.ID != "1" || response.Type != handlers.WSTypeResult {
+		t.Fatalf("got reply %+v, want the result of 1", response)
+	}
+	if len(outputs) != 2 || outputs[0].Name != "speakers" {
+		t.Errorf("got outputs %+v, want speakers and hdmi", outputs)
+	}
+
+	actions, err := json.Marshal([]handlers.VolumeAction{{Device: "hdmi", Adjust: handlers.AbsoluteVolume(20)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.Send(handlers.WSRequest{ID: "2", Type: handlers.WSTypeActions, Actions: actions}); err != nil {
+		t.Fatal(err)
+	}
+	var result handlers.ActionsResponse
+	if response := receive(t, ws, &result); response.ID != "2" || result.Status != handlers.ActionsStatusSuccess {
+		t.Fatalf("got reply %+v with %+v, want the success of 2", response, result)
+	}
+	if hdmi := device(t, fake, "sink", "hdmi"); hdmi.Volume != 20 {
+		t.Errorf("got hdmi at %d%%, want 20%%", hdmi.Volume)
+	}
+
+	for _, request := range []handlers.WSRequest{
+		{ID: "3", Type: handlers.WSTypeQuery, Query: "audio.unknown"},
+		{ID: "4", Type: "subscribe"},
+	} {
+		if err := ws.Send(request); err != nil {
+			t.Fatal(err)
+		}
+		if response := receive(t, ws, nil); response.ID != request.ID || response.Type != handlers.WSTypeError {
+			t.Errorf("got reply %+v to %+v, want an error", response, request)
+		}
+	}
+}
+
+func TestWebSocketScope(t *testing.T) {
+	t.Parallel()
+
+	fake := useFakeAudio(t)
+	c := newClient(t, handlers.ScopeRead, handlers.Backends{Audio: fake})
+	ws, err := c.WebSocket(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	// Read clients may query but not change devices.
+	if err := ws.Send(handlers.WSRequest{ID: "1", Type: handlers.WSTypeQuery, Query: handlers.EventAudioInputs}); err != nil {
+		t.Fatal(err)
+	}
+	if response := receive(t, ws, nil); response.Type != handlers.WSTypeResult {
+		t.Errorf("got reply %+v to a query, want a result", response)
+	}
+	for _, requestType := range []string{handlers.WSTypeActions, handlers.WSTypeStreamActions, handlers.WSTypeCardActions} {
+		if err := ws.Send(handlers.WSRequest{ID: requestType, Type: requestType, Actions: json.RawMessage(`[]`)}); err != nil {
+			t.Fatal(err)
+		}
+		if response := receive(t, ws, nil); response.ID != requestType || response.Type != handlers.WSTypeError || response.Error != "Forbidden" {
+			t.Errorf("got reply %+v to %s, want Forbidden", response, requestType)
+		}
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Errorf("got calls %q, want none", calls)
+	}
+
+	// Clients without a scope do not get a connection at all.
+	_, err = newClient(t, handlers.ScopeNone, handlers.Backends{Audio: fake}).WebSocket(context.Background())
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got error %v opening a WebSocket without a scope, want 401", err)
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	t.Parallel()
+
+	backends := handlers.Backends{Audio: useFakeAudio(t)}
+	server := serve(t, handlers.ScopeRead, handlers.NewServer(backends, handlers.WithWebSocketOrigins("http://localhost:3000/")))
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := serverURL.Port()
+
+	tests := []struct {
+		name   string
+		origin string
+		host   string
+		status int
+	}{
+		{"no origin", "", "", http.StatusSwitchingProtocols},
+		{"same loopback origin", "http://127.0.0.1:" + port, "", http.StatusSwitchingProtocols},
+		{"localhost", "http://localhost:" + port, "localhost:" + port, http.StatusSwitchingProtocols},
+		{"configured origin", "http://localhost:3000", "", http.StatusSwitchingProtocols},
+		{"cross-site", "https://attacker.example", "", http.StatusForbidden},
+		{"DNS rebinding", "http://attacker.example:" + port, "attacker.example:" + port, http.StatusForbidden},
+		{"other loopback port", "http://127.0.0.1:1", "", http.StatusForbidden},
+		{"mismatched host", "http://127.0.0.1:" + port, "attacker.example:" + port, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		request, err := http.NewRequest(http.MethodGet, server.URL+"/ws", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.origin != "" {
+			request.Header.Set("Origin", test.origin)
+		}
+		if test.host != "" {
+			request.Host = test.host
+		}
+		request.Header.Set("Connection", "Upgrade")
+		request.Header.Set("Upgrade", "websocket")
+		request.Header.Set("Sec-WebSocket-Version", "13")
+		request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+
+		resp, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: got status %d, want %d", test.name, resp.StatusCode, test.status)
+		}
+	}
+}
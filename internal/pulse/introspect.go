@@ -0,0 +1,507 @@
+package pulse
+
+import "strconv"
+
+// VolumeNorm is the volume of 100% (PA_VOLUME_NORM).
+const VolumeNorm = 0x10000
+
+// Port availability (pa_port_available_t), the plugged state of jack-detected ports.
+const (
+	PortAvailableUnknown = 0
+	PortAvailableNo      = 1
+	PortAvailableYes     = 2
+)
+
+// Facility is the kind of object a subscription event is about.
+type Facility uint32
+
+// Facilities of subscription events.
+const (
+	FacilitySink         Facility = 0
+	FacilitySource       Facility = 1
+	FacilitySinkInput    Facility = 2
+	FacilitySourceOutput Facility = 3
+	FacilityModule       Facility = 4
+	FacilityClient       Facility = 5
+	FacilitySampleCache  Facility = 6
+	FacilityServer       Facility = 7
+	FacilityCard         Facility = 9
+
+	facilityMask = 0x0F
+)
+
+// EventType tells whether an object was added, changed or removed.
+type EventType uint32
+
+// Types of subscription events.
+const (
+	EventNew    EventType = 0x00
+	EventChange EventType = 0x10
+	EventRemove EventType = 0x20
+
+	eventTypeMask = 0x30
+
+	// subscriptionMaskAll subscribes to the events of every facility.
+	subscriptionMaskAll = 0x02FF
+)
+
+// SubscriptionEvent reports a change of a server object.
+type SubscriptionEvent struct {
+	Facility Facility
+	Type     EventType
+	Index    uint32
+}
+
+// ServerInfo describes the server and its default devices.
+type ServerInfo struct {
+	PackageName    string
+	PackageVersion string
+	UserName       string
+	HostName       string
+	DefaultSink    string
+	DefaultSource  string
+}
+
+// Port is an output or input of a device or card.
+type Port struct {
+	Name        string
+	Description string
+	Priority    uint32
+	Available   uint32   // PortAvailableUnknown, PortAvailableNo or PortAvailableYes
+	Type        uint32   // pa_device_port_type_t, from protocol version 34
+	Profiles    []string // card profiles providing the port, only set for card ports
+}
+
+// Device is a sink or a source.
+type Device struct {
+	Index       uint32
+	Name        string
+	Description string
+	Driver      string
+	ChannelMap  []uint8
+	Volume      []uint32
+	Mute        bool
+	Card        uint32
+	Properties  map[string]string
+	Ports       []Port
+	ActivePort  string
+}
+
+// Stream is a sink input (playback) or source output (recording) of an application.
+type Stream struct {
+	Index      uint32
+	Name       string
+	Client     uint32
+	Device     uint32 // sink or source index
+	ChannelMap []uint8
+	Volume     []uint32
+	Mute       bool
+	Corked     bool
+	Properties map[string]string
+}
+
+// Profile is a configuration of a card.
+type Profile struct {
+	Name        string
+	Description string
+	Sinks       uint32
+	Sources     uint32
+	Priority    uint32
+	Available   bool
+}
+
+// Card is a sound card.
+type Card struct {
+	Index         uint32
+	Name          string
+	Driver        string
+	Profiles      []Profile
+	ActiveProfile string
+	Properties    map[string]string
+	Ports         []Port
+}
+
+// channelNames are the names of channel positions, as in pa_channel_position_to_string.
+var channelNames = []string{
+	"mono", "front-left", "front-right", "front-center", "rear-center", "rear-left",
+	"rear-right", "lfe", "front-left-of-center", "front-right-of-center", "side-left", "side-right",
+}
+
+// topChannelNames continue channelNames after the 32 auxiliary channels.
+var topChannelNames = []string{
+	"top-center", "top-front-left", "top-front-right", "top-front-center",
+	"top-rear-left", "top-rear-right", "top-rear-center",
+}
+
+// ChannelName returns the name of a channel position, e.g. "front-left".
+func ChannelName(position uint8) string {
+	switch {
+	case int(position) < len(channelNames):
+		return channelNames[position]
+	case position < 44:
+		return "aux" + strconv.Itoa(int(position)-len(channelNames))
+	case int(position)-44 < len(topChannelNames):
+		return topChannelNames[position-44]
+	default:
+		return "invalid"
+	}
+}
+
+// portTypes are the names of port types as printed by pactl.
+var portTypes = []string{
+	"Unknown", "Aux", "Speaker", "Headphones", "Line", "Mic", "Headset", "Handset",
+	"Earpiece", "SPDIF", "HDMI", "TV", "Radio", "Video", "USB", "Bluetooth", "Portable",
+	"Handsfree", "Car", "HiFi", "Phone", "Network", "Analog",
+}
+
+// PortTypeName returns the name of a port type, e.g. "Headphones".
+func PortTypeName(portType uint32) string {
+	if int(portType) < len(portTypes) {
+		return portTypes[portType]
+	}
+	return "Unknown"
+}
+
+// ServerInfo returns the server information, including the default sink and source.
+func (c *Client) ServerInfo() (ServerInfo, error) {
+	r, err := c.request(commandGetServerInfo, nil)
+	if err != nil {
+		return ServerInfo{}, err
+	}
+
+	info := ServerInfo{
+		PackageName:    r.string(),
+		PackageVersion: r.string(),
+		UserName:       r.string(),
+		HostName:       r.string(),
+	}
+	r.sampleSpec()
+	info.DefaultSink = r.string()
+	info.DefaultSource = r.string()
+	return info, r.err
+}
+
+// Sinks lists the sinks.
+func (c *Client) Sinks() ([]Device, error) {
+	return c.devices(commandGetSinkInfoList, true)
+}
+
+// Sources lists the sources, including monitors of sinks.
+func (c *Client) Sources() ([]Device, error) {
+	return c.devices(commandGetSourceInfoList, false)
+}
+
+// devices lists sinks or sources, whose replies only differ in their monitor and format fields.
+func (c *Client) devices(command uint32, sink bool) ([]Device, error) {
+	r, err := c.request(command, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []Device
+	for !r.eof() {
+		device := Device{
+			Index:       r.u32(),
+			Name:        r.string(),
+			Description: r.string(),
+		}
+		r.sampleSpec()
+		device.ChannelMap = r.channelMap()
+		r.u32() // owner module
+		device.Volume = r.cvolume()
+		device.Mute = r.boolean()
+		r.u32()    // monitor source, or monitored sink
+		r.string() // its name
+		r.u64()    // latency
+		device.Driver = r.string()
+		r.u32() // flags
+		device.Properties = r.propList()
+		r.u64()    // configured latency
+		r.volume() // base volume
+		r.u32()    // state
+		r.u32()    // volume steps
+		device.Card = r.u32()
+		device.Ports = c.readPorts(r, r.u32(), false)
+		device.ActivePort = r.string()
+
+		formats := c.version >= 21
+		if !sink {
+			formats = c.version >= 22
+		}
+		if formats {
+			for range r.u8() {
+				r.formatInfo()
+			}
+		}
+
+		if r.err != nil {
+			return nil, r.err
+		}
+		devices = append(devices, device)
+	}
+	return devices, r.err
+}
+
+// readPorts reads the ports of a device or, with card set, of a card.
+func (c *Client) readPorts(r *tagReader, n uint32, card bool) []Port {
+	var ports []Port
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		port := Port{
+			Name:        r.string(),
+			Description: r.string(),
+			Priority:    r.u32(),
+		}
+		if card || c.version >= 24 {
+			port.Available = r.u32()
+		}
+		if card {
+			r.u8() // direction
+			r.propList()
+			for range r.u32() {
+				port.Profiles = append(port.Profiles, r.string())
+				if r.err != nil {
+					break
+				}
+			}
+			if c.version >= 27 {
+				r.u64() // latency offset
+			}
+		}
+		if c.version >= 34 {
+			r.string() // availability group
+			port.Type = r.u32()
+		}
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+// SinkInputs lists the playback streams.
+func (c *Client) SinkInputs() ([]Stream, error) {
+	r, err := c.request(commandGetSinkInputList, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var streams []Stream
+	for !r.eof() {
+		stream := Stream{
+			Index: r.u32(),
+			Name:  r.string(),
+		}
+		r.u32() // owner module
+		stream.Client = r.u32()
+		stream.Device = r.u32()
+		r.sampleSpec()
+		stream.ChannelMap = r.channelMap()
+		stream.Volume = r.cvolume()
+		r.u64()    // buffer latency
+		r.u64()    // sink latency
+		r.string() // resample method
+		r.string() // driver
+		stream.Mute = r.boolean()
+		stream.Properties = r.propList()
+		if c.version >= 19 {
+			stream.Corked = r.boolean()
+		}
+		if c.version >= 20 {
+			r.boolean() // has volume
+			r.boolean() // volume writable
+		}
+		if c.version >= 21 {
+			r.formatInfo()
+		}
+
+		if r.err != nil {
+			return nil, r.err
+		}
+		streams = append(streams, stream)
+	}
+	return streams, r.err
+}
+
+// SourceOutputs lists the recording streams.
+func (c *Client) SourceOutputs() ([]Stream, error) {
+	r, err := c.request(commandGetSourceOutputList, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var streams []Stream
+	for !r.eof() {
+		stream := Stream{
+			Index: r.u32(),
+			Name:  r.string(),
+		}
+		r.u32() // owner module
+		stream.Client = r.u32()
+		stream.Device = r.u32()
+		r.sampleSpec()
+		stream.ChannelMap = r.channelMap()
+		r.u64()    // buffer latency
+		r.u64()    // source latency
+		r.string() // resample method
+		r.string() // driver
+		stream.Properties = r.propList()
+		if c.version >= 19 {
+			stream.Corked = r.boolean()
+		}
+		if c.version >= 22 {
+			stream.Volume = r.cvolume()
+			stream.Mute = r.boolean()
+			r.boolean() // has volume
+			r.boolean() // volume writable
+			r.formatInfo()
+		}
+
+		if r.err != nil {
+			return nil, r.err
+		}
+		streams = append(streams, stream)
+	}
+	return streams, r.err
+}
+
+// Cards lists the sound cards.
+func (c *Client) Cards() ([]Card, error) {
+	r, err := c.request(commandGetCardInfoList, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var cards []Card
+	for !r.eof() {
+		card := Card{Index: r.u32(), Name: r.string()}
+		r.u32() // owner module
+		card.Driver = r.string()
+
+		for range r.u32() {
+			profile := Profile{
+				Name:        r.string(),
+				Description: r.string(),
+				Sinks:       r.u32(),
+				Sources:     r.u32(),
+				Priority:    r.u32(),
+				Available:   true,
+			}
+			if c.version >= 29 {
+				profile.Available = r.u32() != 0
+			}
+			if r.err != nil {
+				return nil, r.err
+			}
+			card.Profiles = append(card.Profiles, profile)
+		}
+		card.ActiveProfile = r.string()
+		card.Properties = r.propList()
+		if c.version >= 26 {
+			card.Ports = c.readPorts(r, r.u32(), true)
+		}
+
+		if r.err != nil {
+			return nil, r.err
+		}
+		cards = append(cards, card)
+	}
+	return cards, r.err
+}
+
+// SetSinkVolume sets the per-channel volume of a sink, by name.
+func (c *Client) SetSinkVolume(name string, volume []uint32) error {
+	_, err := c.request(commandSetSinkVolume, new(tagWriter).u32(invalidIndex).string(name).cvolume(volume))
+	return err
+}
+
+// SetSourceVolume sets the per-channel volume of a source, by name.
+func (c *Client) SetSourceVolume(name string, volume []uint32) error {
+	_, err := c.request(commandSetSourceVolume, new(tagWriter).u32(invalidIndex).string(name).cvolume(volume))
+	return err
+}
+
+// SetSinkInputVolume sets the per-channel volume of a playback stream.
+func (c *Client) SetSinkInputVolume(index uint32, volume []uint32) error {
+	_, err := c.request(commandSetSinkInputVolume, new(tagWriter).u32(index).cvolume(volume))
+	return err
+}
+
+// SetSourceOutputVolume sets the per-channel volume of a recording stream.
+func (c *Client) SetSourceOutputVolume(index uint32, volume []uint32) error {
+	_, err := c.request(commandSetSourceOutputVolume, new(tagWriter).u32(index).cvolume(volume))
+	return err
+}
+
+// SetSinkMute mutes or unmutes a sink, by name.
+func (c *Client) SetSinkMute(name string, mute bool) error {
+	_, err := c.request(commandSetSinkMute, new(tagWriter).u32(invalidIndex).string(name).boolean(mute))
+	return err
+}
+
+// SetSourceMute mutes or unmutes a source, by name.
+func (c *Client) SetSourceMute(name string, mute bool) error {
+	_, err := c.request(commandSetSourceMute, new(tagWriter).u32(invalidIndex).string(name).boolean(mute))
+	return err
+}
+
+// SetSinkInputMute mutes or unmutes a playback stream.
+func (c *Client) SetSinkInputMute(index uint32, mute bool) error {
+	_, err := c.request(commandSetSinkInputMute, new(tagWriter).u32(index).boolean(mute))
+	return err
+}
+
+// SetSourceOutputMute mutes or unmutes a recording stream.
+func (c *Client) SetSourceOutputMute(index uint32, mute bool) error {
+	_, err := c.request(commandSetSourceOutputMute, new(tagWriter).u32(index).boolean(mute))
+	return err
+}
+
+// SetDefaultSink makes a sink the default one.
+func (c *Client) SetDefaultSink(name string) error {
+	_, err := c.request(commandSetDefaultSink, new(tagWriter).string(name))
+	return err
+}
+
+// SetDefaultSource makes a source the default one.
+func (c *Client) SetDefaultSource(name string) error {
+	_, err := c.request(commandSetDefaultSource, new(tagWriter).string(name))
+	return err
+}
+
+// SetSinkPort switches the active port of a sink.
+func (c *Client) SetSinkPort(name, port string) error {
+	_, err := c.request(commandSetSinkPort, new(tagWriter).u32(invalidIndex).string(name).string(port))
+	return err
+}
+
+// SetSourcePort switches the active port of a source.
+func (c *Client) SetSourcePort(name, port string) error {
+	_, err := c.request(commandSetSourcePort, new(tagWriter).u32(invalidIndex).string(name).string(port))
+	return err
+}
+
+// SetCardProfile switches the active profile of a card.
+func (c *Client) SetCardProfile(name, profile string) error {
+	_, err := c.request(commandSetCardProfile, new(tagWriter).u32(invalidIndex).string(name).string(profile))
+	return err
+}
+
+// MoveSinkInput moves a playback stream to another sink.
+func (c *Client) MoveSinkInput(index uint32, sink string) error {
+	_, err := c.request(commandMoveSinkInput, new(tagWriter).u32(index).u32(invalidIndex).string(sink))
+	return err
+}
+
+// MoveSourceOutput moves a recording stream to another source.
+func (c *Client) MoveSourceOutput(index uint32, source string) error {
+	_, err := c.request(commandMoveSourceOutput, new(tagWriter).u32(index).u32(invalidIndex).string(source))
+	return err
+}
+
+// Subscribe asks the server for change events of every facility, which are
+// then delivered on the returned channel until the connection is closed. The
+// channel must be drained, as replies are not read while it is full.
+func (c *Client) Subscribe() (<-chan SubscriptionEvent, error) {
+	if _, err := c.request(commandSubscribe, new(tagWriter).u32(subscriptionMaskAll)); err != nil {
+		return nil, err
+	}
+	return c.events, nil
+}
@@ -0,0 +1,339 @@
+// Package pulse is a client for the PulseAudio native protocol, also served by
+// pipewire-pulse, covering the introspection, control and subscription
+// commands used by deviceapi.
+package pulse
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Commands of the native protocol.
+const (
+	commandError                 = 0
+	commandReply                 = 2
+	commandAuth                  = 8
+	commandSetClientName         = 9
+	commandGetServerInfo         = 20
+	commandGetSinkInfoList       = 22
+	commandGetSourceInfoList     = 24
+	commandGetSinkInputList      = 30
+	commandGetSourceOutputList   = 32
+	commandSubscribe             = 35
+	commandSetSinkVolume         = 36
+	commandSetSinkInputVolume    = 37
+	commandSetSourceVolume       = 38
+	commandSetSinkMute           = 39
+	commandSetSourceMute         = 40
+	commandSetDefaultSink        = 44
+	commandSetDefaultSource      = 45
+	commandSubscribeEvent        = 66
+	commandMoveSinkInput         = 67
+	commandMoveSourceOutput      = 68
+	commandSetSinkInputMute      = 69
+	commandGetCardInfoList       = 89
+	commandSetCardProfile        = 90
+	commandSetSinkPort           = 96
+	commandSetSourcePort         = 97
+	commandSetSourceOutputVolume = 98
+	commandSetSourceOutputMute   = 99
+)
+
+const (
+	// protocolVersion is the highest protocol version this client understands.
+	protocolVersion = 34
+
+	// minProtocolVersion is the first version with property lists, which the
+	// introspection replies are parsed with.
+	minProtocolVersion = 16
+
+	// controlChannel is the channel of command packets, as opposed to audio data.
+	controlChannel = 0xFFFFFFFF
+
+	// invalidIndex asks the server to look an object up by name.
+	invalidIndex = 0xFFFFFFFF
+
+	headerSize    = 20
+	maxPacketSize = 16 << 20
+	cookieSize    = 256
+
+	// requestTimeout bounds how long a command waits for its reply.
+	requestTimeout = 5 * time.Second
+)
+
+// ErrClosed is returned by requests on a closed connection.
+var ErrClosed = errors.New("pulse: connection closed")
+
+// Error is an error code returned by the server.
+type Error struct {
+	Code uint32
+}
+
+// errorMessages are the messages of the server error codes, as in pa_strerror.
+var errorMessages = []string{
+	"OK", "Access denied", "Unknown command", "Invalid argument", "Entity exists",
+	"No such entity", "Connection refused", "Protocol error", "Timeout",
+	"No authentication key", "Internal error", "Connection terminated", "Entity killed",
+	"Invalid server", "Module initialization failed", "Bad state", "No data",
+	"Incompatible protocol version", "Too large", "Not supported", "Unknown error code",
+	"No such extension", "Obsolete functionality", "Missing implementation",
+	"Client forked", "Input/Output error", "Device or resource busy",
+}
+
+func (e *Error) Error() string {
+	if int(e.Code) < len(errorMessages) {
+		return "pulse: " + errorMessages[e.Code]
+	}
+	return fmt.Sprintf("pulse: error %d", e.Code)
+}
+
+// reply is the payload of a REPLY or ERROR packet.
+type reply struct {
+	data *tagReader
+	err  error
+}
+
+// Client is a connection to a PulseAudio server. It is safe for concurrent use.
+type Client struct {
+	conn    net.Conn
+	version uint32
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextTag uint32
+	pending map[uint32]chan reply
+	events  chan SubscriptionEvent
+	done    chan struct{}
+	err     error
+}
+
+// DefaultSocket returns the socket of the user's server: $PULSE_SERVER when it
+// names a unix socket, else pulse/native in the runtime directory.
+func DefaultSocket() string {
+	for _, server := range strings.Fields(os.Getenv("PULSE_SERVER")) {
+		if path, ok := strings.CutPrefix(server, "unix:"); ok {
+			return path
+		}
+		if strings.HasPrefix(server, "/") {
+			return server
+		}
+	}
+
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir == "" {
+		runtimeDir = "/run/user/" + strconv.Itoa(os.Getuid())
+	}
+	return filepath.Join(runtimeDir, "pulse", "native")
+}
+
+// readCookie returns the authentication cookie of the user. Servers without
+// cookie authentication, like pipewire-pulse, accept an empty one.
+func readCookie() []byte {
+	var paths []string
+	if path := os.Getenv("PULSE_COOKIE"); path != "" {
+		paths = append(paths, path)
+	}
+	if configDir, err := os.UserConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(configDir, "pulse", "cookie"))
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".pulse-cookie"))
+	}
+
+	for _, path := range paths {
+		if cookie, err := os.ReadFile(path); err == nil && len(cookie) == cookieSize {
+			return cookie
+		}
+	}
+	return make([]byte, cookieSize)
+}
+
+// Dial connects to the server listening on a unix socket and authenticates.
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("pulse: failed to connect to %s: %w", path, err)
+	}
+
+	c := &Client{
+		conn:    conn,
+		pending: make(map[uint32]chan reply),
+		events:  make(chan SubscriptionEvent, 64),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+
+	r, err := c.request(commandAuth, new(tagWriter).u32(protocolVersion).arbitrary(readCookie()))
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("pulse: authentication failed: %w", err)
+	}
+	c.version = min(r.u32()&0xFFFF, protocolVersion)
+	if r.err != nil {
+		c.Close()
+		return nil, r.err
+	}
+	if c.version < minProtocolVersion {
+		c.Close()
+		return nil, fmt.Errorf("pulse: server protocol version %d is too old", c.version)
+	}
+
+	name := new(tagWriter).propList(map[string]string{
+		"application.name":       "sysutil",
+		"application.process.id": strconv.Itoa(os.Getpid()),
+	})
+	if _, err := c.request(commandSetClientName, name); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("pulse: failed to set client name: %w", err)
+	}
+
+	return c, nil
+}
+
+// Version returns the negotiated protocol version.
+func (c *Client) Version() uint32 {
+	return c.version
+}
+
+// Close closes the connection, failing pending requests.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Done is closed when the connection is lost or closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// readLoop dispatches incoming packets until the connection fails.
+func (c *Client) readLoop() {
+	err := c.readPackets()
+
+	c.mu.Lock()
+	c.err = err
+	for tag, ch := range c.pending {
+		ch <- reply{err: err}
+		delete(c.pending, tag)
+	}
+	c.mu.Unlock()
+
+	close(c.done)
+	c.conn.Close()
+}
+
+// readPackets reads packets and routes replies to their requests and
+// subscription events to the events channel.
+func (c *Client) readPackets() error {
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(c.conn, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				return ErrClosed
+			}
+			return fmt.Errorf("pulse: read failed: %w", err)
+		}
+
+		length := binary.BigEndian.Uint32(header[0:4])
+		channel := binary.BigEndian.Uint32(header[4:8])
+		if length > maxPacketSize {
+			return fmt.Errorf("pulse: packet of %d bytes too large", length)
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.conn, payload); err != nil {
+			return fmt.Errorf("pulse: read failed: %w", err)
+		}
+		if channel != controlChannel {
+			continue
+		}
+
+		r := &tagReader{data: payload}
+		command := r.u32()
+		tag := r.u32()
+		if r.err != nil {
+			return r.err
+		}
+
+		switch command {
+		case commandReply, commandError:
+			response := reply{data: r}
+			if command == commandError {
+				response = reply{err: &Error{Code: r.u32()}}
+			}
+			c.mu.Lock()
+			ch, ok := c.pending[tag]
+			delete(c.pending, tag)
+			c.mu.Unlock()
+			if ok {
+				ch <- response
+			}
+
+		case commandSubscribeEvent:
+			event := r.u32()
+			index := r.u32()
+			if r.err != nil {
+				return r.err
+			}
+			c.events <- SubscriptionEvent{
+				Facility: Facility(event & facilityMask),
+				Type:     EventType(event & eventTypeMask),
+				Index:    index,
+			}
+		}
+	}
+}
+
+// request sends a command and waits for its reply.
+func (c *Client) request(command uint32, args *tagWriter) (*tagReader, error) {
+	ch := make(chan reply, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	tag := c.nextTag
+	c.nextTag++
+	c.pending[tag] = ch
+	c.mu.Unlock()
+
+	payload := new(tagWriter).u32(command).u32(tag)
+	if args != nil {
+		payload.buf = append(payload.buf, args.buf...)
+	}
+
+	packet := make([]byte, headerSize, headerSize+len(payload.buf))
+	binary.BigEndian.PutUint32(packet[0:4], uint32(len(payload.buf)))
+	binary.BigEndian.PutUint32(packet[4:8], controlChannel)
+	packet = append(packet, payload.buf...)
+
+	c.writeMu.Lock()
+	c.conn.SetWriteDeadline(time.Now().Add(requestTimeout))
+	_, err := c.conn.Write(packet)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.conn.Close()
+		return nil, fmt.Errorf("pulse: write failed: %w", err)
+	}
+
+	timer := time.NewTimer(requestTimeout)
+	defer timer.Stop()
+	select {
+	case response := <-ch:
+		return response.data, response.err
+	case <-timer.C:
+		c.mu.Lock()
+		delete(c.pending, tag)
+		c.mu.Unlock()
+		return nil, fmt.Errorf("pulse: command %d timed out", command)
+	}
+}
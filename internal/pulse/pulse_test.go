@@ -0,0 +1,338 @@
+package pulse
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeServer answers the commands of a client with the payloads in replies, by
+// command, and a "No such entity" error for the others. The testdata replies
+// follow a pipewire-pulse server speaking protocol version 34.
+type fakeServer struct {
+	replies  map[uint32][]byte
+	commands chan []byte // arguments of the commands without a reply
+}
+
+// startServer listens on a unix socket and serves a single client.
+func startServer(t *testing.T, replies map[uint32][]byte) (*fakeServer, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "native")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakeServer{replies: replies, commands: make(chan []byte, 16)}
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		accepted <- conn
+		server.serve(conn)
+	}()
+	t.Cleanup(func() {
+		select {
+		case conn := <-accepted:
+			conn.Close()
+		default:
+		}
+	})
+	return server, path
+}
+
+// testdata reads a reply fixture.
+func testdata(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// serve answers packets until the connection is closed.
+func (s *fakeServer) serve(conn net.Conn) {
+	header := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			return
+		}
+		r := &tagReader{data: payload}
+		command, tag := r.u32(), r.u32()
+
+		response := new(tagWriter).u32(commandReply).u32(tag)
+		switch reply, ok := s.replies[command]; {
+		case command == commandAuth:
+			response.u32(35)
+		case command == commandSetClientName:
+			response.u32(74)
+		case ok:
+			response.buf = append(response.buf, reply...)
+		case command == commandSubscribe:
+			s.commands <- r.data
+			// A change of the card 47 arrives before the reply.
+			s.write(conn, new(tagWriter).u32(commandSubscribeEvent).u32(invalidIndex).u32(uint32(FacilityCard)|uint32(EventChange)).u32(47))
+		default:
+			s.commands <- r.data
+			response = new(tagWriter).u32(commandError).u32(tag).u32(5)
+		}
+		s.write(conn, response)
+	}
+}
+
+// write sends a packet on the control channel.
+func (s *fakeServer) write(conn net.Conn, payload *tagWriter) {
+	packet := binary.BigEndian.AppendUint32(nil, uint32(len(payload.buf)))
+	packet = binary.BigEndian.AppendUint32(packet, controlChannel)
+	packet = append(packet, make([]byte, headerSize-8)...)
+	conn.Write(append(packet, payload.buf...))
+}
+
+// dial connects a client to a fake server.
+func dial(t *testing.T, replies map[uint32][]byte) (*Client, *fakeServer) {
+	t.Helper()
+
+	server, path := startServer(t, replies)
+	c, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, server
+}
+
+func TestDial(t *testing.T) {
+	c, _ := dial(t, nil)
+	if c.Version() != protocolVersion {
+		t.Errorf("got version %d, want %d, the highest one of the client", c.Version(), protocolVersion)
+	}
+
+	c.Close()
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("connection not done after Close")
+	}
+	if _, err := c.ServerInfo(); !errors.Is(err, ErrClosed) {
+		t.Errorf("got error %v after Close, want ErrClosed", err)
+	}
+}
+
+func TestServerInfo(t *testing.T) {
+	c, _ := dial(t, map[uint32][]byte{commandGetServerInfo: testdata(t, "server_info.bin")})
+
+	info, err := c.ServerInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ServerInfo{
+		PackageName:    "pulseaudio",
+		PackageVersion: "15.0.0 (PipeWire 1.0.5)",
+		UserName:       "alice",
+		HostName:       "laptop",
+		DefaultSink:    "alsa_output.pci-0000_00_1f.3.analog-stereo",
+		DefaultSource:  "alsa_input.pci-0000_00_1f.3.analog-stereo",
+	}
+	if info != want {
+		t.Errorf("got %+v, want %+v", info, want)
+	}
+}
+
+func TestSinks(t *testing.T) {
+	c, _ := dial(t, map[uint32][]byte{commandGetSinkInfoList: testdata(t, "sink_info_list.bin")})
+
+	sinks, err := c.Sinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Device{
+		{
+			Index:       52,
+			Name:        "alsa_output.pci-0000_00_1f.3.analog-stereo",
+			Description: "Built-in Audio Analog Stereo",
+			Driver:      "PipeWire",
+			ChannelMap:  []uint8{1, 2},
+			Volume:      []uint32{42598, 39322},
+			Card:        47,
+			Properties:  map[string]string{"device.description": "Built-in Audio Analog Stereo", "alsa.card": "0", "device.api": "alsa"},
+			Ports: []Port{
+				{Name: "analog-output-speaker", Description: "Speakers", Priority: 100, Available: PortAvailableUnknown, Type: 2},
+				{Name: "analog-output-headphones", Description: "Headphones", Priority: 200, Available: PortAvailableNo, Type: 3},
+			},
+			ActivePort: "analog-output-speaker",
+		},
+		{
+			Index:       61,
+			Name:        "bluez_output.AC_80_0A_2E_31_5D.1",
+			Description: "WH-1000XM4",
+			Driver:      "PipeWire",
+			ChannelMap:  []uint8{1, 2},
+			Volume:      []uint32{VolumeNorm, VolumeNorm},
+			Mute:        true,
+			Card:        58,
+			Properties:  map[string]string{"device.description": "WH-1000XM4", "device.api": "bluez5"},
+		},
+	}
+	if !reflect.DeepEqual(sinks, want) {
+		t.Errorf("got sinks\n%+v\nwant\n%+v", sinks, want)
+	}
+}
+
+func TestSinkInputs(t *testing.T) {
+	c, _ := dial(t, map[uint32][]byte{commandGetSinkInputList: testdata(t, "sink_input_list.bin")})
+
+	streams, err := c.SinkInputs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Stream{{
+		Index:      87,
+		Name:       "Playback",
+		Client:     74,
+		Device:     52,
+		ChannelMap: []uint8{1, 2},
+		Volume:     []uint32{VolumeNorm / 2, VolumeNorm / 2},
+		Properties: map[string]string{"application.name": "Firefox", "media.name": "Playback", "application.process.id": "4211"},
+	}}
+	if !reflect.DeepEqual(streams, want) {
+		t.Errorf("got streams\n%+v\nwant\n%+v", streams, want)
+	}
+}
+
+func TestCards(t *testing.T) {
+	c, _ := dial(t, map[uint32][]byte{commandGetCardInfoList: testdata(t, "card_info_list.bin")})
+
+	cards, err := c.Cards()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cards) != 1 {
+		t.Fatalf("got %d cards, want 1", len(cards))
+	}
+	card := cards[0]
+	if card.Index != 47 || card.Name != "alsa_card.pci-0000_00_1f.3" || card.Driver != "alsa" || card.Properties["device.description"] != "Built-in Audio" {
+		t.Errorf("got card %+v, want the built-in audio", card)
+	}
+	wantProfiles := []Profile{
+		{Name: "off", Description: "Off", Available: true},
+		{Name: "output:analog-stereo+input:analog-stereo", Description: "Analog Stereo Duplex", Sinks: 1, Sources: 1, Priority: 6565, Available: true},
+		{Name: "output:hdmi-stereo", Description: "Digital Stereo (HDMI) Output", Sinks: 1, Priority: 5900},
+	}
+	if !slices.Equal(card.Profiles, wantProfiles) || card.ActiveProfile != "output:analog-stereo+input:analog-stereo" {
+		t.Errorf("got profiles %+v with %s active, want %+v with the duplex one", card.Profiles, card.ActiveProfile, wantProfiles)
+	}
+	duplex := []string{"output:analog-stereo+input:analog-stereo"}
+	wantPorts := []Port{
+		{Name: "analog-output-speaker", Description: "Speakers", Priority: 100, Available: PortAvailableUnknown, Type: 2, Profiles: duplex},
+		{Name: "analog-output-headphones", Description: "Headphones", Priority: 200, Available: PortAvailableNo, Type: 3, Profiles: duplex},
+	}
+	if !reflect.DeepEqual(card.Ports, wantPorts) {
+		t.Errorf("got ports %+v, want %+v", card.Ports, wantPorts)
+	}
+}
+
+func TestOlderProtocol(t *testing.T) {
+	// Version 23 devices have neither port availability nor types, and no
+	// availability group is sent.
+	c := &Client{version: 23}
+	data := new(tagWriter).u32(1).string("analog-output").string("Analog Output").u32(9000)
+	data.buf = append(data.buf, tagString)
+	data.buf = append(data.buf, "next\x00"...)
+	r := &tagReader{data: data.buf}
+	ports := c.readPorts(r, r.u32(), false)
+	if want := []Port{{Name: "analog-output", Description: "Analog Output", Priority: 9000}}; !reflect.DeepEqual(ports, want) || r.string() != "next" {
+		t.Errorf("got ports %+v, want %+v followed by the rest of the reply", ports, want)
+	}
+}
+
+func TestMalformedReply(t *testing.T) {
+	// Cut in the middle of the properties of the first sink.
+	sinks := testdata(t, "sink_info_list.bin")
+	c, _ := dial(t, map[uint32][]byte{commandGetSinkInfoList: sinks[:200]})
+
+	if _, err := c.Sinks(); err == nil {
+		t.Error("got no error for a truncated reply")
+	}
+}
+
+func TestErrorReply(t *testing.T) {
+	c, server := dial(t, nil)
+
+	err := c.SetSinkMute("missing", true)
+	var pulseErr *Error
+	if !errors.As(err, &pulseErr) || pulseErr.Code != 5 || err.Error() != "pulse: No such entity" {
+		t.Fatalf("got error %v, want No such entity", err)
+	}
+	args := <-server.commands
+	if want := new(tagWriter).u32(invalidIndex).string("missing").boolean(true).buf; !slices.Equal(args, want) {
+		t.Errorf("got arguments % x, want % x", args, want)
+	}
+	if err := (&Error{Code: 99}).Error(); err != "pulse: error 99" {
+		t.Errorf("got message %q for an unknown code", err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	c, server := dial(t, nil)
+
+	events, err := c.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args := <-server.commands; !slices.Equal(args, new(tagWriter).u32(subscriptionMaskAll).buf) {
+		t.Errorf("got subscription arguments % x, want the mask of every facility", args)
+	}
+	select {
+	case event := <-events:
+		if want := (SubscriptionEvent{Facility: FacilityCard, Type: EventChange, Index: 47}); event != want {
+			t.Errorf("got event %+v, want %+v", event, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("got no event")
+	}
+}
+
+func TestDefaultSocket(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	for server, want := range map[string]string{
+		"":                                    "/run/user/1000/pulse/native",
+		"unix:/tmp/pulse.sock":                "/tmp/pulse.sock",
+		"tcp:localhost /var/run/pulse/native": "/var/run/pulse/native",
+		"tcp:localhost":                       "/run/user/1000/pulse/native",
+	} {
+		t.Setenv("PULSE_SERVER", server)
+		if got := DefaultSocket(); got != want {
+			t.Errorf("PULSE_SERVER=%q: got %s, want %s", server, got, want)
+		}
+	}
+}
+
+func TestChannelAndPortNames(t *testing.T) {
+	names := map[uint8]string{0: "mono", 1: "front-left", 11: "side-right", 12: "aux0", 43: "aux31", 44: "top-center", 50: "top-rear-center", 51: "invalid"}
+	for _, position := range slices.Sorted(maps.Keys(names)) {
+		if got := ChannelName(position); got != names[position] {
+			t.Errorf("got channel %d named %s, want %s", position, got, names[position])
+		}
+	}
+	if PortTypeName(3) != "Headphones" || PortTypeName(100) != "Unknown" {
+		t.Errorf("got port types %s and %s, want Headphones and Unknown", PortTypeName(3), PortTypeName(100))
+	}
+}
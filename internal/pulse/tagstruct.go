@@ -0,0 +1,273 @@
+package pulse
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Tags preceding each value of a tagstruct, the serialization of command arguments.
+const (
+	tagString        = 't'
+	tagStringNull    = 'N'
+	tagU32           = 'L'
+	tagU8            = 'B'
+	tagU64           = 'R'
+	tagS64           = 'r'
+	tagSampleSpec    = 'a'
+	tagArbitrary     = 'x'
+	tagBooleanTrue   = '1'
+	tagBooleanFalse  = '0'
+	tagTimeval       = 'T'
+	tagUsec          = 'U'
+	tagChannelMap    = 'm'
+	tagCVolume       = 'v'
+	tagPropList      = 'P'
+	tagVolume        = 'V'
+	tagFormatInfo    = 'f'
+	maxChannels      = 32
+	maxPropListItems = 1024
+)
+
+// tagWriter serializes command arguments.
+type tagWriter struct {
+	buf []byte
+}
+
+func (w *tagWriter) u32(v uint32) *tagWriter {
+	w.buf = append(w.buf, tagU32)
+	w.buf = binary.BigEndian.AppendUint32(w.buf, v)
+	return w
+}
+
+func (w *tagWriter) boolean(v bool) *tagWriter {
+	if v {
+		w.buf = append(w.buf, tagBooleanTrue)
+	} else {
+		w.buf = append(w.buf, tagBooleanFalse)
+	}
+	return w
+}
+
+// string writes s, or a null string when s is empty.
+func (w *tagWriter) string(s string) *tagWriter {
+	if s == "" {
+		w.buf = append(w.buf, tagStringNull)
+		return w
+	}
+	w.buf = append(w.buf, tagString)
+	w.buf = append(w.buf, s...)
+	w.buf = append(w.buf, 0)
+	return w
+}
+
+func (w *tagWriter) arbitrary(data []byte) *tagWriter {
+	w.buf = append(w.buf, tagArbitrary)
+	w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(len(data)))
+	w.buf = append(w.buf, data...)
+	return w
+}
+
+func (w *tagWriter) cvolume(volume []uint32) *tagWriter {
+	w.buf = append(w.buf, tagCVolume, byte(len(volume)))
+	for _, v := range volume {
+		w.buf = binary.BigEndian.AppendUint32(w.buf, v)
+	}
+	return w
+}
+
+// propList writes string properties, stored NUL terminated like pa_proplist_sets does.
+func (w *tagWriter) propList(props map[string]string) *tagWriter {
+	w.buf = append(w.buf, tagPropList)
+	for key, value := range props {
+		w.string(key)
+		w.u32(uint32(len(value) + 1))
+		w.arbitrary(append([]byte(value), 0))
+	}
+	w.buf = append(w.buf, tagStringNull)
+	return w
+}
+
+// tagReader parses a tagstruct. The first error is kept and every later read
+// returns zero values, so callers check err once after reading a whole structure.
+type tagReader struct {
+	data []byte
+	err  error
+}
+
+func (r *tagReader) fail(format string, args ...any) {
+	if r.err == nil {
+		r.err = fmt.Errorf("pulse: malformed reply: "+format, args...)
+	}
+}
+
+// take returns the next n bytes.
+func (r *tagReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.fail("truncated")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+// tag consumes the next tag, which must be one of the expected ones.
+func (r *tagReader) tag(expected ...byte) byte {
+	b := r.take(1)
+	if b == nil {
+		return 0
+	}
+	for _, tag := range expected {
+		if b[0] == tag {
+			return tag
+		}
+	}
+	r.fail("unexpected tag %q, expected %q", b[0], expected)
+	return 0
+}
+
+// eof reports whether all data has been read.
+func (r *tagReader) eof() bool {
+	return r.err != nil || len(r.data) == 0
+}
+
+func (r *tagReader) u32() uint32 {
+	if r.tag(tagU32) == 0 {
+		return 0
+	}
+	if b := r.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *tagReader) u8() uint8 {
+	if r.tag(tagU8) == 0 {
+		return 0
+	}
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *tagReader) u64() uint64 {
+	if r.tag(tagU64, tagS64, tagUsec) == 0 {
+		return 0
+	}
+	if b := r.take(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *tagReader) boolean() bool {
+	return r.tag(tagBooleanTrue, tagBooleanFalse) == tagBooleanTrue
+}
+
+// string reads a string, returning "" for a null string.
+func (r *tagReader) string() string {
+	if r.tag(tagString, tagStringNull) != tagString {
+		return ""
+	}
+	for i, c := range r.data {
+		if c == 0 {
+			s := string(r.data[:i])
+			r.data = r.data[i+1:]
+			return s
+		}
+	}
+	r.fail("unterminated string")
+	return ""
+}
+
+func (r *tagReader) arbitrary() []byte {
+	if r.tag(tagArbitrary) == 0 {
+		return nil
+	}
+	b := r.take(4)
+	if b == nil {
+		return nil
+	}
+	return r.take(int(binary.BigEndian.Uint32(b)))
+}
+
+// sampleSpec skips a sample specification, which deviceapi does not use.
+func (r *tagReader) sampleSpec() {
+	if r.tag(tagSampleSpec) != 0 {
+		r.take(6)
+	}
+}
+
+func (r *tagReader) channelMap() []uint8 {
+	if r.tag(tagChannelMap) == 0 {
+		return nil
+	}
+	n := r.take(1)
+	if n == nil || n[0] > maxChannels {
+		r.fail("invalid channel map")
+		return nil
+	}
+	return append([]uint8(nil), r.take(int(n[0]))...)
+}
+
+func (r *tagReader) cvolume() []uint32 {
+	if r.tag(tagCVolume) == 0 {
+		return nil
+	}
+	n := r.take(1)
+	if n == nil || n[0] > maxChannels {
+		r.fail("invalid volume")
+		return nil
+	}
+	volume := make([]uint32, n[0])
+	for i := range volume {
+		if b := r.take(4); b != nil {
+			volume[i] = binary.BigEndian.Uint32(b)
+		}
+	}
+	return volume
+}
+
+func (r *tagReader) volume() uint32 {
+	if r.tag(tagVolume) == 0 {
+		return 0
+	}
+	if b := r.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// propList reads a property list, dropping the NUL terminator of string values.
+func (r *tagReader) propList() map[string]string {
+	if r.tag(tagPropList) == 0 {
+		return nil
+	}
+	props := make(map[string]string)
+	for range maxPropListItems {
+		key := r.string()
+		if key == "" || r.err != nil {
+			return props
+		}
+		r.u32()
+		value := r.arbitrary()
+		if len(value) > 0 && value[len(value)-1] == 0 {
+			value = value[:len(value)-1]
+		}
+		props[key] = string(value)
+	}
+	r.fail("too many properties")
+	return props
+}
+
+// formatInfo skips a format description, which deviceapi does not use.
+func (r *tagReader) formatInfo() {
+	if r.tag(tagFormatInfo) != 0 {
+		r.u8()
+		r.propList()
+	}
+}
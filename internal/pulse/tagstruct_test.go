@@ -0,0 +1,141 @@
+package pulse
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTagWriter(t *testing.T) {
+	w := new(tagWriter).u32(0x01020304).string("hi").string("").boolean(true).boolean(false).cvolume([]uint32{VolumeNorm}).arbitrary([]byte{0xff})
+	want := []byte{
+		'L', 1, 2, 3, 4,
+		't', 'h', 'i', 0,
+		'N',
+		'1',
+		'0',
+		'v', 1, 0, 1, 0, 0,
+		'x', 0, 0, 0, 1, 0xff,
+	}
+	if !bytes.Equal(w.buf, want) {
+		t.Errorf("got % x, want % x", w.buf, want)
+	}
+
+	// Property values are NUL terminated and the list ends with a null string.
+	w = new(tagWriter).propList(map[string]string{"application.name": "sysutil"})
+	want = []byte("Pt" + "application.name\x00" + "L\x00\x00\x00\x08" + "x\x00\x00\x00\x08sysutil\x00" + "N")
+	if !bytes.Equal(w.buf, want) {
+		t.Errorf("got property list %q, want %q", w.buf, want)
+	}
+}
+
+func TestTagRoundTrip(t *testing.T) {
+	props := map[string]string{"application.name": "sysutil", "media.name": "", "application.process.id": "4211"}
+	w := new(tagWriter).
+		u32(invalidIndex).
+		string("alsa_output.pci-0000_00_1f.3.analog-stereo").
+		string("").
+		boolean(true).
+		boolean(false).
+		cvolume([]uint32{0, VolumeNorm, 3 * VolumeNorm / 2}).
+		arbitrary(bytes.Repeat([]byte{0xa5}, cookieSize)).
+		propList(props)
+
+	r := &tagReader{data: w.buf}
+	if got := r.u32(); got != invalidIndex {
+		t.Errorf("got u32 %#x, want %#x", got, invalidIndex)
+	}
+	if got := r.string(); got != "alsa_output.pci-0000_00_1f.3.analog-stereo" {
+		t.Errorf("got string %q", got)
+	}
+	if got := r.string(); got != "" {
+		t.Errorf("got null string %q, want empty", got)
+	}
+	if !r.boolean() || r.boolean() {
+		t.Error("got booleans mixed up, want true then false")
+	}
+	if got := r.cvolume(); !slices.Equal(got, []uint32{0, VolumeNorm, 3 * VolumeNorm / 2}) {
+		t.Errorf("got volume %v", got)
+	}
+	if got := r.arbitrary(); !bytes.Equal(got, bytes.Repeat([]byte{0xa5}, cookieSize)) {
+		t.Errorf("got %d arbitrary bytes, want the %d of the cookie", len(got), cookieSize)
+	}
+	if got := r.propList(); !maps.Equal(got, props) {
+		t.Errorf("got properties %v, want %v", got, props)
+	}
+	if !r.eof() || r.err != nil {
+		t.Errorf("got %d bytes left and error %v, want none", len(r.data), r.err)
+	}
+}
+
+func TestTagReaderReadOnly(t *testing.T) {
+	data := []byte{
+		'B', 7,
+		'R', 0, 0, 0, 0, 0, 0, 0x01, 0x00,
+		'r', 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		'U', 0, 0, 0, 0, 0, 0, 0x59, 0xd8,
+		'a', 3, 2, 0, 0, 0xbb, 0x80,
+		'm', 2, 1, 2,
+		'V', 0, 1, 0, 0,
+		'f', 'B', 1, 'P', 'N',
+	}
+	r := &tagReader{data: data}
+	if got := r.u8(); got != 7 {
+		t.Errorf("got u8 %d, want 7", got)
+	}
+	if got := r.u64(); got != 256 {
+		t.Errorf("got u64 %d, want 256", got)
+	}
+	if got := int64(r.u64()); got != -1 {
+		t.Errorf("got s64 %d, want -1", got)
+	}
+	if got := r.u64(); got != 23000 {
+		t.Errorf("got usec %d, want 23000", got)
+	}
+	r.sampleSpec()
+	if got := r.channelMap(); !slices.Equal(got, []uint8{1, 2}) {
+		t.Errorf("got channel map %v, want front-left and front-right", got)
+	}
+	if got := r.volume(); got != VolumeNorm {
+		t.Errorf("got volume %#x, want %#x", got, VolumeNorm)
+	}
+	r.formatInfo()
+	if !r.eof() || r.err != nil {
+		t.Errorf("got %d bytes left and error %v, want none", len(r.data), r.err)
+	}
+}
+
+func TestTagReaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		read func(r *tagReader)
+		err  string
+	}{
+		{"truncated", []byte{'L', 0, 0}, func(r *tagReader) { r.u32() }, "truncated"},
+		{"empty", nil, func(r *tagReader) { r.string() }, "truncated"},
+		{"wrong tag", []byte{'t', 'a', 0}, func(r *tagReader) { r.u32() }, `unexpected tag 't'`},
+		{"unterminated string", []byte{'t', 'a', 'b'}, func(r *tagReader) { r.string() }, "unterminated string"},
+		{"too many channels", []byte{'m', maxChannels + 1}, func(r *tagReader) { r.channelMap() }, "invalid channel map"},
+		{"too many volumes", []byte{'v', maxChannels + 1}, func(r *tagReader) { r.cvolume() }, "invalid volume"},
+		{"truncated arbitrary", []byte{'x', 0, 0, 1, 0, 0xff}, func(r *tagReader) { r.arbitrary() }, "truncated"},
+		{"unterminated property list", []byte{'P', 't', 'k', 0, 'L', 0, 0, 0, 1, 'x', 0, 0, 0, 1, 0}, func(r *tagReader) { r.propList() }, "truncated"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := &tagReader{data: test.data}
+			test.read(r)
+			if r.err == nil || !strings.Contains(r.err.Error(), test.err) {
+				t.Fatalf("got error %v, want %q", r.err, test.err)
+			}
+
+			// The first error sticks and later reads return zero values.
+			err := r.err
+			if r.u32() != 0 || r.string() != "" || r.boolean() || !r.eof() || r.err != err {
+				t.Errorf("got reads after the error %v, want zero values", err)
+			}
+		})
+	}
+}
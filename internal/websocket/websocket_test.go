@@ -0,0 +1,400 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testMask is the masking key of the examples in RFC 6455 section 5.7.
+var testMask = [4]byte{0x37, 0xfa, 0x21, 0x3d}
+
+// frame encodes a frame as a peer would send it, masked with testMask if mask is set.
+func frame(fin bool, opcode int, payload []byte, mask bool) []byte {
+	first := byte(opcode)
+	if fin {
+		first |= 0x80
+	}
+	maskBit := byte(0)
+	if mask {
+		maskBit = 0x80
+	}
+
+	out := []byte{first}
+	switch length := len(payload); {
+	case length <= 125:
+		out = append(out, maskBit|byte(length))
+	case length <= 0xffff:
+		out = append(out, maskBit|126)
+		out = binary.BigEndian.AppendUint16(out, uint16(length))
+	default:
+		out = append(out, maskBit|127)
+		out = binary.BigEndian.AppendUint64(out, uint64(length))
+	}
+	if !mask {
+		return append(out, payload...)
+	}
+	out = append(out, testMask[:]...)
+	for i, b := range payload {
+		out = append(out, b^testMask[i%4])
+	}
+	return out
+}
+
+// closePayload is the payload of a close frame.
+func closePayload(code int, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+}
+
+// exchange feeds input to a server connection, or a client one with client set,
+// reads a message from it and closes it. It returns the message, the frames the
+// connection sent back and the read error.
+func exchange(t *testing.T, client bool, input []byte) (int, []byte, [][]byte, error) {
+	t.Helper()
+
+	local, peer := net.Pipe()
+	conn := &Conn{conn: local, reader: bufio.NewReader(local), client: client}
+	go func() {
+		peer.Write(input)
+	}()
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(peer)
+		output <- data
+	}()
+
+	messageType, message, err := conn.ReadMessage()
+	conn.Close(CloseNormal, "")
+	return messageType, message, readFrames(t, <-output, client), err
+}
+
+// readFrames decodes the frames sent by a connection, masked if sent by a client.
+func readFrames(t *testing.T, data []byte, masked bool) [][]byte {
+	t.Helper()
+
+	// Clients read unmasked frames. The reader is closed so that it never replies.
+	reader := &Conn{reader: bufio.NewReader(bytes.NewReader(data)), client: !masked, closed: true}
+	var frames [][]byte
+	for {
+		fin, opcode, payload, err := reader.readFrame()
+		if errors.Is(err, io.EOF) {
+			return frames
+		}
+		if err != nil {
+			t.Fatalf("invalid frame sent: %v", err)
+		}
+		if !fin {
+			t.Fatalf("got a fragmented frame, want only final ones")
+		}
+		frames = append(frames, append([]byte{byte(opcode)}, payload...))
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// The example of RFC 6455 section 1.3.
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("got accept key %s, want s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", got)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	long := bytes.Repeat([]byte("a"), 300)
+	huge := bytes.Repeat([]byte("b"), 70000)
+	half := bytes.Repeat([]byte("c"), maxMessageSize/2+1)
+	normalClose := append([]byte{CloseMessage}, closePayload(CloseNormal, "")...)
+
+	tests := []struct {
+		name        string
+		client      bool
+		input       [][]byte
+		messageType int
+		message     []byte
+		err         error
+		sent        [][]byte // frames sent back, normalClose when omitted
+	}{
+		{
+			name: "masked text",
+			// The single-frame masked text message of RFC 6455 section 5.7.
+			input:       [][]byte{{0x81, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58}},
+			messageType: TextMessage,
+			message:     []byte("Hello"),
+		},
+		{
+			name:        "unmasked text to a client",
+			client:      true,
+			input:       [][]byte{{0x81, 0x05, 0x48, 0x65, 0x6c, 0x6c, 0x6f}},
+			messageType: TextMessage,
+			message:     []byte("Hello"),
+		},
+		{
+			name:        "binary with a 16 bit length",
+			input:       [][]byte{frame(true, BinaryMessage, long, true)},
+			messageType: BinaryMessage,
+			message:     long,
+		},
+		{
+			name:        "binary with a 64 bit length",
+			input:       [][]byte{frame(true, BinaryMessage, huge, true)},
+			messageType: BinaryMessage,
+			message:     huge,
+		},
+		{
+			name:        "empty",
+			input:       [][]byte{frame(true, TextMessage, nil, true)},
+			messageType: TextMessage,
+			message:     []byte{},
+		},
+		{
+			name: "fragmented with a ping in between",
+			input: [][]byte{
+				frame(false, TextMessage, []byte("Hel"), true),
+				frame(true, PingMessage, []byte("are you there"), true),
+				frame(false, continuationFrame, []byte("l"), true),
+				frame(true, PongMessage, nil, true),
+				frame(true, continuationFrame, []byte("o"), true),
+			},
+			messageType: TextMessage,
+			message:     []byte("Hello"),
+			sent:        [][]byte{append([]byte{PongMessage}, "are you there"...), normalClose},
+		},
+		{
+			name:  "close",
+			input: [][]byte{frame(true, CloseMessage, closePayload(CloseGoingAway, "bye"), true)},
+			err:   ErrClosed,
+			sent:  [][]byte{append([]byte{CloseMessage}, closePayload(CloseGoingAway, "")...)},
+		},
+		{
+			name:  "close without a status",
+			input: [][]byte{frame(true, CloseMessage, nil, true)},
+			err:   ErrClosed,
+		},
+		{
+			name:  "unmasked frame to a server",
+			input: [][]byte{frame(true, TextMessage, []byte("Hello"), false)},
+			sent:  [][]byte{append([]byte{CloseMessage}, closePayload(CloseProtocolError, "invalid masking")...)},
+		},
+		{
+			name:   "masked frame to a client",
+			client: true,
+			input:  [][]byte{frame(true, TextMessage, []byte("Hello"), true)},
+			sent:   [][]byte{append([]byte{CloseMessage}, closePayload(CloseProtocolError, "invalid masking")...)},
+		},
+		{
+			name:  "reserved bits",
+			input: [][]byte{{0xc1, 0x80, 0, 0, 0, 0}},
+			sent:  [][]byte{append([]byte{CloseMessage}, closePayload(CloseProtocolError, "reserved bits set")...)},
+		},
+		{
+			name:  "unknown opcode",
+			input: [][]byte{frame(true, 3, nil, true)},
+			sent:  [][]byte{append([]byte{CloseMessage}, closePayload(CloseProtocolError, "unknown opcode")...)},
+		},
+		{
+			name:  "fragmented control frame",
+			input: [][]byte{frame(false, PingMessage, nil, true)},
+			sent:  [][]byte{append([]byte{CloseMessage}, closePayload(CloseProtocolError, "invalid control frame")...)},
+		},
+		{
+			name:  "control frame over 125 bytes",
+			input: [][]byte{frame(true, PingMessage, long, true)},
+			sent:  [][]byte{append([]byte{CloseMessage}, closePayload(CloseProtocolError, "invalid control frame")...)},
+		},
+		{
+			name:  "continuation without a message",
+			input: [][]byte{frame(true, continuationFrame, []byte("o"), true)},
+			sent:  [][]byte{append([]byte{CloseMessage}, closePayload(CloseProtocolError, "unexpected continuation frame")...)},
+		},
+		{
+			name:  "new message during a fragmented one",
+			input: [][]byte{frame(false, TextMessage, []byte("Hel"), true), frame(true, TextMessage, []byte("lo"), true)},
+			sent:  [][]byte{append([]byte{CloseMessage}, closePayload(CloseProtocolError, "expected continuation frame")...)},
+		},
+		{
+			name:  "frame too big",
+			input: [][]byte{{0x82, 0xff, 0, 0, 0, 0, 0, 0x20, 0, 0}},
+			sent:  [][]byte{append([]byte{CloseMessage}, closePayload(CloseTooBig, "message too big")...)},
+		},
+		{
+			name:  "message too big",
+			input: [][]byte{frame(false, BinaryMessage, half, true), frame(true, continuationFrame, half, true)},
+			sent:  [][]byte{append([]byte{CloseMessage}, closePayload(CloseTooBig, "message too big")...)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			messageType, message, sent, err := exchange(t, test.client, bytes.Join(test.input, nil))
+
+			wantErr := test.err != nil || test.messageType == 0
+			switch {
+			case wantErr && err == nil:
+				t.Fatalf("got message %d %q, want an error", messageType, message)
+			case !wantErr && err != nil:
+				t.Fatalf("got error %v, want a message", err)
+			case test.err != nil && !errors.Is(err, test.err):
+				t.Errorf("got error %v, want %v", err, test.err)
+			}
+			if messageType != test.messageType || !bytes.Equal(message, test.message) {
+				t.Errorf("got message %d of %d bytes, want %d of %d bytes", messageType, len(message), test.messageType, len(test.message))
+			}
+
+			wantSent := test.sent
+			if wantSent == nil {
+				wantSent = [][]byte{normalClose}
+			}
+			if len(sent) != len(wantSent) {
+				t.Fatalf("got %d frames sent back, want %d", len(sent), len(wantSent))
+			}
+			for i := range sent {
+				if !bytes.Equal(sent[i], wantSent[i]) {
+					t.Errorf("got frame %q sent back, want %q", sent[i], wantSent[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteMessage(t *testing.T) {
+	for _, client := range []bool{false, true} {
+		for _, length := range []int{0, 5, 125, 126, 0xffff, 0x10000} {
+			local, peer := net.Pipe()
+			writer := &Conn{conn: local, reader: bufio.NewReader(local), client: client}
+			reader := &Conn{conn: peer, reader: bufio.NewReader(peer), client: !client}
+
+			payload := bytes.Repeat([]byte("x"), length)
+			go writer.WriteMessage(BinaryMessage, payload)
+			messageType, message, err := reader.ReadMessage()
+			if err != nil {
+				t.Fatalf("client %t, %d bytes: %v", client, length, err)
+			}
+			if messageType != BinaryMessage || !bytes.Equal(message, payload) {
+				t.Errorf("client %t: got message %d of %d bytes, want %d bytes", client, messageType, len(message), length)
+			}
+			local.Close()
+			peer.Close()
+		}
+	}
+
+	// The single-frame unmasked text message of RFC 6455 section 5.7.
+	var buf bytes.Buffer
+	local, peer := net.Pipe()
+	server := &Conn{conn: local, reader: bufio.NewReader(local)}
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&buf, peer)
+		close(done)
+	}()
+	if err := server.WriteMessage(TextMessage, []byte("Hello")); err != nil {
+		t.Fatal(err)
+	}
+	local.Close()
+	<-done
+	if want := []byte{0x81, 0x05, 0x48, 0x65, 0x6c, 0x6c, 0x6f}; !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got frame % x, want % x", buf.Bytes(), want)
+	}
+}
+
+func TestClose(t *testing.T) {
+	local, peer := net.Pipe()
+	conn := &Conn{conn: local, reader: bufio.NewReader(local)}
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(peer)
+		output <- data
+	}()
+
+	if err := conn.Close(CloseGoingAway, strings.Repeat("r", 200)); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Close(CloseNormal, ""); err != nil {
+		t.Errorf("got error %v closing twice, want none", err)
+	}
+	if err := conn.WriteMessage(TextMessage, []byte("late")); !errors.Is(err, ErrClosed) {
+		t.Errorf("got error %v writing after close, want ErrClosed", err)
+	}
+
+	// The reason is cut so that the close frame stays a valid control frame.
+	sent := readFrames(t, <-output, false)
+	want := append([]byte{CloseMessage}, closePayload(CloseGoingAway, strings.Repeat("r", 123))...)
+	if len(sent) != 1 || !bytes.Equal(sent[0], want) {
+		t.Errorf("got frames %q, want a single close frame with code 1001", sent)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close(CloseNormal, "")
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(messageType, append([]byte("echo: "), message...)); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	netConn, err := net.Dial("tcp", host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := NewClient(netConn, host, "/ws?types=battery", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(TextMessage, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	messageType, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messageType != TextMessage || string(message) != "echo: hi" {
+		t.Errorf("got message %d %q, want the text \"echo: hi\"", messageType, message)
+	}
+	if err := conn.Close(CloseNormal, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests that are not WebSocket upgrades are refused.
+	for _, test := range []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"plain GET", http.Header{}, http.StatusBadRequest},
+		{"old version", http.Header{"Connection": {"keep-alive, Upgrade"}, "Upgrade": {"websocket"}, "Sec-Websocket-Version": {"8"}}, http.StatusUpgradeRequired},
+		{"missing key", http.Header{"Connection": {"Upgrade"}, "Upgrade": {"WebSocket"}, "Sec-Websocket-Version": {"13"}}, http.StatusBadRequest},
+	} {
+		request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header = test.header
+		resp, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: got status %d, want %d", test.name, resp.StatusCode, test.status)
+		}
+	}
+}